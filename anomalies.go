@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/transform"
+)
+
+// AnomalyConfig 控制源的大小异常检测：记录每个源最近 Window 次下载的规则行数，
+// 本次的行数偏离中位数超过 MaxChangePercent 时视为异常（通常是下载被截断或被劫持），
+// 按 Action 给出警告或在本次构建中排除该源。
+type AnomalyConfig struct {
+	Enabled          bool    `yaml:"enabled"`
+	Action           string  `yaml:"action"`
+	MaxChangePercent float64 `yaml:"max_change_percent"`
+	MinBuilds        int     `yaml:"min_builds"`
+	Window           int     `yaml:"window"`
+	StateFile        string  `yaml:"state_file"`
+}
+
+// 异常源的处理方式。
+const (
+	anomalyWarn    = "warn"
+	anomalyExclude = "exclude"
+)
+
+// sourceSizeState 以源的 URL 为键，记录最近几次下载的规则行数（从旧到新）。
+type sourceSizeState struct {
+	Sources map[string][]int `json:"sources"`
+}
+
+// checkSourceAnomalies 检查 res.Downloads 中每个新下载的源（回退到缓存的不检查）的规则行数，
+// 并将本次的行数记入历史。历史不足 MinBuilds 次的源不检查。
+// 异常的行数同样记入历史，源的规模确实发生变化时，几次构建后中位数会随之调整。
+// 离线模式下内容都来自已检查过的缓存，不再检查。
+func checkSourceAnomalies(cfg *Config, res *output.Result) error {
+	ac := cfg.SourceAnomalies
+	if !ac.Enabled || cfg.Download.Offline {
+		return nil
+	}
+	state, err := loadSourceSizeState(ac.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read source size state '%s': %w", ac.StateFile, err)
+	}
+
+	var kept []download.Result
+	for _, d := range res.Downloads {
+		if d.Stale {
+			kept = append(kept, d)
+			continue
+		}
+		n := transform.CountRules(d.Content)
+		history := state.Sources[d.Source.URL]
+		anomalous := false
+		if len(history) >= ac.MinBuilds {
+			norm := medianInt(history)
+			change := 100.0
+			if norm > 0 {
+				change = math.Abs(float64(n-norm)) / float64(norm) * 100
+			}
+			if change > ac.MaxChangePercent && (norm > 0 || n > 0) {
+				anomalous = true
+				logging.Downloader.Warn("⚠️ Source size differs from its norm", "source", d.Source.Name, "rules", n, "median", norm,
+					"change_percent", math.Round(change*10)/10, "action", ac.Action)
+				if ac.Action == anomalyExclude {
+					res.Failed = append(res.Failed, d.Source)
+					o := res.Outcomes[d.Source.URL]
+					o.Err = fmt.Errorf("excluded: %d rules differs %.1f%% from the median %d of recent builds", n, change, norm)
+					res.Outcomes[d.Source.URL] = o
+				}
+			}
+		}
+		if !anomalous || ac.Action != anomalyExclude {
+			kept = append(kept, d)
+		}
+		history = append(history, n)
+		if len(history) > ac.Window {
+			history = history[len(history)-ac.Window:]
+		}
+		state.Sources[d.Source.URL] = history
+	}
+	res.Downloads = kept
+
+	// 删除已不在源列表中的源
+	current := make(map[string]bool, len(res.Sources))
+	for _, src := range res.Sources {
+		current[src.URL] = true
+	}
+	for url := range state.Sources {
+		if !current[url] {
+			delete(state.Sources, url)
+		}
+	}
+	if err := state.save(ac.StateFile); err != nil {
+		return fmt.Errorf("failed to write source size state '%s': %w", ac.StateFile, err)
+	}
+	return nil
+}
+
+// loadSourceSizeState 读取源的规则行数历史，文件不存在时返回空记录。
+func loadSourceSizeState(path string) (*sourceSizeState, error) {
+	state := &sourceSizeState{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, err
+		}
+	}
+	if state.Sources == nil {
+		state.Sources = make(map[string][]int)
+	}
+	return state, nil
+}
+
+// save 将记录写入 path。
+func (s *sourceSizeState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 只包含字符串与整数，编码不会失败
+	data, _ := json.Marshal(s)
+	return fileutil.WriteAtomic(path, data)
+}
+
+// medianInt 返回 values 的中位数，偶数个时取中间两个数的平均值。
+func medianInt(values []int) int {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// checkAnomalyConfig 校验 source_anomalies 配置。
+func checkAnomalyConfig(ac AnomalyConfig) error {
+	if !ac.Enabled {
+		return nil
+	}
+	if ac.Action != anomalyWarn && ac.Action != anomalyExclude {
+		return fmt.Errorf("source_anomalies.action must be %q or %q, got %q", anomalyWarn, anomalyExclude, ac.Action)
+	}
+	if ac.MaxChangePercent <= 0 {
+		return fmt.Errorf("source_anomalies.max_change_percent must be positive, got %g", ac.MaxChangePercent)
+	}
+	if ac.MinBuilds < 1 || ac.Window < ac.MinBuilds {
+		return fmt.Errorf("source_anomalies: min_builds must be at least 1 and window at least min_builds")
+	}
+	if ac.StateFile == "" {
+		return fmt.Errorf("source_anomalies.state_file must not be empty")
+	}
+	return nil
+}
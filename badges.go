@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/maputil"
+	"adguardlist/internal/output"
+)
+
+// shieldsBadge 是 shields.io endpoint badge 的 JSON 格式，见 https://shields.io/badges/endpoint-badge。
+type shieldsBadge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// writeBadges 在发布目录的 cfg.BadgesDir 中写入规则数、构建时间与源下载成功率三个徽章，
+// README 中可以用 https://img.shields.io/endpoint?url=<文件地址> 显示。
+// 徽章只反映最近一次成功的构建，不生成压缩副本与签名。
+func writeBadges(cfg *Config, res *output.Result) error {
+	if cfg.BadgesDir == "" {
+		return nil
+	}
+	dir := filepath.Join(cfg.Output.PublishDir, cfg.BadgesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create badge directory '%s': %w", dir, err)
+	}
+
+	rate := 100.0
+	if len(res.Sources) > 0 {
+		rate = float64(len(res.Downloads)-res.StaleCount()) / float64(len(res.Sources)) * 100
+	}
+	rateColor := "brightgreen"
+	switch {
+	case rate < 80:
+		rateColor = "red"
+	case rate < 95:
+		rateColor = "yellow"
+	}
+	badges := map[string]shieldsBadge{
+		"rules.json":   {1, "rules", output.GroupDigits(res.RuleCount), "blue"},
+		"updated.json": {1, "updated", res.BuildTime.UTC().Format("2006-01-02 15:04 UTC"), "informational"},
+		"sources.json": {1, "sources", fmt.Sprintf("%d/%d (%.0f%%)", len(res.Downloads)-res.StaleCount(), len(res.Sources), rate), rateColor},
+	}
+	for _, name := range maputil.SortedKeys(badges) {
+		file := filepath.Join(dir, name)
+		// shieldsBadge 只包含字符串与整数，编码不会失败
+		data, _ := json.Marshal(badges[name])
+		if err := fileutil.WriteAtomic(file, append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write badge '%s': %w", file, err)
+		}
+		res.Extras = append(res.Extras, path.Join(cfg.BadgesDir, name))
+	}
+	logging.Publisher.Debug("🏅 Wrote badges", "dir", dir)
+	return nil
+}
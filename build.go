@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"adguardlist/internal/list"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/publish"
+	"adguardlist/internal/source"
+)
+
+// runBuild 执行完整的构建流程：下载、编译、生成并写入输出文件。
+// ctx 被取消或超过 build_timeout 时中止构建，不会写出不完整的输出。
+func runBuild(ctx context.Context, cfg *Config) (err error) {
+	slog.Info("🚀 Starting AdGuard rules processing with Go...")
+	started := time.Now()
+	res := &output.Result{}
+	defer func() {
+		if reportErr := writeBuildReport(cfg, res, started, err); reportErr != nil {
+			logging.Publisher.Warn("⚠️ Failed to write build report", "error", reportErr)
+		}
+		recordMetrics(cfg, res, started, err)
+		writeStepSummary(res, started, err)
+		sendNotifications(ctx, cfg, res, started, err)
+		logTimings(res, started)
+	}()
+	b := newBuilder(cfg)
+	ctx, cancel := b.Context(ctx)
+	defer cancel()
+
+	// 1. 读取规则源列表
+	stageStart := time.Now()
+	allSources, err := source.Load(cfg.SourcesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read sources file '%s': %w", cfg.SourcesFile, err)
+	}
+	res.Sources = source.Enabled(allSources)
+	enabled := len(res.Sources)
+	if err := applyQuarantine(cfg, res); err != nil {
+		return err
+	}
+	res.TimeStage("read_sources", stageStart)
+	slog.Info("ℹ️ Found rule sources", "file", cfg.SourcesFile, "enabled", enabled, "disabled", len(allSources)-enabled,
+		"quarantined", len(res.Quarantined))
+
+	// 2. 并发下载所有规则
+	if err := b.Download(ctx, res); err != nil {
+		return err
+	}
+	if err := updateQuarantine(cfg, res); err != nil {
+		return err
+	}
+	slog.Info("📊 Download summary", "succeeded", len(res.Downloads), "stale", res.StaleCount(), "failed", len(res.Failed))
+	if err := checkSourceAnomalies(cfg, res); err != nil {
+		return err
+	}
+	if err := updateSourceHealth(cfg, res); err != nil {
+		return err
+	}
+
+	// 3. 编译并写入合并列表与各个 profile 的列表
+	if err := b.Compile(ctx, res); err != nil {
+		return err
+	}
+	if err := writeChangelog(cfg, res); err != nil {
+		return err
+	}
+	if len(cfg.Profiles) > 0 {
+		stageStart = time.Now()
+		for _, p := range cfg.Profiles {
+			if err := buildProfile(ctx, cfg, p, res); err != nil {
+				return err
+			}
+		}
+		res.TimeStage("profiles", stageStart)
+	}
+
+	// 4. 为全部发布文件生成压缩副本、别名副本、校验和、签名与索引页，再生成徽章与趋势图
+	stageStart = time.Now()
+	if err := b.Package(ctx, res); err != nil {
+		return err
+	}
+	if err := writeBadges(cfg, res); err != nil {
+		return err
+	}
+	if err := writeHistory(cfg, res, started); err != nil {
+		return err
+	}
+	res.TimeStage("publish", stageStart)
+
+	// 5. 推送到外部的发布目标
+	res.RenderText = func(name, text, fallback string) (string, error) {
+		return renderNotification(name, text, fallback, newNotificationData(cfg, res, res.BuildTime, nil))
+	}
+	if err := publish.Run(ctx, &cfg.Publishers, &cfg.Output, res); err != nil {
+		return err
+	}
+
+	// 为后续步骤设置 GITHUB_ENV 与 GITHUB_OUTPUT
+	writeGithubVars(res)
+
+	slog.Info("✅ All tasks completed successfully.", "duration", time.Since(started).Round(time.Millisecond))
+	if quiet {
+		printSummary(os.Stdout, res, time.Since(started))
+	}
+	return nil
+}
+
+// newBuilder 按配置创建构建列表所用的 list.Builder，profile 使用 ProfileConfig.config 生成的配置。
+func newBuilder(cfg *Config) *list.Builder {
+	return list.New(
+		list.WithDownloadConfig(cfg.Download),
+		list.WithCompileConfig(cfg.Compile),
+		list.WithOutputConfig(cfg.Output),
+		list.WithAliases(cfg.Publishers.Aliases),
+		list.WithTimeout(cfg.BuildTimeout),
+		list.WithMaxShrink(cfg.MaxShrinkPercent),
+		list.WithPrevious(cfg.Changelog.File != "" || os.Getenv("GITHUB_STEP_SUMMARY") != ""),
+	)
+}
+
+// writeGithubVars 在 GitHub Actions 中运行时，将统计信息写入 GITHUB_ENV 作为后续步骤的环境变量，
+// 并写入 GITHUB_OUTPUT 作为本步骤的输出，供其他作业或可复用工作流通过 steps.<id>.outputs 读取。
+func writeGithubVars(res *output.Result) {
+	vars := []struct {
+		key string
+		val int
+	}{
+		{"RULES_COUNT", res.RuleCount},
+		{"SUCCESS_COUNT", len(res.Downloads)},
+		{"FAILED_COUNT", len(res.Failed)},
+		{"STALE_COUNT", res.StaleCount()},
+		{"TOTAL_COUNT", len(res.Sources)},
+	}
+	for _, name := range []string{"GITHUB_ENV", "GITHUB_OUTPUT"} {
+		path := os.Getenv(name)
+		if path == "" {
+			continue
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logging.Publisher.Warn("⚠️ Could not open GitHub Actions file", "file", name, "error", err)
+			continue
+		}
+		for _, v := range vars {
+			if _, err := fmt.Fprintf(f, "%s=%d\n", v.key, v.val); err != nil {
+				logging.Publisher.Warn("⚠️ Failed to write GitHub Actions variable", "file", name, "key", v.key, "error", err)
+			}
+		}
+		if res.IPFSCID != "" {
+			if _, err := fmt.Fprintf(f, "IPFS_CID=%s\n", res.IPFSCID); err != nil {
+				logging.Publisher.Warn("⚠️ Failed to write GitHub Actions variable", "file", name, "key", "IPFS_CID", "error", err)
+			}
+		}
+		f.Close()
+	}
+}
+
+// printSummary 输出构建结果摘要，供 -quiet 模式在 CI 日志中查看。
+func printSummary(w io.Writer, res *output.Result, duration time.Duration) {
+	fmt.Fprintf(w, "✅ Built %d rules from %d/%d sources (%d stale, %d failed) in %s, published %d files.\n",
+		res.RuleCount, len(res.Downloads), len(res.Sources), res.StaleCount(), len(res.Failed),
+		duration.Round(time.Millisecond), len(res.Published))
+	if len(res.Failed) > 0 {
+		names := make([]string, len(res.Failed))
+		for i, src := range res.Failed {
+			names[i] = src.Name
+		}
+		fmt.Fprintf(w, "⚠️ Failed sources: %s\n", strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// ChangelogConfig 控制域名变更日志：每次构建将合并列表与上一次发布的列表比较，
+// 在 File 的开头追加一节，列出新增与删除的域名，每类最多 MaxDomains 个，只保留最近 MaxEntries 节。
+// File 应提交到仓库中，用于回答某个域名是何时被加入或移出列表的。
+type ChangelogConfig struct {
+	File       string `yaml:"file"`
+	MaxDomains int    `yaml:"max_domains"`
+	MaxEntries int    `yaml:"max_entries"`
+}
+
+// changelogTitle 是变更日志的第一行，每一节以 "## " 开头。
+const changelogTitle = "# Changelog\n"
+
+// writeChangelog 比较 res.Previous 与 res.Content 中被整体屏蔽的域名，将变化写入变更日志。
+// 首次构建（没有上一次的列表）或域名没有变化时不写入。
+func writeChangelog(cfg *Config, res *output.Result) error {
+	cc := cfg.Changelog
+	if cc.File == "" || res.Previous == nil {
+		return nil
+	}
+	before := make(map[string]bool)
+	for _, d := range output.BlockedDomainList(res.Previous) {
+		before[d] = true
+	}
+	after := make(map[string]bool)
+	for _, d := range output.BlockedDomainList(res.Content) {
+		after[d] = true
+	}
+	added, removed := missingFrom(after, before), missingFrom(before, after)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "## %s (version %s)\n\n", res.BuildTime.UTC().Format("2006-01-02 15:04 UTC"), res.BuildTime.Format("200601021504"))
+	fmt.Fprintf(&entry, "%d domains added, %d removed, %s rules in total.\n", len(added), len(removed), output.GroupDigits(res.RuleCount))
+	for _, group := range []struct {
+		title   string
+		domains []string
+	}{{"Added", added}, {"Removed", removed}} {
+		if len(group.domains) == 0 {
+			continue
+		}
+		fmt.Fprintf(&entry, "\n### %s (%d)\n\n", group.title, len(group.domains))
+		for i, d := range group.domains {
+			if cc.MaxDomains > 0 && i == cc.MaxDomains {
+				fmt.Fprintf(&entry, "- ... and %d more\n", len(group.domains)-i)
+				break
+			}
+			fmt.Fprintf(&entry, "- `%s`\n", d)
+		}
+	}
+
+	entries, err := readChangelog(cc.File)
+	if err != nil {
+		return fmt.Errorf("failed to read changelog '%s': %w", cc.File, err)
+	}
+	entries = append([]string{entry.String()}, entries...)
+	if cc.MaxEntries > 0 && len(entries) > cc.MaxEntries {
+		entries = entries[:cc.MaxEntries]
+	}
+	var b bytes.Buffer
+	b.WriteString(changelogTitle)
+	for _, e := range entries {
+		b.WriteString("\n")
+		b.WriteString(e)
+	}
+	if err := os.MkdirAll(filepath.Dir(cc.File), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for '%s': %w", cc.File, err)
+	}
+	if err := fileutil.WriteAtomic(cc.File, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write changelog '%s': %w", cc.File, err)
+	}
+	logging.Publisher.Info("📰 Updated changelog", "file", cc.File, "added", len(added), "removed", len(removed))
+	return nil
+}
+
+// readChangelog 读取变更日志并按 "## " 标题拆分为各节（从新到旧），文件不存在时返回空列表。
+func readChangelog(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, part := range strings.Split("\n"+string(data), "\n## ")[1:] {
+		entries = append(entries, "## "+strings.TrimRight(part, "\n")+"\n")
+	}
+	return entries, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"adguardlist/internal/publish"
+)
+
+// TelegramConfig 是通过 Telegram 机器人发送的通知。机器人的 token 从环境变量 BotTokenEnv 读取，
+// ChatID 可写 ${VAR} 引用环境变量；APIURL 可改为自建的 Bot API 服务器。
+type TelegramConfig struct {
+	On          string `yaml:"on"`
+	BotTokenEnv string `yaml:"bot_token_env"`
+	ChatID      string `yaml:"chat_id"`
+	APIURL      string `yaml:"api_url"`
+	Message     string `yaml:"message"`
+}
+
+// ChatWebhookConfig 是发送到 Slack 或 Discord incoming webhook 的通知，webhook 地址从环境变量 WebhookURLEnv 读取。
+type ChatWebhookConfig struct {
+	On            string `yaml:"on"`
+	WebhookURLEnv string `yaml:"webhook_url_env"`
+	Message       string `yaml:"message"`
+}
+
+// 各平台单条消息的长度上限（按字符计），超出部分被截断。
+const (
+	telegramMessageLimit = 4096
+	slackMessageLimit    = 40000
+	discordMessageLimit  = 2000
+)
+
+// chatMessage 是即时通讯通知的默认模板。
+const chatMessage = `{{if not .Success}}❌{{else if .Failed}}⚠️{{else}}✅{{end}} {{.Title}}: build {{.Status}} in {{.Duration}}
+{{- if .Error}}
+Error: {{.Error}}
+{{- end}}
+Rules: {{.Rules}}{{if .HasDiff}} (+{{.Added}} / -{{.Removed}}){{end}}
+Sources: {{.Succeeded}}/{{.Sources}} downloaded{{if .Stale}}, {{.Stale}} from cache{{end}}{{if .Quarantined}}, {{.Quarantined}} quarantined{{end}}
+{{- range .Failed}}
+• {{.Name}}: {{.Error}}
+{{- end}}
+{{- if .ListURL}}
+{{.ListURL}}
+{{- end}}
+{{- if .IndexURL}}
+{{.IndexURL}}
+{{- end}}
+`
+
+// send 通过 Bot API 的 sendMessage 发送通知。
+func (tc TelegramConfig) send(ctx context.Context, data notificationData) error {
+	text, err := renderNotification("telegram message", tc.Message, chatMessage, data)
+	if err != nil {
+		return err
+	}
+	token := os.Getenv(tc.BotTokenEnv)
+	if token == "" {
+		return fmt.Errorf("$%s is not set", tc.BotTokenEnv)
+	}
+	endpoint := strings.TrimSuffix(tc.APIURL, "/") + "/bot" + token + "/sendMessage"
+	payload := map[string]any{
+		"chat_id":                  os.ExpandEnv(tc.ChatID),
+		"text":                     truncateMessage(text, telegramMessageLimit),
+		"disable_web_page_preview": true,
+	}
+	return postJSON(ctx, endpoint, payload, "telegram")
+}
+
+// sender 返回将通知发送到 Slack（service 为 slack）或 Discord 的 incoming webhook 的函数。
+func (wc ChatWebhookConfig) sender(service string) func(context.Context, notificationData) error {
+	return func(ctx context.Context, data notificationData) error {
+		return wc.send(ctx, service, data)
+	}
+}
+
+// send 将通知发送到 service 的 incoming webhook。
+func (wc ChatWebhookConfig) send(ctx context.Context, service string, data notificationData) error {
+	text, err := renderNotification(service+" message", wc.Message, chatMessage, data)
+	if err != nil {
+		return err
+	}
+	endpoint := os.Getenv(wc.WebhookURLEnv)
+	if endpoint == "" {
+		return fmt.Errorf("$%s is not set", wc.WebhookURLEnv)
+	}
+	var payload map[string]any
+	if service == "discord" {
+		payload = map[string]any{"content": truncateMessage(text, discordMessageLimit)}
+	} else {
+		payload = map[string]any{"text": truncateMessage(text, slackMessageLimit)}
+	}
+	return postJSON(ctx, endpoint, payload, service)
+}
+
+// postJSON 以 JSON 格式 POST payload，非 2xx 响应视为失败。
+func postJSON(ctx context.Context, endpoint string, payload any, service string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return publish.PostBody(ctx, endpoint, body, http.Header{"Content-Type": {"application/json"}}, service)
+}
+
+// truncateMessage 将 s 截断为最多 limit 个字符。
+func truncateMessage(s string, limit int) string {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s
+	}
+	return string(r[:limit-1]) + "…"
+}
+
+// checkTelegram 校验 Telegram 通知的配置。
+func checkTelegram(tc TelegramConfig) error {
+	if err := checkNotifyOn("telegram", tc.On); err != nil {
+		return err
+	}
+	if tc.On != notifyNever && (tc.BotTokenEnv == "" || tc.ChatID == "" || tc.APIURL == "") {
+		return fmt.Errorf("notify.telegram requires bot_token_env, chat_id and api_url")
+	}
+	return nil
+}
+
+// checkChatWebhook 校验 Slack 或 Discord 通知的配置。
+func checkChatWebhook(service string, wc ChatWebhookConfig) error {
+	if err := checkNotifyOn(service, wc.On); err != nil {
+		return err
+	}
+	if wc.On != notifyNever && wc.WebhookURLEnv == "" {
+		return fmt.Errorf("notify.%s.webhook_url_env must not be empty", service)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/maputil"
+	"adguardlist/internal/source"
+	"adguardlist/internal/transform"
+)
+
+func cmdValidate(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("validate", "")
+	fs.Parse(args)
+
+	sources, err := source.Load(cfg.SourcesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read sources file '%s': %w", cfg.SourcesFile, err)
+	}
+
+	var problems []string
+	seenURLs := make(map[string]bool)
+	seenNames := make(map[string]bool)
+	for _, src := range sources {
+		if src.IsGit() {
+			if _, err := exec.LookPath("git"); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: git source requires the git command: %v", src.Name, err))
+			}
+		} else if path, ok := src.LocalPath(); ok {
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", src.Name, err))
+			}
+		} else if u, err := url.Parse(src.URL); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid url: %v", src.Name, err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			problems = append(problems, fmt.Sprintf("%s: unsupported url scheme %q", src.Name, u.Scheme))
+		}
+		if !src.TLS.IsZero() {
+			if _, err := src.TLS.Config(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", src.Name, err))
+			}
+		}
+		if seenURLs[src.URL] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate url %s", src.Name, src.URL))
+		}
+		if seenNames[src.Name] && src.Name != src.URL {
+			problems = append(problems, fmt.Sprintf("duplicate source name %q", src.Name))
+		}
+		seenURLs[src.URL] = true
+		seenNames[src.Name] = true
+	}
+
+	for _, p := range problems {
+		slog.Error("❌ " + p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s) in '%s'", len(problems), cfg.SourcesFile)
+	}
+	slog.Info("✅ Config and sources are valid.", "sources", len(sources), "enabled", len(source.Enabled(sources)))
+	return nil
+}
+
+// ruleSet 返回 content 中所有有效规则的集合。
+func ruleSet(content []byte) map[string]bool {
+	rules := make(map[string]bool)
+	for _, line := range transform.SplitLines(content) {
+		line = strings.TrimSpace(line)
+		if transform.IsRuleLine(line) {
+			rules[line] = true
+		}
+	}
+	return rules
+}
+
+// missingFrom 返回在 a 中但不在 b 中的规则，按字典序排列。
+func missingFrom(a, b map[string]bool) []string {
+	var out []string
+	for rule := range a {
+		if !b[rule] {
+			out = append(out, rule)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// cmdDiff 比较两个规则列表（本地路径或 URL），输出新增、删除与修饰符发生变化的规则。
+// 默认先按源格式转换为 adblock 语法并规范化修饰符的顺序与大小写，hosts、纯域名等格式的列表
+// 也可以与 adblock 列表直接比较；-raw 按原始文本逐行比较。
+func cmdDiff(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("diff", "<old> <new>")
+	summaryOnly := fs.Bool("summary", false, "only print the summary line")
+	raw := fs.Bool("raw", false, "compare lines as they are, without converting or normalizing them")
+	format := fs.String("format", transform.FormatAuto, "format of both lists: auto, adblock, hosts, domains or dnsmasq")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly two files or urls, got %d", fs.NArg())
+	}
+
+	d, err := download.New(&cfg.Download)
+	if err != nil {
+		return err
+	}
+	oldRules, err := readDiffList(ctx, d, fs.Arg(0), *format, *raw, cfg.Compile.StripLocalhost)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", fs.Arg(0), err)
+	}
+	newRules, err := readDiffList(ctx, d, fs.Arg(1), *format, *raw, cfg.Compile.StripLocalhost)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", fs.Arg(1), err)
+	}
+
+	added := missingFrom(newRules, oldRules)
+	removed := missingFrom(oldRules, newRules)
+	// 匹配模式相同、只有修饰符不同的规则视为修改
+	var changed [][2][]string
+	if !*raw {
+		addedBy, removedBy := groupByPattern(added), groupByPattern(removed)
+		for _, key := range maputil.SortedKeys(removedBy) {
+			if addedBy[key] != nil {
+				changed = append(changed, [2][]string{removedBy[key], addedBy[key]})
+			}
+		}
+		inChange := make(map[string]bool)
+		for _, c := range changed {
+			for _, rule := range append(append([]string(nil), c[0]...), c[1]...) {
+				inChange[rule] = true
+			}
+		}
+		unchanged := func(rule string) bool { return !inChange[rule] }
+		removed, added = transform.FilterLines(removed, unchanged), transform.FilterLines(added, unchanged)
+	}
+	if !*summaryOnly {
+		for _, rule := range removed {
+			fmt.Printf("- %s\n", rule)
+		}
+		for _, rule := range added {
+			fmt.Printf("+ %s\n", rule)
+		}
+		for _, c := range changed {
+			fmt.Printf("~ %s -> %s\n", strings.Join(c[0], " "), strings.Join(c[1], " "))
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed (%d -> %d rules)\n", len(added), len(removed), len(changed), len(oldRules), len(newRules))
+	return nil
+}
+
+// readDiffList 读取本地文件或 URL 指向的列表，返回其中规则的集合。
+// raw 为 false 时规则按 format 转换为 adblock 语法，并以 transform.DedupeKey 规范化。
+func readDiffList(ctx context.Context, d *download.Downloader, location, format string, raw, stripLocalhost bool) (map[string]bool, error) {
+	sources, err := source.Normalize([]source.Source{{URL: location, Format: format}})
+	if err != nil {
+		return nil, err
+	}
+	content, _, err := d.FetchContent(ctx, sources[0])
+	if err != nil {
+		return nil, err
+	}
+	if raw {
+		return ruleSet(content), nil
+	}
+	lines, _ := transform.ConvertSource(sources[0].Format, content, stripLocalhost)
+	rules := make(map[string]bool)
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); transform.IsRuleLine(line) {
+			rules[transform.DedupeKey(transform.ToASCIIRule(line))] = true
+		}
+	}
+	return rules, nil
+}
+
+// groupByPattern 按例外标记与匹配模式对规则分组。
+func groupByPattern(rules []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, rule := range rules {
+		r := transform.ParseAdblockRule(rule)
+		r.Modifiers = nil
+		groups[r.String()] = append(groups[r.String()], rule)
+	}
+	return groups
+}
+
+func cmdStats(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("stats", "[file]")
+	fs.Parse(args)
+	path := filepath.Join(cfg.Output.PublishDir, cfg.Output.OutputFile)
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	var comments, blocking, exceptions, regex, hosts, modifiers int
+	printed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "!") || strings.HasPrefix(line, "#"):
+			comments++
+			// 头部中的元信息以 "# Key: value" 形式输出
+			if key, value, ok := strings.Cut(strings.TrimLeft(line, "!# "), ": "); ok && !printed[key] {
+				switch key {
+				case "Title", "Version", "Generated", "Total sources":
+					fmt.Printf("%-16s %s\n", key+":", value)
+					printed[key] = true
+				}
+			}
+		case strings.HasPrefix(line, "@@"):
+			exceptions++
+		case strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/"):
+			regex++
+			blocking++
+		case strings.HasPrefix(line, "0.0.0.0 ") || strings.HasPrefix(line, "127.0.0.1 "):
+			hosts++
+			blocking++
+		default:
+			if strings.Contains(line, "$") {
+				modifiers++
+			}
+			blocking++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%-16s %s (%d bytes)\n", "File:", path, len(content))
+	fmt.Printf("%-16s %d\n", "Total rules:", blocking+exceptions)
+	fmt.Printf("%-16s %d\n", "Blocking:", blocking)
+	fmt.Printf("%-16s %d\n", "Exceptions:", exceptions)
+	fmt.Printf("%-16s %d\n", "Regex:", regex)
+	fmt.Printf("%-16s %d\n", "Hosts-style:", hosts)
+	fmt.Printf("%-16s %d\n", "With modifiers:", modifiers)
+	fmt.Printf("%-16s %d\n", "Comment lines:", comments)
+	return nil
+}
+
+func cmdServe(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("serve", "")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	interval := fs.Duration("interval", 0, "rebuild the list at this interval (0 disables rebuilding)")
+	fs.Parse(args)
+
+	if *interval > 0 {
+		go func() {
+			for {
+				if err := runBuild(ctx, cfg); err != nil {
+					slog.Error("❌ Scheduled build failed", "error", err)
+				}
+				if download.SleepContext(ctx, *interval) != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(cfg.Output.PublishDir)))
+	if cfg.Metrics.Path != "" {
+		mux.Handle(cfg.Metrics.Path, metrics)
+	}
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("🌐 Serving publish directory", "dir", cfg.Output.PublishDir, "addr", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("👋 Server stopped.")
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"adguardlist/internal/compile"
+	"adguardlist/internal/download"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/publish"
+)
+
+// defaultConfigFile 是启动时加载的默认配置文件路径。
+const defaultConfigFile = "setting/config.yaml"
+
+// Config 描述一次构建所需的全部可调参数，从 YAML 配置文件加载。
+// 下载、编译与输出各阶段的参数由各自的配置类型描述，在配置文件中与其他参数位于同一层级。
+type Config struct {
+	SourcesFile      string           `yaml:"sources_file"`
+	Download         download.Config  `yaml:",inline"`
+	Compile          compile.Config   `yaml:",inline"`
+	Output           output.Config    `yaml:",inline"`
+	BuildTimeout     time.Duration    `yaml:"build_timeout"`
+	ReportFile       string           `yaml:"report_file"`
+	BadgesDir        string           `yaml:"badges_dir"`
+	History          HistoryConfig    `yaml:"history"`
+	HealthFile       string           `yaml:"health_file"`
+	Changelog        ChangelogConfig  `yaml:"changelog"`
+	Notify           NotifyConfig     `yaml:"notify"`
+	Publishers       publish.Config   `yaml:"publishers"`
+	SourceAnomalies  AnomalyConfig    `yaml:"source_anomalies"`
+	Quarantine       QuarantineConfig `yaml:"quarantine"`
+	MaxShrinkPercent float64          `yaml:"max_shrink_percent"`
+	Profiles         []ProfileConfig  `yaml:"profiles"`
+	Logging          logging.Config   `yaml:"logging"`
+	Metrics          MetricsConfig    `yaml:"metrics"`
+}
+
+// defaultConfig 返回与历史硬编码常量一致的默认配置。
+func defaultConfig() *Config {
+	return &Config{
+		SourcesFile:      "setting/sources.yaml",
+		Download:         download.DefaultConfig(),
+		Compile:          compile.DefaultConfig(),
+		Output:           output.DefaultConfig(),
+		BuildTimeout:     20 * time.Minute,
+		ReportFile:       "report.json",
+		MaxShrinkPercent: 30,
+		BadgesDir:        "badges",
+		History:          HistoryConfig{File: "rules/history.jsonl", MaxEntries: 2000, Chart: "history.svg"},
+		HealthFile:       "rules/source_health.json",
+		Changelog:        ChangelogConfig{File: "rules/CHANGELOG.md", MaxDomains: 200, MaxEntries: 500},
+		Notify: NotifyConfig{
+			Email:    EmailConfig{On: notifyNever, Port: 587, PasswordEnv: "SMTP_PASSWORD"},
+			Telegram: TelegramConfig{On: notifyNever, BotTokenEnv: "TELEGRAM_BOT_TOKEN", APIURL: "https://api.telegram.org"},
+			Slack:    ChatWebhookConfig{On: notifyNever, WebhookURLEnv: "SLACK_WEBHOOK_URL"},
+			Discord:  ChatWebhookConfig{On: notifyNever, WebhookURLEnv: "DISCORD_WEBHOOK_URL"},
+		},
+		Publishers: publish.DefaultConfig(),
+		SourceAnomalies: AnomalyConfig{
+			Enabled:          true,
+			Action:           anomalyWarn,
+			MaxChangePercent: 50,
+			MinBuilds:        3,
+			Window:           10,
+			StateFile:        ".cache/source_sizes.json",
+		},
+		Quarantine: QuarantineConfig{
+			Enabled:   true,
+			Failures:  5,
+			StateFile: ".cache/quarantine.json",
+			Report:    "quarantine.txt",
+		},
+		Logging: logging.Config{Format: logging.FormatText, Level: "info"},
+		Metrics: MetricsConfig{Path: "/metrics", Job: "adguardlist"},
+	}
+}
+
+// loadConfig 读取 path 指向的 YAML 配置并覆盖默认值。
+// 配置文件不存在时直接返回默认配置。
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate 检查配置中的取值是否合法。
+func (c *Config) validate() error {
+	if c.SourcesFile == "" {
+		return fmt.Errorf("sources_file must not be empty")
+	}
+	if err := c.Download.Check(); err != nil {
+		return err
+	}
+	if err := c.Compile.Check(); err != nil {
+		return err
+	}
+	if err := c.Output.Check(); err != nil {
+		return err
+	}
+	if c.BuildTimeout < 0 {
+		return fmt.Errorf("build_timeout must not be negative, got %s", c.BuildTimeout)
+	}
+	if c.MaxShrinkPercent < 0 || c.MaxShrinkPercent > 100 {
+		return fmt.Errorf("max_shrink_percent must be between 0 and 100, got %g", c.MaxShrinkPercent)
+	}
+	if c.BadgesDir != "" && filepath.Base(c.BadgesDir) != c.BadgesDir {
+		return fmt.Errorf("badges_dir must be a plain directory name, got %q", c.BadgesDir)
+	}
+	if c.History.MaxEntries < 0 {
+		return fmt.Errorf("history.max_entries must not be negative, got %d", c.History.MaxEntries)
+	}
+	if filepath.Base(c.History.Chart) != c.History.Chart {
+		return fmt.Errorf("history.chart must be a plain file name, got %q", c.History.Chart)
+	}
+	if err := checkProfiles(c); err != nil {
+		return err
+	}
+	if err := checkAnomalyConfig(c.SourceAnomalies); err != nil {
+		return err
+	}
+	if err := checkQuarantine(c.Quarantine); err != nil {
+		return err
+	}
+	if c.Changelog.MaxDomains < 0 || c.Changelog.MaxEntries < 0 {
+		return fmt.Errorf("changelog: max_domains and max_entries must not be negative")
+	}
+	if err := checkNotify(c.Notify); err != nil {
+		return err
+	}
+	if err := publish.Check(c.Publishers); err != nil {
+		return err
+	}
+	c.Output.Header.IPNSKey = ""
+	if ic := c.Publishers.IPFS; ic.Enabled {
+		c.Output.Header.IPNSKey = ic.IPNSKey
+	}
+	if err := checkMetrics(c.Metrics); err != nil {
+		return err
+	}
+	return logging.Check(c.Logging)
+}
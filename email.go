@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig 是通过 SMTP 发送的邮件通知。除 PasswordEnv 外的字段都会展开其中的环境变量（如 ${SMTP_HOST}），
+// 密码从环境变量 PasswordEnv 读取，不写在配置文件中。TLS 为 true 时使用隐式 TLS（通常是 465 端口），
+// 否则服务器支持时使用 STARTTLS。Subject 与 Body 是 text/template 模板，以 @ 开头表示从文件读取。
+type EmailConfig struct {
+	On          string   `yaml:"on"`
+	Host        string   `yaml:"host"`
+	Port        int      `yaml:"port"`
+	TLS         bool     `yaml:"tls"`
+	Username    string   `yaml:"username"`
+	PasswordEnv string   `yaml:"password_env"`
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+	Subject     string   `yaml:"subject"`
+	Body        string   `yaml:"body"`
+}
+
+// send 渲染通知并发送给 ec.To 中的全部收件人。
+func (ec EmailConfig) send(ctx context.Context, data notificationData) error {
+	subject, err := renderNotification("email subject", ec.Subject, notificationSubject, data)
+	if err != nil {
+		return err
+	}
+	body, err := renderNotification("email body", ec.Body, notificationBody, data)
+	if err != nil {
+		return err
+	}
+	host := os.ExpandEnv(ec.Host)
+	from := os.ExpandEnv(ec.From)
+	var to []string
+	for _, addr := range ec.To {
+		to = append(to, strings.Split(os.ExpandEnv(addr), ",")...)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+
+	addr := net.JoinHostPort(host, strconv.Itoa(ec.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	if ec.TLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake with %s failed: %w", addr, err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && !ec.TLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls with %s failed: %w", addr, err)
+		}
+	}
+	if user := os.ExpandEnv(ec.Username); user != "" {
+		// PlainAuth 只在 TLS 连接或本机服务器上发送密码
+		if err := c.Auth(smtp.PlainAuth("", user, os.Getenv(ec.PasswordEnv), host)); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(strings.TrimSpace(rcpt)); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return c.Quit()
+}
+
+// checkEmail 校验邮件通知的配置。
+func checkEmail(ec EmailConfig) error {
+	if err := checkNotifyOn("email", ec.On); err != nil {
+		return err
+	}
+	if ec.On == notifyNever {
+		return nil
+	}
+	if ec.Host == "" || ec.From == "" || len(ec.To) == 0 {
+		return fmt.Errorf("notify.email requires host, from and to")
+	}
+	if ec.Port < 1 || ec.Port > 65535 {
+		return fmt.Errorf("notify.email.port must be between 1 and 65535, got %d", ec.Port)
+	}
+	return nil
+}
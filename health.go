@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/source"
+)
+
+// healthWindow 是计算平均大小与耗时的近似窗口：前 healthWindow 次成功下载取算术平均，
+// 之后按 1/healthWindow 的权重滑动，使平均值跟随源的变化而不被很久以前的下载拖累。
+const healthWindow = 20
+
+// sourceHealthState 以源的 URL 为键，记录每个源的下载健康状况。
+type sourceHealthState struct {
+	Sources map[string]*sourceHealth `json:"sources"`
+}
+
+// sourceHealth 是一个源的下载记录。AvgBytes 与 AvgLatency 只统计成功的下载。
+type sourceHealth struct {
+	Name                string    `json:"name"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastError           string    `json:"last_error,omitempty"`
+	Successes           int       `json:"successes"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	AvgBytes            float64   `json:"avg_bytes"`
+	AvgLatency          float64   `json:"avg_latency_seconds"`
+}
+
+// movingAverage 将 value 计入第 n 次成功下载的平均值 avg。
+func movingAverage(avg, value float64, n int) float64 {
+	return avg + (value-avg)/float64(min(n, healthWindow))
+}
+
+// updateSourceHealth 将本次构建中每个源的下载结果记入 cfg.HealthFile。
+// 回退到缓存与被排除的源记为失败，被隔离的源本次没有下载，保持原记录。
+func updateSourceHealth(cfg *Config, res *output.Result) error {
+	if cfg.HealthFile == "" {
+		return nil
+	}
+	state, err := loadSourceHealthState(cfg.HealthFile)
+	if err != nil {
+		return fmt.Errorf("failed to read source health file '%s': %w", cfg.HealthFile, err)
+	}
+	sizes := make(map[string]int, len(res.Downloads))
+	for _, d := range res.Downloads {
+		if !d.Stale {
+			sizes[d.Source.URL] = len(d.Content)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, src := range res.Sources {
+		o, ok := res.Outcomes[src.URL]
+		if !ok {
+			continue
+		}
+		h := state.Sources[src.URL]
+		if h == nil {
+			h = &sourceHealth{}
+			state.Sources[src.URL] = h
+		}
+		h.Name = src.Name
+		if size, ok := sizes[src.URL]; ok && o.Err == nil {
+			h.Successes++
+			h.ConsecutiveFailures = 0
+			h.LastSuccess = now
+			h.AvgBytes = movingAverage(h.AvgBytes, float64(size), h.Successes)
+			h.AvgLatency = math.Round(movingAverage(h.AvgLatency, o.Duration.Seconds(), h.Successes)*1000) / 1000
+			continue
+		}
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastFailure = now
+		if o.Err != nil {
+			h.LastError = o.Err.Error()
+		}
+	}
+
+	// 删除已不在源列表中的源
+	current := make(map[string]bool, len(res.Sources)+len(res.Quarantined))
+	for _, src := range append(append([]source.Source(nil), res.Sources...), res.Quarantined...) {
+		current[src.URL] = true
+	}
+	for url := range state.Sources {
+		if !current[url] {
+			delete(state.Sources, url)
+		}
+	}
+	if err := state.save(cfg.HealthFile); err != nil {
+		return fmt.Errorf("failed to write source health file '%s': %w", cfg.HealthFile, err)
+	}
+	logging.Downloader.Debug("🩺 Updated source health", "file", cfg.HealthFile, "sources", len(state.Sources))
+	return nil
+}
+
+// loadSourceHealthState 读取源的健康记录，文件不存在时返回空记录。
+func loadSourceHealthState(path string) (*sourceHealthState, error) {
+	state := &sourceHealthState{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, err
+		}
+	}
+	if state.Sources == nil {
+		state.Sources = make(map[string]*sourceHealth)
+	}
+	return state, nil
+}
+
+// save 将健康记录写入 path。
+func (s *sourceHealthState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(path, append(data, '\n'))
+}
+
+// cmdSources 提供与源列表相关的子命令，目前只有 status。
+func cmdSources(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("sources", "status [-failing] [-json]")
+	fs.Parse(args)
+	action, rest := "status", fs.Args()
+	if len(rest) > 0 {
+		action, rest = rest[0], rest[1:]
+	}
+	if action != "status" {
+		fs.Usage()
+		return fmt.Errorf("unknown sources action %q", action)
+	}
+
+	sfs := newFlagSet("sources status", "[-failing] [-json]")
+	failing := sfs.Bool("failing", false, "only show sources whose last download failed")
+	asJSON := sfs.Bool("json", false, "print the health records as JSON")
+	sfs.Parse(rest)
+
+	sources, err := source.Load(cfg.SourcesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read sources file '%s': %w", cfg.SourcesFile, err)
+	}
+	state, err := loadSourceHealthState(cfg.HealthFile)
+	if err != nil {
+		return fmt.Errorf("failed to read source health file '%s': %w", cfg.HealthFile, err)
+	}
+	quarantine := &quarantineState{}
+	if cfg.Quarantine.Enabled {
+		if quarantine, err = loadQuarantineState(cfg.Quarantine.StateFile); err != nil {
+			return fmt.Errorf("failed to read quarantine state '%s': %w", cfg.Quarantine.StateFile, err)
+		}
+	}
+
+	type sourceStatus struct {
+		URL    string `json:"url"`
+		Status string `json:"status"` // ok、failing、quarantined、disabled 或 unknown（尚无记录）
+		*sourceHealth
+	}
+	var statuses []sourceStatus
+	for _, src := range sources {
+		st := sourceStatus{URL: src.URL, Status: "unknown", sourceHealth: state.Sources[src.URL]}
+		if st.sourceHealth == nil {
+			st.sourceHealth = &sourceHealth{Name: src.Name}
+		} else if st.ConsecutiveFailures > 0 {
+			st.Status = "failing"
+		} else {
+			st.Status = "ok"
+		}
+		if e := quarantine.Sources[src.URL]; e != nil && e.quarantined() {
+			st.Status = "quarantined"
+		}
+		if !src.IsEnabled() {
+			st.Status = "disabled"
+		}
+		if *failing && st.Status != "failing" && st.Status != "quarantined" {
+			continue
+		}
+		statuses = append(statuses, st)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+	ago := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Minute).String() + " ago"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tLAST SUCCESS\tFAILURES\tAVG SIZE\tAVG LATENCY\tLAST ERROR")
+	for _, st := range statuses {
+		lastError := ""
+		if st.ConsecutiveFailures > 0 {
+			lastError = strings.ReplaceAll(st.LastError, "\n", " ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%.2fs\t%s\n", st.Name, st.Status, ago(st.LastSuccess),
+			st.ConsecutiveFailures, st.Successes+st.Failures, download.FormatBytes(int64(st.AvgBytes)), st.AvgLatency, lastError)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// HistoryConfig 控制构建历史：每次成功的构建向 File 追加一行 JSON 记录规则数与各源的统计，
+// 并根据历史在发布目录中生成规则数的 SVG 趋势图 Chart。File 应提交到仓库中以便在构建间保留。
+type HistoryConfig struct {
+	File       string `yaml:"file"`
+	MaxEntries int    `yaml:"max_entries"`
+	Chart      string `yaml:"chart"`
+}
+
+// historyDropRatio 是趋势图中标记为骤降的规则数降幅。
+const historyDropRatio = 0.1
+
+// historyEntry 是历史文件中的一行。
+type historyEntry struct {
+	Time        time.Time      `json:"time"`
+	Rules       int            `json:"rules"`
+	Sources     int            `json:"sources"`
+	Succeeded   int            `json:"succeeded"`
+	Stale       int            `json:"stale"`
+	Failed      int            `json:"failed"`
+	Duration    float64        `json:"duration_seconds"`
+	SourceRules map[string]int `json:"source_rules"` // 各源去重后保留的规则数
+}
+
+// writeHistory 将本次构建追加到历史文件，只保留最近 MaxEntries 条，并重新生成趋势图。
+func writeHistory(cfg *Config, res *output.Result, started time.Time) error {
+	hc := cfg.History
+	if hc.File == "" {
+		return nil
+	}
+	entries, err := readHistory(hc.File)
+	if err != nil {
+		return fmt.Errorf("failed to read history file '%s': %w", hc.File, err)
+	}
+	entry := historyEntry{
+		Time:        res.BuildTime.UTC().Truncate(time.Second),
+		Rules:       res.RuleCount,
+		Sources:     len(res.Sources),
+		Succeeded:   len(res.Downloads),
+		Stale:       res.StaleCount(),
+		Failed:      len(res.Failed),
+		Duration:    time.Since(started).Round(time.Millisecond).Seconds(),
+		SourceRules: make(map[string]int, len(res.Stats)),
+	}
+	for _, st := range res.Stats {
+		entry.SourceRules[st.Name] = st.Kept()
+	}
+	entries = append(entries, entry)
+	if hc.MaxEntries > 0 && len(entries) > hc.MaxEntries {
+		entries = entries[len(entries)-hc.MaxEntries:]
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		// historyEntry 只包含时间、数字与字符串，编码不会失败
+		line, _ := json.Marshal(e)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(hc.File), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for '%s': %w", hc.File, err)
+	}
+	if err := fileutil.WriteAtomic(hc.File, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write history file '%s': %w", hc.File, err)
+	}
+
+	if hc.Chart != "" {
+		path := filepath.Join(cfg.Output.PublishDir, hc.Chart)
+		if err := fileutil.WriteAtomic(path, renderHistoryChart(entries)); err != nil {
+			return fmt.Errorf("failed to write history chart '%s': %w", path, err)
+		}
+		res.Extras = append(res.Extras, hc.Chart)
+	}
+	logging.Publisher.Debug("📉 Updated build history", "file", hc.File, "entries", len(entries))
+	return nil
+}
+
+// readHistory 读取历史文件，文件不存在时返回空历史。
+func readHistory(path string) ([]historyEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []historyEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e historyEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// 趋势图的尺寸与边距。
+const (
+	chartWidth  = 800
+	chartHeight = 260
+	chartLeft   = 80
+	chartRight  = 20
+	chartTop    = 36
+	chartBottom = 36
+)
+
+// renderHistoryChart 生成规则数随时间变化的折线图，比上一次构建减少 historyDropRatio 以上的点标为红色。
+func renderHistoryChart(entries []historyEntry) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/>` + "\n")
+	fmt.Fprintf(&b, `<text x="%d" y="20" font-size="14" font-weight="bold">Rules per build (last %d builds)</text>`+"\n", chartLeft, len(entries))
+	if len(entries) == 0 {
+		b.WriteString("</svg>\n")
+		return b.Bytes()
+	}
+
+	lo, hi := entries[0].Rules, entries[0].Rules
+	for _, e := range entries {
+		lo, hi = min(lo, e.Rules), max(hi, e.Rules)
+	}
+	pad := max((hi-lo)/20, 1)
+	lo, hi = max(lo-pad, 0), hi+pad
+	first, last := entries[0].Time, entries[len(entries)-1].Time
+	plotW := float64(chartWidth - chartLeft - chartRight)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	x := func(i int) float64 {
+		span := last.Sub(first)
+		if span <= 0 {
+			if len(entries) == 1 {
+				return float64(chartLeft) + plotW/2
+			}
+			return float64(chartLeft) + plotW*float64(i)/float64(len(entries)-1)
+		}
+		return float64(chartLeft) + plotW*float64(entries[i].Time.Sub(first))/float64(span)
+	}
+	y := func(v int) float64 {
+		return float64(chartTop) + plotH*(1-float64(v-lo)/float64(hi-lo))
+	}
+
+	// 横向网格线与纵轴刻度
+	for i := 0; i <= 4; i++ {
+		v := lo + (hi-lo)*i/4
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e5e5e5"/>`+"\n", chartLeft, y(v), chartWidth-chartRight, y(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" fill="#555">%s</text>`+"\n", chartLeft-6, y(v)+4, output.GroupDigits(v))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#555">%s</text>`+"\n", chartLeft, chartHeight-12, first.Format("2006-01-02"))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#555">%s</text>`+"\n", chartWidth-chartRight, chartHeight-12, last.Format("2006-01-02"))
+
+	points := make([]string, len(entries))
+	for i, e := range entries {
+		points[i] = fmt.Sprintf("%.1f,%.1f", x(i), y(e.Rules))
+	}
+	fmt.Fprintf(&b, `<polyline fill="none" stroke="#1f77b4" stroke-width="2" points="%s"/>`+"\n", strings.Join(points, " "))
+	for i := 1; i < len(entries); i++ {
+		prev, cur := entries[i-1].Rules, entries[i].Rules
+		if prev > 0 && float64(prev-cur) > float64(prev)*historyDropRatio {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="4" fill="#d62728"><title>%s: %s → %s rules</title></circle>`+"\n",
+				x(i), y(cur), entries[i].Time.Format("2006-01-02 15:04"), output.GroupDigits(prev), output.GroupDigits(cur))
+		}
+	}
+	e := entries[len(entries)-1]
+	fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="#1f77b4"><title>%s: %s rules</title></circle>`+"\n",
+		x(len(entries)-1), y(e.Rules), e.Time.Format("2006-01-02 15:04"), output.GroupDigits(e.Rules))
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,215 @@
+package compile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/source"
+	"adguardlist/internal/transform"
+)
+
+// 允许列表的处理方式。
+const (
+	allowlistRemove    = "remove"
+	allowlistException = "exception"
+)
+
+// allowlist 是最终输出中绝不能被屏蔽的域名及通配模式。
+type allowlist struct {
+	domains map[string]bool // 域名本身及其子域名都会放行
+	globs   []string        // 含 * 的模式，按 path.Match 匹配规则中的域名
+}
+
+// readOptionalLines 读取 file 中的非空、非注释行，文件不存在或 file 为空时返回 nil。
+func readOptionalLines(file string) ([]string, error) {
+	if file == "" {
+		return nil, nil
+	}
+	lines, err := source.ReadLines(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return lines, err
+}
+
+// loadAllowlist 读取允许列表文件。每行一个域名，也可以写作 "||domain^" 或 "*.domain"；
+// 包含其他 * 的行作为通配模式。文件不存在时返回 nil。
+func loadAllowlist(file string) (*allowlist, error) {
+	lines, err := readOptionalLines(file)
+	if err != nil || len(lines) == 0 {
+		return nil, err
+	}
+	a := &allowlist{domains: make(map[string]bool)}
+	for _, line := range lines {
+		entry := strings.TrimSuffix(strings.TrimPrefix(line, "||"), "^")
+		entry = strings.TrimPrefix(entry, "*.")
+		entry = strings.ToLower(strings.TrimSuffix(entry, "."))
+		if strings.Contains(entry, "*") {
+			if _, err := path.Match(entry, ""); err != nil {
+				return nil, fmt.Errorf("invalid allowlist pattern %q: %w", line, err)
+			}
+			a.globs = append(a.globs, entry)
+			continue
+		}
+		d, ok := transform.NormalizeHost(entry)
+		if !ok {
+			return nil, fmt.Errorf("invalid allowlist entry %q", line)
+		}
+		a.domains[d] = true
+	}
+	return a, nil
+}
+
+// matches 报告 domain 是否被允许列表放行。
+func (a *allowlist) matches(domain string) bool {
+	for d := domain; ; {
+		if a.domains[d] {
+			return true
+		}
+		i := strings.Index(d, ".")
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	for _, g := range a.globs {
+		if ok, _ := path.Match(g, domain); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply 从编译结果中去掉被放行域名的屏蔽规则，hosts 行中只去掉被放行的主机名。
+// exception 模式下为每个放行的域名追加 "@@||domain^$important" 例外规则；
+// remove 模式下当仍存在屏蔽其上级域名的规则，或无法解析出域名的屏蔽规则（通配符、正则等）
+// 可能匹配它时追加例外，保证这些域名不会被屏蔽。
+// 通配模式只用于删除规则。返回被删除规则的域名与追加的规则数。
+func (a *allowlist) apply(lines []string, mode string) (out []string, removed []string, added int) {
+	out = make([]string, 0, len(lines))
+	blocked := make(map[string]bool)
+	var patterns []*regexp.Regexp // 无法解析出域名的屏蔽规则
+	unknown := false              // 存在无法判断能匹配哪些域名的屏蔽规则
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || transform.IsComment(trimmed) {
+			out = append(out, line)
+			continue
+		}
+		r := transform.ParseAdblockRule(trimmed)
+		if r.Allow {
+			out = append(out, line)
+			continue
+		}
+		d, ok := r.Domain()
+		if !ok {
+			if hosts, isHosts := transform.ParseHostsLine(trimmed); isHosts {
+				kept := make([]string, 0, len(hosts))
+				for _, h := range hosts {
+					h = strings.ToLower(strings.TrimSuffix(h, "."))
+					if a.matches(h) {
+						removed = append(removed, h)
+						continue
+					}
+					blocked[h] = true
+					kept = append(kept, h)
+				}
+				if len(kept) == len(hosts) {
+					out = append(out, line)
+				} else if len(kept) > 0 {
+					out = append(out, strings.Fields(trimmed)[0]+" "+strings.Join(kept, " "))
+				}
+				continue
+			}
+			if re, err := patternRegexp(r.Pattern); err == nil {
+				patterns = append(patterns, re)
+			} else {
+				unknown = true
+			}
+			out = append(out, line)
+			continue
+		}
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if a.matches(d) {
+			removed = append(removed, d)
+			continue
+		}
+		blocked[d] = true
+		out = append(out, line)
+	}
+
+	domains := make([]string, 0, len(a.domains))
+	for d := range a.domains {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	for _, d := range domains {
+		if mode == allowlistException || unknown || transform.HasBlockedParent(d, blocked) || matchesAny(patterns, d) {
+			out = append(out, "@@||"+d+"^$important")
+			added++
+		}
+	}
+	return out, removed, added
+}
+
+// patternRegexp 将无法解析出域名的规则模式转换为匹配主机名的正则表达式，不区分大小写：
+// 正则规则原样使用；其余模式中 * 匹配任意字符，开头的 "||" 匹配域名或其子域名的开头，
+// 开头的 "|" 与 "|"、"^" 分别匹配主机名的开头与结尾（主机名中不会出现其他分隔符）。
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	if transform.IsRegexRule(pattern) {
+		return regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+	}
+	var b strings.Builder
+	b.WriteString("(?i)")
+	switch {
+	case strings.HasPrefix(pattern, "||"):
+		b.WriteString(`(^|\.)`)
+		pattern = pattern[2:]
+	case strings.HasPrefix(pattern, "|"):
+		b.WriteString("^")
+		pattern = pattern[1:]
+	}
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '^', '|':
+			b.WriteString("$")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return regexp.Compile(b.String())
+}
+
+// matchesAny 报告 patterns 中是否有正则表达式匹配 domain。
+func matchesAny(patterns []*regexp.Regexp, domain string) bool {
+	for _, re := range patterns {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAllowlist 将 cfg.AllowlistFile 应用到编译结果，文件不存在时原样返回。
+// 返回被删除规则的域名，用于冲突报告。
+func applyAllowlist(cfg *Config, content []byte) ([]byte, []string, error) {
+	a, err := loadAllowlist(cfg.AllowlistFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read allowlist '%s': %w", cfg.AllowlistFile, err)
+	}
+	if a == nil {
+		return content, nil, nil
+	}
+	lines, removed, added := a.apply(transform.SplitLines(content), cfg.AllowlistMode)
+	logging.Compiler.Info("✅ Applied allowlist", "removed", len(removed), "exceptions", added)
+	return transform.JoinLines(lines, bytes.HasSuffix(content, []byte("\n"))), removed, nil
+}
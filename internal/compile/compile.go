@@ -0,0 +1,380 @@
+// Package compile 将下载的规则源合并为一份列表：跨源去重、冲突处理、语法校验，
+// 以及排除、追加、允许列表、关键域名保护、失效域名清理与规则数上限等编译后的处理。
+package compile
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/transform"
+)
+
+// Config 控制规则的合并与编译后的处理：冲突策略、语法校验、排除与追加的规则、允许列表、
+// 关键域名保护、失效域名清理以及规则数上限。
+type Config struct {
+	transform.Config      `yaml:",inline"`
+	EmitUnicodeIDN        bool              `yaml:"emit_unicode_idn"`
+	ExclusionsFile        string            `yaml:"exclusions_file"`
+	ExtraRulesFile        string            `yaml:"extra_rules_file"`
+	AllowlistFile         string            `yaml:"allowlist_file"`
+	AllowlistMode         string            `yaml:"allowlist_mode"`
+	CriticalDomainsFile   string            `yaml:"critical_domains_file"`
+	CriticalDomainsPolicy string            `yaml:"critical_domains_policy"`
+	ConflictPolicy        string            `yaml:"conflict_policy"`
+	ValidateRules         bool              `yaml:"validate_rules"`
+	DeadDomains           DeadDomainsConfig `yaml:"dead_domains"`
+	MaxRules              int               `yaml:"max_rules"`
+	SortRules             bool              `yaml:"sort_rules"`
+}
+
+// DefaultConfig 返回编译的默认配置。
+func DefaultConfig() Config {
+	return Config{
+		Config:                transform.DefaultConfig(),
+		ExclusionsFile:        "setting/exclusions.txt",
+		ExtraRulesFile:        "setting/extra_rules.txt",
+		AllowlistFile:         "setting/allowlist.txt",
+		AllowlistMode:         allowlistRemove,
+		CriticalDomainsFile:   "setting/critical_domains.txt",
+		CriticalDomainsPolicy: criticalStrip,
+		ConflictPolicy:        conflictAllowWins,
+		ValidateRules:         true,
+		DeadDomains: DeadDomainsConfig{
+			QPS:       50,
+			Workers:   16,
+			Timeout:   5 * time.Second,
+			Threshold: 3,
+			StateFile: ".cache/dead_domains.json",
+		},
+	}
+}
+
+// Check 检查编译配置中的取值是否合法。
+func (c *Config) Check() error {
+	if err := c.Config.Check(); err != nil {
+		return err
+	}
+	if c.MaxRules < 0 {
+		return fmt.Errorf("max_rules must not be negative")
+	}
+	if c.AllowlistMode != allowlistRemove && c.AllowlistMode != allowlistException {
+		return fmt.Errorf("allowlist_mode must be %q or %q, got %q", allowlistRemove, allowlistException, c.AllowlistMode)
+	}
+	if c.CriticalDomainsPolicy != criticalStrip && c.CriticalDomainsPolicy != criticalFail {
+		return fmt.Errorf("critical_domains_policy must be %q or %q, got %q", criticalStrip, criticalFail, c.CriticalDomainsPolicy)
+	}
+	switch c.ConflictPolicy {
+	case conflictAllowWins, conflictBlockWins, conflictKeepBoth:
+	default:
+		return fmt.Errorf("conflict_policy must be %q, %q or %q, got %q", conflictAllowWins, conflictBlockWins, conflictKeepBoth, c.ConflictPolicy)
+	}
+	if dd := c.DeadDomains; dd.Enabled {
+		if dd.Workers <= 0 || dd.Threshold <= 0 || dd.Timeout <= 0 || dd.QPS < 0 || dd.MaxChecks < 0 {
+			return fmt.Errorf("dead_domains: workers, threshold and timeout must be positive, qps and max_checks must not be negative")
+		}
+		if dd.StateFile == "" {
+			return fmt.Errorf("dead_domains.state_file must not be empty")
+		}
+		if _, err := download.NewResolver(dd.Resolver); err != nil {
+			return fmt.Errorf("dead_domains: %w", err)
+		}
+	}
+	return nil
+}
+
+// Collect 指定编译时额外收集的信息，由需要它们的输出决定。
+type Collect struct {
+	IPTargets   bool // 收集 IP 规则针对的地址，见 Result.IPTargets
+	RuleSources bool // 记录每条规则的来源，见 Result.RuleSources
+	Categories  bool // 记录每条规则的分类，见 Result.RuleCategories
+}
+
+// SourceStats 记录单个源在编译过程中的行数统计。
+type SourceStats struct {
+	Name       string
+	Format     string // 实际使用的源格式（auto 时为识别结果）
+	Lines      int    // 应用该源自身的转换后的行数
+	Bytes      int    // 下载（解压后）的字节数
+	Rules      int    // 其中的规则行数（不含注释与空行）
+	Unique     int    // 没有出现在其他任何源中的规则数
+	Duplicates int    // 与前面的源相同（规范化及修饰符排序后）、在合并前被去除的规则行数
+	Repeated   int    // 在该源中已经出现过、在合并前被去除的规则行数，不计入 Duplicates
+	Rejected   int    // 语法校验未通过、在合并前被去除的规则行数
+	ipRules    int    // 由 RemoveIpRules 去除的 IP 地址规则行数
+	regexRules int    // 由 RemoveRegexRules 去除的正则规则行数
+}
+
+// Result 是编译的输出。
+type Result struct {
+	Content   []byte
+	Stats     []SourceStats
+	origins   *ruleOrigins
+	Conflicts []Conflict
+	Rejected  []RejectedRule
+	IPTargets []string // 源中 IP 地址与网段屏蔽规则针对的地址，仅在配置了 ipset/nftables 输出时收集
+	// RuleSources 记录每条规则（按输出中的形式的 transform.DedupeKey）最早来自 downloads 中的第几个源，
+	// 仅在设置了 max_rules 或配置了需要规则来源的输出时记录
+	RuleSources map[string]int
+	// Categories 是源中出现的分类（已排序），RuleCategories 记录每条规则（按输出中的形式的 transform.DedupeKey）
+	// 所在的全部源的分类掩码，第 i 位对应 Categories[i]；仅在源设置了分类时记录
+	Categories     []string
+	RuleCategories map[string]uint64
+	// MergeTime 与 CompileTime 是 merge（逐源转换与去重）与 compile（冲突处理与全局转换）两个阶段的耗时
+	MergeTime   time.Duration
+	CompileTime time.Duration
+	// Dead、Excluded 与 Truncated 由 Refine 记录：作为失效域名删除、被 exclusions 删除
+	// 以及因超过 max_rules 被截断的规则数
+	Dead      int
+	Excluded  int
+	Truncated int
+}
+
+// Compile 先将每个源转换为 adblock 语法并应用其自身的转换，规范化域名规则的主机名，
+// 去除语法无效（cfg.ValidateRules）以及与前面的源相同的规则行后合并，按 cfg.ConflictPolicy 处理屏蔽与例外的冲突，
+// 再对合并结果应用全局转换。
+func Compile(cfg *Config, downloads []download.Result, collect Collect) *Result {
+	start := time.Now()
+	transformations := cfg.Transformations
+	var merged []string
+	// owners 记录每条规则（按输出中的形式的 transform.DedupeKey）所在的源：downloads 中的下标加 1，出现在多个源中时为 -1
+	owners := make(map[string]int32)
+	rejected := make(map[string]bool) // 语法校验未通过的规则，不计入任何源的 Unique
+	unicodeForms := make(map[string]string)
+	allowIP := slices.Contains(transformations, transform.TrValidateAllowIP)
+	removeMods := slices.Contains(transformations, transform.TrRemoveModifiers)
+	collectIPs := collect.IPTargets
+	seenIPs := make(map[string]bool)
+	res := &Result{Stats: make([]SourceStats, 0, len(downloads)), origins: newRuleOrigins()}
+	if cfg.MaxRules > 0 || collect.RuleSources {
+		res.RuleSources = make(map[string]int)
+	}
+	var categoryMasks []uint64
+	if collect.Categories {
+		if res.Categories, categoryMasks = sourceCategoryMasks(downloads); res.Categories != nil {
+			res.RuleCategories = make(map[string]uint64)
+		}
+	}
+	for idx, d := range downloads {
+		lines, format := transform.ConvertSource(d.Source.Format, d.Content, cfg.StripLocalhost)
+		lines = transform.Apply(lines, d.Source.Transformations, &cfg.Config)
+		st := SourceStats{Name: d.Source.Name, Format: format, Lines: len(lines), Bytes: len(d.Content)}
+		dropIP := slices.Contains(transformations, transform.TrRemoveIPRules) || slices.Contains(d.Source.Transformations, transform.TrRemoveIPRules)
+		dropRegex := slices.Contains(transformations, transform.TrRemoveRegexRules) || slices.Contains(d.Source.Transformations, transform.TrRemoveRegexRules)
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || transform.IsComment(trimmed) {
+				merged = append(merged, line)
+				continue
+			}
+			st.Rules++
+			normalized, unicode := transform.NormalizeRule(trimmed)
+			if collectIPs && !strings.HasPrefix(normalized, "@@") {
+				if ip, ok := transform.IPRuleTarget(normalized); ok && !seenIPs[ip] {
+					seenIPs[ip] = true
+					res.IPTargets = append(res.IPTargets, ip)
+				}
+			}
+			if dropIP && transform.IsIPRule(normalized) {
+				st.ipRules++
+				continue
+			}
+			if dropRegex && transform.IsRegexRule(transform.ParseAdblockRule(normalized).Pattern) {
+				st.regexRules++
+				continue
+			}
+			// 去重、来源与分类均按规则经过全局转换后在输出中的形式记录，见 transform.GlobalForms
+			outKeys := outputKeys(normalized, transformations)
+			attrKeys := outKeys
+			if unicode != "" && cfg.EmitUnicodeIDN {
+				// 插入在 punycode 规则之后的 Unicode 形式与之同源，见 insertUnicodeForms
+				attrKeys = append(slices.Clip(outKeys), transform.DedupeKey(unicode))
+			}
+			if res.RuleCategories != nil {
+				for _, k := range attrKeys {
+					res.RuleCategories[k] |= categoryMasks[idx]
+				}
+			}
+			if dup, repeated := claimOwners(owners, outKeys, int32(idx+1)); dup {
+				if !rejected[outKeys[0]] {
+					// 冲突检测需要知道规则出现在哪些源中，重复的规则同样记录来源
+					res.origins.add(normalized, d.Source.Name)
+				}
+				if repeated {
+					st.Repeated++
+				} else {
+					st.Duplicates++
+				}
+				continue
+			}
+			if cfg.ValidateRules {
+				// 按应用全局转换后的形式校验，RemoveModifiers 会去掉的修饰符不导致拒绝
+				checked := normalized
+				if removeMods {
+					checked = transform.RemoveModifiers([]string{normalized})[0]
+				}
+				if reason := transform.RuleRejection(checked, allowIP); reason != "" {
+					res.Rejected = append(res.Rejected, RejectedRule{Source: d.Source.Name, Line: i + 1, Rule: trimmed, Reason: reason})
+					st.Rejected++
+					for _, k := range outKeys {
+						rejected[k] = true
+					}
+					continue
+				}
+			}
+			res.origins.add(normalized, d.Source.Name)
+			if res.RuleSources != nil {
+				for _, k := range attrKeys {
+					if _, ok := res.RuleSources[k]; !ok {
+						res.RuleSources[k] = idx
+					}
+				}
+			}
+			merged = append(merged, normalized)
+			if unicode != "" && cfg.EmitUnicodeIDN {
+				unicodeForms[normalized] = unicode
+			}
+		}
+		res.Stats = append(res.Stats, st)
+	}
+	for key, owner := range owners {
+		if owner > 0 && !rejected[key] {
+			res.Stats[owner-1].Unique++
+		}
+	}
+	res.MergeTime = time.Since(start)
+	start = time.Now()
+	res.Conflicts = res.origins.conflicts(cfg.ConflictPolicy)
+	merged = resolveConflicts(merged, res.Conflicts, cfg.ConflictPolicy)
+	global := transformations
+	if cfg.ValidateRules {
+		// 合并前已逐行校验，之后的转换只会删除或简化规则，无需再次校验
+		global = transform.RemoveStrings(global, transform.TrValidate, transform.TrValidateAllowIP)
+	}
+	merged = transform.Apply(merged, global, &cfg.Config)
+	if len(unicodeForms) > 0 {
+		merged = insertUnicodeForms(merged, unicodeForms)
+	}
+
+	res.Content = transform.JoinLines(merged, slices.Contains(transformations, transform.TrInsertFinalNewLine))
+	res.CompileTime = time.Since(start)
+	return res
+}
+
+// Refine 对编译结果依次删除失效域名、应用 exclusions、追加额外规则、应用允许列表、保护关键域名，
+// 再按 max_rules 截断并按需排序，结果写回 res.Content；允许列表产生的冲突追加到 res.Conflicts。
+func Refine(ctx context.Context, cfg *Config, res *Result, downloads []download.Result) error {
+	content := res.Content
+	var err error
+	if content, res.Dead, err = removeDeadDomains(ctx, cfg, content); err != nil {
+		return err
+	}
+	if content, res.Excluded, err = applyExclusions(cfg, content); err != nil {
+		return err
+	}
+	if content, err = appendExtraRules(cfg, content); err != nil {
+		return err
+	}
+	var allowlisted []string
+	if content, allowlisted, err = applyAllowlist(cfg, content); err != nil {
+		return err
+	}
+	if content, err = protectCriticalDomains(cfg, content); err != nil {
+		return err
+	}
+	content, res.Truncated = capRules(cfg, content, downloads, res.RuleSources)
+	if cfg.SortRules {
+		content = sortRules(content)
+	}
+	res.Content = content
+	res.Conflicts = append(res.Conflicts, res.origins.allowlistConflicts(allowlisted)...)
+	return nil
+}
+
+// outputKeys 返回规则 rule 经过全局转换 transformations 后在输出中的各条规则的 transform.DedupeKey。
+func outputKeys(rule string, transformations []string) []string {
+	forms := transform.GlobalForms(rule, transformations)
+	for i, f := range forms {
+		forms[i] = transform.DedupeKey(f)
+	}
+	return forms
+}
+
+// claimOwners 将 keys 中尚未出现过的规则记为源 owner 所有，已被其他源占有的规则标记为 -1。
+// 全部 keys 均已出现过时 dup 为 true，此时若它们都只来自 owner 本身则 repeated 为 true。
+func claimOwners(owners map[string]int32, keys []string, owner int32) (dup, repeated bool) {
+	dup, repeated = true, true
+	for _, k := range keys {
+		prev, ok := owners[k]
+		switch {
+		case !ok:
+			owners[k] = owner
+			dup = false
+		case prev != owner:
+			owners[k] = -1
+			repeated = false
+		}
+	}
+	return dup, dup && repeated
+}
+
+// insertUnicodeForms 在经过全局转换后仍保留的 punycode 规则之后插入其 Unicode 形式。
+// 放在转换之后执行，避免 Unicode 规则被 Validate 等转换去掉。
+func insertUnicodeForms(lines []string, forms map[string]string) []string {
+	out := make([]string, 0, len(lines)+len(forms))
+	for _, line := range lines {
+		out = append(out, line)
+		if u, ok := forms[strings.TrimSpace(line)]; ok {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// sortRules 按规则排序并去掉注释与空行，使输入不变时输出逐字节相同，便于比较差异。
+// 排序时忽略例外规则的 "@@" 前缀，同一域名的屏蔽与例外规则相邻。
+func sortRules(content []byte) []byte {
+	lines := transform.FilterLines(transform.SplitLines(content), func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		return trimmed != "" && !transform.IsComment(trimmed)
+	})
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		a, b := strings.TrimPrefix(lines[i], "@@"), strings.TrimPrefix(lines[j], "@@")
+		if a != b {
+			return a < b
+		}
+		return lines[i] < lines[j]
+	})
+	return transform.JoinLines(lines, len(content) > 0 && content[len(content)-1] == '\n')
+}
+
+// sourceCategoryMasks 返回 downloads 中出现的分类（按名称排序）以及每个源的分类掩码，
+// 没有源设置分类时返回 nil。
+func sourceCategoryMasks(downloads []download.Result) ([]string, []uint64) {
+	var names []string
+	for _, d := range downloads {
+		for _, c := range d.Source.Categories {
+			if !slices.Contains(names, c) {
+				names = append(names, c)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+	masks := make([]uint64, len(downloads))
+	for i, d := range downloads {
+		for _, c := range d.Source.Categories {
+			masks[i] |= 1 << sort.SearchStrings(names, c)
+		}
+	}
+	return names, masks
+}
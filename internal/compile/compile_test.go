@@ -0,0 +1,353 @@
+package compile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/source"
+	"adguardlist/internal/transform"
+)
+
+// testConfig 返回不读取任何设置文件、只做去重的编译配置。
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Transformations = []string{"RemoveComments", "Deduplicate", transform.TrInsertFinalNewLine}
+	cfg.ExclusionsFile, cfg.ExtraRulesFile, cfg.AllowlistFile, cfg.CriticalDomainsFile = "", "", "", ""
+	return cfg
+}
+
+// testDownloads 将 contents 依次作为名为 A、B、C… 的 adblock 格式源。
+func testDownloads(contents ...string) []download.Result {
+	downloads := make([]download.Result, len(contents))
+	for i, c := range contents {
+		name := string(rune('A' + i))
+		downloads[i] = download.Result{
+			Source:  source.Source{Name: name, URL: "https://example.com/" + name, Format: transform.FormatAdblock},
+			Content: []byte(c),
+		}
+	}
+	return downloads
+}
+
+// writeTestFile 在临时目录中写入 name 并返回其路径。
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompileDedupe(t *testing.T) {
+	cfg := testConfig()
+	downloads := testDownloads(
+		"! Title: A\n||a.com^\n||b.com^\n||a.com^\nexample.com##.banner\n",
+		"||b.com^$important\n||B.com^\n||c.com^$client=x,important\n||c.com^$important,client=x\n",
+	)
+	res := Compile(&cfg, downloads, Collect{})
+
+	want := "||a.com^\n||b.com^\n||b.com^$important\n||c.com^$client=x,important\n"
+	if got := string(res.Content); got != want {
+		t.Errorf("Content = %q, want %q", got, want)
+	}
+	wantStats := []SourceStats{
+		{Name: "A", Format: transform.FormatAdblock, Lines: 5, Bytes: len(downloads[0].Content), Rules: 4, Unique: 1, Repeated: 1, Rejected: 1},
+		{Name: "B", Format: transform.FormatAdblock, Lines: 4, Bytes: len(downloads[1].Content), Rules: 4, Unique: 2, Duplicates: 1, Repeated: 1},
+	}
+	for i, st := range res.Stats {
+		if st != wantStats[i] {
+			t.Errorf("Stats[%d] = %+v, want %+v", i, st, wantStats[i])
+		}
+	}
+	if len(res.Rejected) != 1 || res.Rejected[0].Source != "A" || res.Rejected[0].Line != 5 {
+		t.Errorf("Rejected = %+v, want the cosmetic rule on line 5 of A", res.Rejected)
+	}
+}
+
+// 默认的全局转换下，来自下载源的每条输出规则（包括插入的 Unicode 形式）都能查到来源。
+func TestCompileRuleSourcesCoverOutput(t *testing.T) {
+	cfg := testConfig()
+	cfg.Transformations = DefaultConfig().Transformations
+	cfg.EmitUnicodeIDN = true
+	downloads := testDownloads(
+		"! Title: A\nplain.example.com\n0.0.0.0 hosts.example.org hosts.example.net\n||xn--mnchen-3ya.de^\n",
+		"||mod.example.com^$third-party\n@@||allow.example.org^\n||sub.hosts.example.org^\n",
+	)
+	res := Compile(&cfg, downloads, Collect{RuleSources: true})
+
+	rules := 0
+	for _, rule := range transform.SplitLines(res.Content) {
+		if rule = strings.TrimSpace(rule); rule == "" || transform.IsComment(rule) {
+			continue
+		}
+		rules++
+		if _, ok := res.RuleSources[transform.DedupeKey(rule)]; !ok {
+			t.Errorf("RuleSources has no source for output rule %q", rule)
+		}
+	}
+	if rules < 6 {
+		t.Errorf("Content = %q, want at least 6 rules", res.Content)
+	}
+}
+
+// 同一域名在一个源中是纯域名或 hosts 行、在另一个源中是 "||domain^" 时，按 Compress 之后的形式去重。
+func TestCompileDedupeRewrittenRules(t *testing.T) {
+	cfg := testConfig()
+	cfg.Transformations = []string{"RemoveComments", "Compress", "Deduplicate", transform.TrInsertFinalNewLine}
+	downloads := testDownloads(
+		"example.com\n0.0.0.0 hosts.example.org only-a.example.net\n",
+		"||example.com^\n||hosts.example.org^\n||only-b.example.net^\n",
+	)
+	res := Compile(&cfg, downloads, Collect{})
+
+	want := "||example.com^\n||hosts.example.org^\n||only-a.example.net^\n||only-b.example.net^\n"
+	if got := string(res.Content); got != want {
+		t.Errorf("Content = %q, want %q", got, want)
+	}
+	wantStats := []SourceStats{
+		{Name: "A", Format: transform.FormatAdblock, Lines: 2, Bytes: len(downloads[0].Content), Rules: 2, Unique: 1},
+		{Name: "B", Format: transform.FormatAdblock, Lines: 3, Bytes: len(downloads[1].Content), Rules: 3, Unique: 1, Duplicates: 2},
+	}
+	for i, st := range res.Stats {
+		if st != wantStats[i] {
+			t.Errorf("Stats[%d] = %+v, want %+v", i, st, wantStats[i])
+		}
+	}
+}
+
+// 只有屏蔽与放行来自不同的源时才算冲突；某个源中重复出现的规则同样参与冲突检测。
+func TestCompileConflicts(t *testing.T) {
+	cfg := testConfig()
+	downloads := testDownloads(
+		"||same.com^\n@@||same.com^\n||cross.com^\n||dup.com^\n@@||dup.com^\n",
+		"@@||cross.com^\n||dup.com^\n||other.com^\n",
+	)
+	res := Compile(&cfg, downloads, Collect{})
+
+	want := "||same.com^\n@@||same.com^\n@@||dup.com^\n@@||cross.com^\n||other.com^\n"
+	if got := string(res.Content); got != want {
+		t.Errorf("Content = %q, want %q", got, want)
+	}
+	wantConflicts := []Conflict{
+		{Domain: "cross.com", BlockedBy: "A", AllowedBy: "B", Resolution: conflictAllowWins},
+		{Domain: "dup.com", BlockedBy: "B", AllowedBy: "A", Resolution: conflictAllowWins},
+	}
+	if !slices.Equal(res.Conflicts, wantConflicts) {
+		t.Errorf("Conflicts = %+v, want %+v", res.Conflicts, wantConflicts)
+	}
+}
+
+func TestRefine(t *testing.T) {
+	tests := []struct {
+		name          string
+		sources       []string
+		setup         func(t *testing.T, cfg *Config)
+		want          string
+		wantExcluded  int
+		wantTruncated int
+	}{
+		{
+			name:    "exclusions remove matching rules",
+			sources: []string{"||ads.example.com^\n||tracker.example.org^\n||tracker.example.net^$important\n||keep.example.com^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.ExclusionsFile = writeTestFile(t, "exclusions.txt", "# comment\n||tracker.*^\n/\\$important$/\n")
+			},
+			want:         "||ads.example.com^\n||keep.example.com^\n",
+			wantExcluded: 2,
+		},
+		{
+			name:    "extra rules are validated and appended once",
+			sources: []string{"||ads.example.com^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.ExtraRulesFile = writeTestFile(t, "extra_rules.txt", "||extra.example.com^\n||ads.example.com^\nexample.com##.banner\n")
+			},
+			want: "||ads.example.com^\n||extra.example.com^\n",
+		},
+		{
+			name:    "allowlist removes rules and adds exceptions under blocked parents",
+			sources: []string{"||example.com^\n||cdn.example.com^\n||good.example.org^\n||ads.good.example.org^\n||other.example.net^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.AllowlistFile = writeTestFile(t, "allowlist.txt", "cdn.example.com\n||good.example.org^\n")
+			},
+			want: "||example.com^\n||other.example.net^\n@@||cdn.example.com^$important\n",
+		},
+		{
+			name:    "allowlist adds exceptions for rules that cannot be removed",
+			sources: []string{"||bank*^\n/^track[0-9]+\\./\n0.0.0.0 good.example.org other.example.net\n||keep.example.com^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.AllowlistFile = writeTestFile(t, "allowlist.txt", "bank.example.com\ntrack1.example.com\ngood.example.org\nkeep.example.org\n")
+			},
+			want: "||bank*^\n/^track[0-9]+\\./\n0.0.0.0 other.example.net\n||keep.example.com^\n@@||bank.example.com^$important\n@@||track1.example.com^$important\n",
+		},
+		{
+			name:    "allowlist in exception mode always adds exceptions",
+			sources: []string{"||ads.example.com^\n||cdn.example.com^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.AllowlistFile = writeTestFile(t, "allowlist.txt", "cdn.example.com\n")
+				cfg.AllowlistMode = allowlistException
+			},
+			want: "||ads.example.com^\n@@||cdn.example.com^$important\n",
+		},
+		{
+			name:    "max_rules truncates the lowest priority source from the end",
+			sources: []string{"||a1.com^\n||a2.com^\n||a3.com^\n", "||b1.com^\n||b2.com^\n||b3.com^\n", "||c1.com^\n||c2.com^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.MaxRules = 5
+			},
+			want:          "||a1.com^\n||a2.com^\n||a3.com^\n||b1.com^\n||b2.com^\n",
+			wantTruncated: 3,
+		},
+		{
+			name:    "max_rules keeps rules that cannot be attributed to a source",
+			sources: []string{"||a1.com^\n||a2.com^\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.MaxRules = 1
+				cfg.ExtraRulesFile = writeTestFile(t, "extra_rules.txt", "||extra.com^\n")
+			},
+			want:          "||extra.com^\n",
+			wantTruncated: 2,
+		},
+		{
+			name:    "max_rules truncates source rules rewritten by Compress",
+			sources: []string{"||a1.com^\n", "b1.com\n0.0.0.0 b2.com\n"},
+			setup: func(t *testing.T, cfg *Config) {
+				cfg.Transformations = []string{"RemoveComments", "Compress", "Deduplicate", transform.TrInsertFinalNewLine}
+				cfg.MaxRules = 2
+				cfg.ExtraRulesFile = writeTestFile(t, "extra_rules.txt", "||extra.com^\n")
+			},
+			want:          "||a1.com^\n||extra.com^\n",
+			wantTruncated: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.setup(t, &cfg)
+			downloads := testDownloads(tt.sources...)
+			if len(downloads) == 3 {
+				// A 的优先级最高；B 与 C 相同时排在后面的 C 先被截断
+				downloads[0].Source.Priority = 10
+			}
+			res := Compile(&cfg, downloads, Collect{})
+			if err := Refine(context.Background(), &cfg, res, downloads); err != nil {
+				t.Fatalf("Refine() error = %v", err)
+			}
+			if got := string(res.Content); got != tt.want {
+				t.Errorf("Content = %q, want %q", got, tt.want)
+			}
+			if res.Excluded != tt.wantExcluded || res.Truncated != tt.wantTruncated {
+				t.Errorf("Excluded, Truncated = %d, %d, want %d, %d", res.Excluded, res.Truncated, tt.wantExcluded, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestCompileAttributesRewrittenRules(t *testing.T) {
+	cfg := testConfig()
+	cfg.Transformations = []string{"RemoveComments", transform.TrRemoveModifiers, "Compress", "Deduplicate", transform.TrInsertFinalNewLine}
+	downloads := testDownloads(
+		"plain-ads.com\n0.0.0.0 hostsads.com hostsads.net\n||mod-ads.com^$third-party\n",
+		"||bad.example^\n",
+	)
+	downloads[0].Source.Categories = []string{"ads"}
+	downloads[1].Source.Categories = []string{"malware"}
+	res := Compile(&cfg, downloads, Collect{RuleSources: true, Categories: true})
+
+	want := "||plain-ads.com^\n||hostsads.com^\n||hostsads.net^\n||mod-ads.com^\n||bad.example^\n"
+	if got := string(res.Content); got != want {
+		t.Fatalf("Content = %q, want %q", got, want)
+	}
+	wantSources := map[string]int{"||plain-ads.com^": 0, "||hostsads.com^": 0, "||hostsads.net^": 0, "||mod-ads.com^": 0, "||bad.example^": 1}
+	for _, rule := range transform.SplitLines(res.Content) {
+		if rule == "" {
+			continue
+		}
+		key := transform.DedupeKey(rule)
+		if idx, ok := res.RuleSources[key]; !ok || idx != wantSources[rule] {
+			t.Errorf("RuleSources[%q] = %d, %v, want %d", rule, idx, ok, wantSources[rule])
+		}
+		wantMask := uint64(1) << wantSources[rule] // Categories 按名称排序：ads、malware
+		if mask, ok := res.RuleCategories[key]; !ok || mask != wantMask {
+			t.Errorf("RuleCategories[%q] = %b, %v, want %b", rule, mask, ok, wantMask)
+		}
+	}
+}
+
+func TestProtectCriticalDomains(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "exact rule is removed",
+			content: "||www.google.com^\n||ads.example.com^\n",
+			policy:  criticalStrip,
+			want:    "||ads.example.com^\n",
+		},
+		{
+			name:    "hosts line keeps its other hosts",
+			content: "0.0.0.0 ads.example.com windowsupdate.com\n",
+			policy:  criticalStrip,
+			want:    "0.0.0.0 ads.example.com\n",
+		},
+		{
+			name:    "leading wildcard adds an exception",
+			content: "||*.google.com^\n",
+			policy:  criticalStrip,
+			want:    "||*.google.com^\n@@||www.google.com^$important\n",
+		},
+		{
+			name:    "trailing wildcard adds an exception",
+			content: "||www.goo*^\n",
+			policy:  criticalStrip,
+			want:    "||www.goo*^\n@@||www.google.com^$important\n",
+		},
+		{
+			name:    "regex rules match case-insensitively",
+			content: "/GOOGLE/\n",
+			policy:  criticalStrip,
+			want:    "/GOOGLE/\n@@||www.google.com^$important\n",
+		},
+		{
+			name:    "parent domain adds an exception",
+			content: "||google.com^\n",
+			policy:  criticalStrip,
+			want:    "||google.com^\n@@||www.google.com^$important\n",
+		},
+		{
+			name:    "unrelated wildcard is kept",
+			content: "||*.example.com^\n",
+			policy:  criticalFail,
+			want:    "||*.example.com^\n",
+		},
+		{
+			name:    "wildcard fails the build",
+			content: "||*.google.com^\n",
+			policy:  criticalFail,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CriticalDomainsFile = writeTestFile(t, "critical_domains.txt", "www.google.com\nwindowsupdate.com\n")
+			cfg.CriticalDomainsPolicy = tt.policy
+			got, err := protectCriticalDomains(&cfg, []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("protectCriticalDomains() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("protectCriticalDomains() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package compile
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"adguardlist/internal/transform"
+)
+
+// 屏蔽规则与例外规则冲突时的处理策略。
+const (
+	conflictAllowWins = "allow"
+	conflictBlockWins = "block"
+	conflictKeepBoth  = "keep"
+)
+
+// allowlistOrigin 是允许列表在冲突报告中的来源名称。
+const allowlistOrigin = "allowlist"
+
+// Conflict 是同一域名既被屏蔽又被放行的情况。
+type Conflict struct {
+	Domain     string
+	BlockedBy  string
+	AllowedBy  string
+	Resolution string
+}
+
+// ruleOrigins 按出现顺序记录不带修饰符的域名规则出现在哪些源中，用于检测冲突。
+type ruleOrigins struct {
+	blocked map[string][]string
+	allowed map[string][]string
+}
+
+func newRuleOrigins() *ruleOrigins {
+	return &ruleOrigins{blocked: make(map[string][]string), allowed: make(map[string][]string)}
+}
+
+// add 记录 rule 的来源，只统计 "||domain^" 与 "@@||domain^" 这类不带修饰符的规则。
+func (o *ruleOrigins) add(rule, source string) {
+	r := transform.ParseAdblockRule(rule)
+	if len(r.Modifiers) > 0 {
+		return
+	}
+	d, ok := r.Domain()
+	if !ok {
+		return
+	}
+	m := o.blocked
+	if r.Allow {
+		m = o.allowed
+	}
+	if !slices.Contains(m[d], source) {
+		m[d] = append(m[d], source)
+	}
+}
+
+// conflicts 返回按域名排序的冲突列表。只有屏蔽与放行来自不同的源时才算冲突，
+// 同一个源中的例外规则是该源有意为之，不报告也不处理；BlockedBy 与 AllowedBy 是最早的一对不同的源。
+func (o *ruleOrigins) conflicts(policy string) []Conflict {
+	var out []Conflict
+	for d, allowedBy := range o.allowed {
+		if blockedBy, allowed, ok := differentSources(o.blocked[d], allowedBy); ok {
+			out = append(out, Conflict{Domain: d, BlockedBy: blockedBy, AllowedBy: allowed, Resolution: policy})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
+
+// differentSources 返回 blocked 与 allowed 中最早的一对不同的源。
+func differentSources(blocked, allowed []string) (string, string, bool) {
+	for _, b := range blocked {
+		for _, a := range allowed {
+			if a != b {
+				return b, a, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// allowlistConflicts 将被允许列表删除的规则转换为冲突记录。
+func (o *ruleOrigins) allowlistConflicts(domains []string) []Conflict {
+	out := make([]Conflict, 0, len(domains))
+	for _, d := range domains {
+		blockedBy := "-"
+		if sources := o.blocked[d]; len(sources) > 0 {
+			blockedBy = sources[0]
+		}
+		out = append(out, Conflict{Domain: d, BlockedBy: blockedBy, AllowedBy: allowlistOrigin, Resolution: conflictAllowWins})
+	}
+	return out
+}
+
+// resolveConflicts 按策略处理冲突：allow 删除屏蔽规则，block 删除例外规则，keep 保留两者
+// （AdGuard Home 中例外规则优先，效果与 allow 相同，只是文件更大）。
+func resolveConflicts(lines []string, conflicts []Conflict, policy string) []string {
+	if len(conflicts) == 0 || policy == conflictKeepBoth {
+		return lines
+	}
+	domains := make(map[string]bool, len(conflicts))
+	for _, c := range conflicts {
+		domains[c.Domain] = true
+	}
+	dropAllow := policy == conflictBlockWins
+	return transform.FilterLines(lines, func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || transform.IsComment(trimmed) {
+			return true
+		}
+		r := transform.ParseAdblockRule(trimmed)
+		if len(r.Modifiers) > 0 || r.Allow != dropAllow {
+			return true
+		}
+		d, ok := r.Domain()
+		return !ok || !domains[d]
+	})
+}
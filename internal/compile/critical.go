@@ -0,0 +1,165 @@
+package compile
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// 编译结果屏蔽了关键域名时的处理方式。
+const (
+	criticalStrip = "strip"
+	criticalFail  = "fail"
+)
+
+// loadCriticalDomains 读取关键域名列表，文件不存在时返回 nil。
+func loadCriticalDomains(file string) ([]string, error) {
+	lines, err := readOptionalLines(file)
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]string, 0, len(lines))
+	for _, line := range lines {
+		entry := strings.TrimSuffix(strings.TrimPrefix(line, "||"), "^")
+		d, ok := transform.NormalizeHost(entry)
+		if !ok {
+			return nil, fmt.Errorf("invalid critical domain %q", line)
+		}
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+// blockingRules 返回屏蔽了 domain 的规则：域名规则本身或其上级域名的规则，
+// 以及匹配该域名的通配符与正则规则。
+func blockingRules(domain string, blocked map[string]string, regexps map[string]*regexp.Regexp) []string {
+	var rules []string
+	for d := domain; ; {
+		if rule, ok := blocked[d]; ok {
+			rules = append(rules, rule)
+		}
+		i := strings.Index(d, ".")
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	for rule, re := range regexps {
+		if re.MatchString(domain) {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// protectCriticalDomains 检查编译结果是否屏蔽了 cfg.CriticalDomainsFile 中的域名。
+// fail 策略下返回错误；strip 策略下去掉与关键域名完全相同的屏蔽规则（hosts 行中只去掉该主机名），
+// 被上级域名、通配符或正则规则屏蔽时追加 "@@||domain^$important" 例外规则。文件不存在时原样返回。
+func protectCriticalDomains(cfg *Config, content []byte) ([]byte, error) {
+	critical, err := loadCriticalDomains(cfg.CriticalDomainsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read critical domains '%s': %w", cfg.CriticalDomainsFile, err)
+	}
+	if len(critical) == 0 {
+		return content, nil
+	}
+
+	lines := transform.SplitLines(content)
+	blocked := make(map[string]string)
+	regexps := make(map[string]*regexp.Regexp)
+	allowed := make(map[string]bool)
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || transform.IsComment(trimmed) {
+			continue
+		}
+		if hosts, ok := transform.ParseHostsLine(trimmed); ok {
+			for _, h := range hosts {
+				blocked[strings.ToLower(strings.TrimSuffix(h, "."))] = trimmed
+			}
+			continue
+		}
+		r := transform.ParseAdblockRule(trimmed)
+		d, ok := r.Domain()
+		if !ok {
+			// 通配符与正则规则按 patternRegexp 匹配，Go 不支持的正则无法判断，跳过
+			if !r.Allow {
+				if re, err := patternRegexp(r.Pattern); err == nil {
+					regexps[trimmed] = re
+				}
+			}
+			continue
+		}
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if r.Allow {
+			// 已有 $important 例外规则的域名不会被屏蔽
+			if slices.Contains(r.Modifiers, "important") {
+				allowed[d] = true
+			}
+			continue
+		}
+		blocked[d] = trimmed
+	}
+
+	// strip 记录要删除的屏蔽规则；hosts 行对应其中要去掉的主机名，其余为 nil
+	strip := make(map[string][]string)
+	var exceptions []string
+	var hits int
+	for _, c := range critical {
+		if allowed[c] {
+			continue
+		}
+		rules := blockingRules(c, blocked, regexps)
+		if len(rules) == 0 {
+			continue
+		}
+		hits++
+		logging.Compiler.Warn("🛡️ Critical domain is blocked", "domain", c, "rules", strings.Join(rules, ", "))
+		if cfg.CriticalDomainsPolicy == criticalFail {
+			continue
+		}
+		if rule, ok := blocked[c]; ok && len(rules) == 1 && rules[0] == rule {
+			if _, isHosts := transform.ParseHostsLine(rule); isHosts {
+				strip[rule] = append(strip[rule], c)
+			} else {
+				strip[rule] = nil
+			}
+			continue
+		}
+		exceptions = append(exceptions, "@@||"+c+"^$important")
+	}
+	if hits == 0 {
+		return content, nil
+	}
+	if cfg.CriticalDomainsPolicy == criticalFail {
+		return nil, fmt.Errorf("compiled rules block %d critical domains listed in '%s'", hits, cfg.CriticalDomainsFile)
+	}
+	out := make([]string, 0, len(lines)+len(exceptions))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		drop, ok := strip[trimmed]
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		// 同一行 hosts 规则中的其他主机名仍然屏蔽
+		if hosts, isHosts := transform.ParseHostsLine(trimmed); isHosts {
+			kept := slices.DeleteFunc(hosts, func(h string) bool {
+				return slices.Contains(drop, strings.ToLower(strings.TrimSuffix(h, ".")))
+			})
+			if len(kept) > 0 {
+				out = append(out, strings.Fields(trimmed)[0]+" "+strings.Join(kept, " "))
+			}
+		}
+	}
+	lines = append(out, exceptions...)
+	logging.Compiler.Info("🛡️ Protected critical domains", "removed", len(strip), "exceptions", len(exceptions))
+	return transform.JoinLines(lines, bytes.HasSuffix(content, []byte("\n"))), nil
+}
@@ -0,0 +1,297 @@
+package compile
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// DeadDomainsConfig 控制失效域名清理：并发解析被屏蔽的域名，
+// 连续 Threshold 次构建都返回 NXDOMAIN 的域名会从输出中删除。
+type DeadDomainsConfig struct {
+	Enabled   bool                    `yaml:"enabled"`
+	Resolver  download.ResolverConfig `yaml:"resolver"`
+	QPS       float64                 `yaml:"qps"`
+	Workers   int                     `yaml:"workers"`
+	Timeout   time.Duration           `yaml:"timeout"`
+	Threshold int                     `yaml:"threshold"`
+	MaxChecks int                     `yaml:"max_checks"`
+	StateFile string                  `yaml:"state_file"`
+}
+
+// defaultDeadDomainResolver 是未配置 resolver 时用于检查的 DNS 服务器。
+const defaultDeadDomainResolver = "1.1.1.1"
+
+// domainState 是单个域名在多次构建间累计的检查结果。
+type domainState struct {
+	Misses  int       `json:"misses"`
+	Checked time.Time `json:"checked"`
+}
+
+// deadDomainState 是保存在 state_file 中的检查记录。
+type deadDomainState struct {
+	Domains map[string]*domainState `json:"domains"`
+}
+
+// 单次检查的结果。
+type checkOutcome int
+
+const (
+	checkUnknown checkOutcome = iota // 超时、SERVFAIL 等，不改变计数
+	checkAlive
+	checkNXDomain
+)
+
+// loadDeadDomainState 读取检查记录，文件不存在时返回空记录。
+func loadDeadDomainState(path string) (*deadDomainState, error) {
+	state := &deadDomainState{Domains: make(map[string]*domainState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Domains == nil {
+		state.Domains = make(map[string]*domainState)
+	}
+	return state, nil
+}
+
+// save 将检查记录写入 path。
+func (s *deadDomainState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(path, data)
+}
+
+// removeDeadDomains 检查编译结果中被屏蔽的域名，并删除连续多次返回 NXDOMAIN 的域名规则。
+// 未启用时原样返回。检查被取消时保留已完成的结果，不影响构建继续进行。
+func removeDeadDomains(ctx context.Context, cfg *Config, content []byte) ([]byte, int, error) {
+	dc := cfg.DeadDomains
+	if !dc.Enabled {
+		return content, 0, nil
+	}
+	state, err := loadDeadDomainState(dc.StateFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read dead domain state '%s': %w", dc.StateFile, err)
+	}
+	resolverCfg := dc.Resolver
+	// 检查总是使用 TCP 格式的查询，udp:// 前缀按普通 DNS 处理
+	resolverCfg.Address = strings.TrimPrefix(resolverCfg.Address, "udp://")
+	if resolverCfg.Address == "" {
+		resolverCfg.Address = defaultDeadDomainResolver
+	}
+	resolver, err := download.NewResolver(resolverCfg)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lines := transform.SplitLines(content)
+	current := make(map[string]bool)
+	for _, line := range lines {
+		if d, ok := transform.SimpleBlockedDomain(strings.TrimSpace(line)); ok {
+			current[d] = true
+		}
+	}
+	// 不再出现在列表中的域名不需要继续跟踪
+	for d := range state.Domains {
+		if !current[d] {
+			delete(state.Domains, d)
+		}
+	}
+
+	// 优先检查最久未检查的域名，max_checks 限制单次构建的检查数量
+	queue := make([]string, 0, len(current))
+	for d := range current {
+		queue = append(queue, d)
+	}
+	checkedAt := func(d string) time.Time {
+		if st := state.Domains[d]; st != nil {
+			return st.Checked
+		}
+		return time.Time{}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		ti, tj := checkedAt(queue[i]), checkedAt(queue[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return queue[i] < queue[j]
+	})
+	if dc.MaxChecks > 0 && len(queue) > dc.MaxChecks {
+		queue = queue[:dc.MaxChecks]
+	}
+
+	logging.Compiler.Info("💀 Checking blocked domains for NXDOMAIN...", "checking", len(queue), "domains", len(current))
+	outcomes := checkDomains(ctx, resolver, dc, queue)
+
+	var nx, alive int
+	now := time.Now()
+	for d, outcome := range outcomes {
+		st := state.Domains[d]
+		if st == nil {
+			st = &domainState{}
+			state.Domains[d] = st
+		}
+		switch outcome {
+		case checkNXDomain:
+			st.Misses++
+			nx++
+		case checkAlive:
+			st.Misses = 0
+			alive++
+		}
+		st.Checked = now
+	}
+	if err := state.save(dc.StateFile); err != nil {
+		return nil, 0, fmt.Errorf("failed to write dead domain state '%s': %w", dc.StateFile, err)
+	}
+
+	dead := make(map[string]bool)
+	for d, st := range state.Domains {
+		if st.Misses >= dc.Threshold {
+			dead[d] = true
+		}
+	}
+	lines = transform.FilterLines(lines, func(line string) bool {
+		d, ok := transform.SimpleBlockedDomain(strings.TrimSpace(line))
+		return !ok || !dead[d]
+	})
+	logging.Compiler.Info("💀 Dead domain check finished", "alive", alive, "nxdomain", nx, "unknown", len(outcomes)-alive-nx,
+		"removed", len(dead), "threshold", dc.Threshold)
+	return transform.JoinLines(lines, strings.HasSuffix(string(content), "\n")), len(dead), nil
+}
+
+// checkDomains 以 dc.Workers 个协程、不超过 dc.QPS 的速度并发检查 domains。
+func checkDomains(ctx context.Context, resolver *net.Resolver, dc DeadDomainsConfig, domains []string) map[string]checkOutcome {
+	jobs := make(chan string)
+	var (
+		mu       sync.Mutex
+		outcomes = make(map[string]checkOutcome, len(domains))
+		wg       sync.WaitGroup
+	)
+	var bucket *download.TokenBucket
+	if dc.QPS > 0 {
+		bucket = download.NewTokenBucket(dc.QPS, 1)
+	}
+	for i := 0; i < dc.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				if bucket != nil {
+					if err := bucket.Wait(ctx); err != nil {
+						continue
+					}
+				}
+				outcome, err := queryRCode(ctx, resolver, d, dc.Timeout)
+				if err != nil {
+					logging.Compiler.Debug("⚠️ Dead domain check failed", "domain", d, "error", err)
+				}
+				mu.Lock()
+				outcomes[d] = outcome
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, d := range domains {
+		select {
+		case jobs <- d:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return outcomes
+}
+
+// queryRCode 通过 resolver 的连接发送一次 A 记录查询，根据响应码判断域名是否存在。
+// 使用原始 DNS 消息而不是 LookupHost，是为了区分 NXDOMAIN 与没有 A 记录（NODATA）：
+// 后者的子域名仍可能存在，不能删除。
+func queryRCode(ctx context.Context, resolver *net.Resolver, domain string, timeout time.Duration) (checkOutcome, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name, err := dnsmessage.NewName(domain + ".")
+	if err != nil {
+		return checkUnknown, err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return checkUnknown, err
+	}
+
+	// 总是使用流式（TCP）格式，普通 DNS、DoT 与 DoH 的连接都支持
+	conn, err := resolver.Dial(ctx, "tcp", "")
+	if err != nil {
+		return checkUnknown, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	framed := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return checkUnknown, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return checkUnknown, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return checkUnknown, err
+	}
+
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return checkUnknown, err
+	}
+	if h.ID != id {
+		return checkUnknown, fmt.Errorf("mismatched dns response id")
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeNameError:
+		return checkNXDomain, nil
+	case dnsmessage.RCodeSuccess:
+		return checkAlive, nil
+	}
+	return checkUnknown, fmt.Errorf("dns response code %s", h.RCode)
+}
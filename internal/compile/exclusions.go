@@ -0,0 +1,92 @@
+package compile
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// exclusion 是 exclusions.txt 中的一条模式。
+type exclusion struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// loadExclusions 读取排除模式文件。"/regex/" 形式的行作为正则表达式（可匹配规则的任意部分），
+// 其他行作为匹配整条规则的通配模式，其中 * 匹配任意字符、? 匹配单个字符。文件不存在时返回 nil。
+func loadExclusions(file string) ([]exclusion, error) {
+	lines, err := readOptionalLines(file)
+	if err != nil {
+		return nil, err
+	}
+	exclusions := make([]exclusion, 0, len(lines))
+	for _, line := range lines {
+		var expr string
+		if transform.IsRegexRule(line) {
+			expr = line[1 : len(line)-1]
+		} else {
+			expr = "^" + globToRegexp(line) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusion pattern %q: %w", line, err)
+		}
+		exclusions = append(exclusions, exclusion{pattern: line, re: re})
+	}
+	return exclusions, nil
+}
+
+// globToRegexp 将通配模式转换为等价的正则表达式。
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for _, part := range strings.SplitAfter(glob, "*") {
+		for _, sub := range strings.SplitAfter(strings.TrimSuffix(part, "*"), "?") {
+			b.WriteString(regexp.QuoteMeta(strings.TrimSuffix(sub, "?")))
+			if strings.HasSuffix(sub, "?") {
+				b.WriteString(".")
+			}
+		}
+		if strings.HasSuffix(part, "*") {
+			b.WriteString(".*")
+		}
+	}
+	return b.String()
+}
+
+// applyExclusions 从编译结果中删除匹配 cfg.ExclusionsFile 中任一模式的规则，返回删除的规则数。
+// 文件不存在时原样返回。
+func applyExclusions(cfg *Config, content []byte) ([]byte, int, error) {
+	exclusions, err := loadExclusions(cfg.ExclusionsFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read exclusions '%s': %w", cfg.ExclusionsFile, err)
+	}
+	if len(exclusions) == 0 {
+		return content, 0, nil
+	}
+
+	counts := make([]int, len(exclusions))
+	removed := 0
+	lines := transform.FilterLines(transform.SplitLines(content), func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || transform.IsComment(trimmed) {
+			return true
+		}
+		for i, ex := range exclusions {
+			if ex.re.MatchString(trimmed) {
+				counts[i]++
+				removed++
+				return false
+			}
+		}
+		return true
+	})
+	for i, ex := range exclusions {
+		logging.Compiler.Debug("🚫 Exclusion matched", "pattern", ex.pattern, "rules", counts[i])
+	}
+	logging.Compiler.Info("🚫 Applied exclusions", "removed", removed, "patterns", len(exclusions))
+	return transform.JoinLines(lines, bytes.HasSuffix(content, []byte("\n"))), removed, nil
+}
@@ -0,0 +1,53 @@
+package compile
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// appendExtraRules 校验 cfg.ExtraRulesFile 中的自定义规则并追加到编译结果末尾，
+// 无效的规则会被跳过并记录警告，已存在于编译结果中的规则不会重复追加。文件不存在时原样返回。
+func appendExtraRules(cfg *Config, content []byte) ([]byte, error) {
+	extra, err := readOptionalLines(cfg.ExtraRulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extra rules '%s': %w", cfg.ExtraRulesFile, err)
+	}
+	if len(extra) == 0 {
+		return content, nil
+	}
+
+	lines := transform.SplitLines(content)
+	if len(lines) == 1 && lines[0] == "" {
+		lines = nil
+	}
+	existing := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		existing[strings.TrimSpace(line)] = true
+	}
+	allowIP := slices.Contains(cfg.Transformations, transform.TrValidateAllowIP)
+	var added, invalid int
+	for _, line := range extra {
+		if transform.IsComment(line) {
+			continue
+		}
+		rule, _ := transform.NormalizeRule(line)
+		if !transform.IsValidRule(rule, allowIP) {
+			logging.Compiler.Warn("⚠️ Skipping invalid extra rule", "rule", line)
+			invalid++
+			continue
+		}
+		if existing[rule] {
+			continue
+		}
+		existing[rule] = true
+		lines = append(lines, rule)
+		added++
+	}
+	logging.Compiler.Info("✅ Appended extra rules", "added", added, "invalid", invalid)
+	return transform.JoinLines(lines, len(content) == 0 || bytes.HasSuffix(content, []byte("\n"))), nil
+}
@@ -0,0 +1,9 @@
+package compile
+
+// RejectedRule 是语法校验未通过、未进入输出的规则行。
+type RejectedRule struct {
+	Source string
+	Line   int // 在该源经过格式转换与自身转换后的行号，adblock 格式且未配置源转换时即原始行号
+	Rule   string
+	Reason string
+}
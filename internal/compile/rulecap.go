@@ -0,0 +1,76 @@
+package compile
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// capRules 在规则数超过 cfg.MaxRules 时按源的优先级截断输出：优先级低的源先被截断，
+// 优先级相同时排在后面的源先被截断，同一源内从末尾开始删除。无法确定来源的规则
+// （自定义规则、允许列表与关键域名追加的例外等）不会被删除。返回删除的规则数。
+func capRules(cfg *Config, content []byte, downloads []download.Result, ruleSources map[string]int) ([]byte, int) {
+	if cfg.MaxRules <= 0 {
+		return content, 0
+	}
+	lines := transform.SplitLines(content)
+	positions := make([][]int, len(downloads))
+	count := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || transform.IsComment(trimmed) {
+			continue
+		}
+		count++
+		if idx, ok := ruleSources[transform.DedupeKey(trimmed)]; ok {
+			positions[idx] = append(positions[idx], i)
+		}
+	}
+	excess := count - cfg.MaxRules
+	if excess <= 0 {
+		return content, 0
+	}
+
+	order := make([]int, len(downloads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, pb := downloads[order[a]].Source.Priority, downloads[order[b]].Source.Priority
+		if pa != pb {
+			return pa < pb
+		}
+		return order[a] > order[b]
+	})
+	drop := make(map[int]bool, excess)
+	for _, idx := range order {
+		if excess == 0 {
+			break
+		}
+		pos := positions[idx]
+		n := min(excess, len(pos))
+		for _, p := range pos[len(pos)-n:] {
+			drop[p] = true
+		}
+		excess -= n
+		if n > 0 {
+			logging.Merger.Info("✂️ Truncated rules to fit max_rules", "source", downloads[idx].Source.Name, "truncated", n, "rules", len(pos),
+				"priority", downloads[idx].Source.Priority, "max_rules", cfg.MaxRules)
+		}
+	}
+	if excess > 0 {
+		logging.Merger.Warn("⚠️ Output still exceeds max_rules with rules not attributable to any source", "max_rules", cfg.MaxRules, "excess", excess)
+	}
+
+	out := make([]string, 0, len(lines)-len(drop))
+	for i, line := range lines {
+		if !drop[i] {
+			out = append(out, line)
+		}
+	}
+	return transform.JoinLines(out, bytes.HasSuffix(content, []byte("\n"))), len(drop)
+}
@@ -0,0 +1,62 @@
+package compile
+
+import (
+	"math"
+
+	"adguardlist/internal/logging"
+)
+
+// Kept 返回该源去重、校验及过滤后进入合并列表的规则数。
+func (st SourceStats) Kept() int {
+	return st.Rules - st.Duplicates - st.Repeated - st.Rejected - st.ipRules - st.regexRules
+}
+
+// UniquePercent 返回只出现在该源中的规则占该源规则的百分比。
+func (st SourceStats) UniquePercent() float64 {
+	if st.Rules == 0 {
+		return 0
+	}
+	return float64(st.Unique) * 100 / float64(st.Rules)
+}
+
+// LogContributions 输出每个源的贡献统计，并提示没有独有规则、可以考虑移除的源。
+func LogContributions(stats []SourceStats) {
+	for _, st := range stats {
+		logging.Merger.Info("📈 Source contribution", "source", st.Name, "bytes", st.Bytes, "fetched", st.Rules, "kept", st.Kept(),
+			"unique", st.Unique, "unique_percent", math.Round(st.UniquePercent()*10)/10)
+		if st.Rules > 0 && st.Unique == 0 && len(stats) > 1 {
+			logging.Merger.Warn("⚠️ Source adds no rules that are not in other sources", "source", st.Name)
+		}
+	}
+}
+
+// LogDuplicates 输出合并前在各源中去除的重复规则数（与前面的源重复及源内重复）及 IP 地址、正则规则数。
+func LogDuplicates(stats []SourceStats) {
+	total, repeated, ipRules, regexRules := 0, 0, 0, 0
+	for _, st := range stats {
+		logging.Merger.Debug("🔎 Parsed source", "source", st.Name, "format", st.Format, "lines", st.Lines)
+		if st.ipRules > 0 {
+			logging.Merger.Info("🔢 Removed IP address rules", "source", st.Name, "count", st.ipRules)
+			ipRules += st.ipRules
+		}
+		if st.regexRules > 0 {
+			logging.Merger.Info("🔢 Removed regex rules", "source", st.Name, "count", st.regexRules)
+			regexRules += st.regexRules
+		}
+		if st.Duplicates > 0 {
+			logging.Merger.Info("🧹 Removed lines already present in earlier sources", "source", st.Name, "count", st.Duplicates, "lines", st.Lines)
+			total += st.Duplicates
+		}
+		if st.Repeated > 0 {
+			logging.Merger.Info("🧹 Removed lines repeated within the source", "source", st.Name, "count", st.Repeated)
+			repeated += st.Repeated
+		}
+	}
+	logging.Merger.Info("🧹 Removed duplicate lines before compiling", "count", total, "repeated", repeated, "sources", len(stats))
+	if ipRules > 0 {
+		logging.Merger.Info("🔢 Removed IP address rules in total", "count", ipRules)
+	}
+	if regexRules > 0 {
+		logging.Merger.Info("🔢 Removed regex rules in total", "count", regexRules)
+	}
+}
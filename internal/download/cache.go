@@ -0,0 +1,89 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"adguardlist/internal/fileutil"
+)
+
+// cacheEntry 是缓存中与规则源内容一同保存的 HTTP 元信息。
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// sourceCache 将每个源的内容及其 ETag/Last-Modified 保存在本地目录中，
+// 用于发送条件请求。nil 表示禁用缓存。
+type sourceCache struct {
+	dir string
+}
+
+// newSourceCache 创建位于 dir 的缓存，dir 为空时返回 nil。
+func newSourceCache(dir string) (*sourceCache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &sourceCache{dir: dir}, nil
+}
+
+// paths 返回 url 对应的元信息文件和内容文件路径。
+func (c *sourceCache) paths(url string) (meta, body string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key+".json"), filepath.Join(c.dir, key+".txt")
+}
+
+// load 读取 url 的缓存，不存在时返回 (nil, nil, nil)。
+func (c *sourceCache) load(url string) (*cacheEntry, []byte, error) {
+	if c == nil {
+		return nil, nil, nil
+	}
+	metaPath, bodyPath := c.paths(url)
+	data, err := os.ReadFile(metaPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, nil, err
+	}
+	body, err := os.ReadFile(bodyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &entry, body, nil
+}
+
+// store 保存 url 的内容与元信息。
+func (c *sourceCache) store(entry *cacheEntry, body []byte) error {
+	if c == nil {
+		return nil
+	}
+	metaPath, bodyPath := c.paths(entry.URL)
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteAtomic(bodyPath, body); err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(metaPath, data)
+}
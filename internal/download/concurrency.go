@@ -0,0 +1,104 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"adguardlist/internal/logging"
+)
+
+// concurrencyLimiter 自适应地调整同时进行的下载数，上限为 max。
+// 从较小的并发数开始慢启动：达到阈值前每完成一轮成功请求就翻倍，之后每轮加一；
+// 遇到网络错误、超时或 5xx 时减半并把阈值设为减半后的值。nil 表示不限制（固定并发）。
+type concurrencyLimiter struct {
+	mu        sync.Mutex
+	max       int
+	limit     int
+	threshold int
+	active    int
+	successes int
+	changed   chan struct{} // 每次释放或调整后关闭并替换，用于唤醒等待者
+}
+
+// newConcurrencyLimiter 创建以 max 为上限的自适应限制器，adaptive 为 false 时返回 nil。
+func newConcurrencyLimiter(max int, adaptive bool) *concurrencyLimiter {
+	if !adaptive {
+		return nil
+	}
+	return &concurrencyLimiter{
+		max:       max,
+		limit:     min(2, max),
+		threshold: max,
+		changed:   make(chan struct{}),
+	}
+}
+
+// acquire 阻塞直到有空闲的下载名额或 ctx 结束。
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release 归还名额，并根据本次下载的结果调整并发数。
+// 不可重试的错误（如 404）与服务器负载无关，不影响并发数。
+func (l *concurrencyLimiter) release(err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+
+	var permanent errNotRetryable
+	switch {
+	case err == nil:
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.max {
+			old := l.limit
+			if l.limit < l.threshold {
+				l.limit = min(l.limit*2, l.threshold)
+			} else {
+				l.limit++
+			}
+			l.successes = 0
+			logging.Downloader.Debug("🔧 Download concurrency raised", "from", old, "to", l.limit)
+		}
+	case errors.As(err, &permanent), errors.Is(err, context.Canceled):
+	default:
+		if l.limit > 1 {
+			old := l.limit
+			l.limit /= 2
+			l.threshold = l.limit
+			logging.Downloader.Debug("🔧 Download concurrency lowered after error", "from", old, "to", l.limit, "error", err)
+		}
+		l.successes = 0
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// current 返回当前的并发上限。
+func (l *concurrencyLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
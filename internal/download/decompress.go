@@ -0,0 +1,60 @@
+package download
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"adguardlist/internal/source"
+)
+
+// acceptEncoding 是下载时声明支持的压缩格式。
+const acceptEncoding = "gzip, br"
+
+// gzipMagic 是 gzip 数据的文件头。
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decodeBody 根据 Content-Encoding 返回解压后的响应体读取器。
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "br":
+		return io.NopCloser(brotli.NewReader(resp.Body)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+// maybeGunzip 在 body 为 gzip 数据（如 URL 以 .gz 结尾的源）时将其解压，
+// 解压结果同样受 maxSize 限制。
+func maybeGunzip(body []byte, maxSize source.ByteSize) ([]byte, error) {
+	if !bytes.HasPrefix(body, gzipMagic) {
+		return body, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, errNotRetryable{fmt.Errorf("invalid gzip data: %w", err)}
+	}
+	defer zr.Close()
+
+	var r io.Reader = zr
+	if maxSize > 0 {
+		r = io.LimitReader(zr, int64(maxSize)+1)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errNotRetryable{fmt.Errorf("failed to decompress gzip data: %w", err)}
+	}
+	if maxSize > 0 && int64(len(out)) > int64(maxSize) {
+		return nil, errNotRetryable{fmt.Errorf("decompressed size exceeds max size of %s", maxSize)}
+	}
+	return out, nil
+}
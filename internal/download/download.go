@@ -0,0 +1,658 @@
+// Package download 并发下载规则源，负责重试、限速、代理、DNS 解析、下载缓存与 Git 源。
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/source"
+)
+
+// Config 控制规则源的下载：并发数、超时、重试、代理与 DNS 解析、限速以及下载缓存。
+type Config struct {
+	MaxConcurrentJobs   int             `yaml:"max_concurrent_jobs"`
+	AdaptiveConcurrency bool            `yaml:"adaptive_concurrency"`
+	DownloadTimeout     time.Duration   `yaml:"download_timeout"`
+	MaxSize             source.ByteSize `yaml:"max_size"`
+	Retry               RetryConfig     `yaml:"retry"`
+	Proxy               string          `yaml:"proxy"`
+	Resolver            ResolverConfig  `yaml:"resolver"`
+	NetrcFile           string          `yaml:"netrc_file"`
+	RateLimit           RateLimitConfig `yaml:"rate_limit"`
+	CacheDir            string          `yaml:"cache_dir"`
+	CacheFallback       bool            `yaml:"cache_fallback"`
+	Offline             bool            `yaml:"offline"`
+	GitCacheDir         string          `yaml:"git_cache_dir"`
+}
+
+// DefaultConfig 返回下载的默认配置。
+func DefaultConfig() Config {
+	return Config{
+		MaxConcurrentJobs: 8,
+		DownloadTimeout:   45 * time.Second,
+		MaxSize:           50 << 20,
+		Retry: RetryConfig{
+			Count:         2,
+			BaseDelay:     2 * time.Second,
+			MaxDelay:      30 * time.Second,
+			Jitter:        0.2,
+			MaxRetryAfter: 2 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: 2,
+			Burst:             4,
+		},
+		CacheDir:      ".cache/sources",
+		CacheFallback: true,
+		GitCacheDir:   ".cache/git",
+	}
+}
+
+// Check 检查下载配置中的取值是否合法。
+func (c *Config) Check() error {
+	if c.MaxConcurrentJobs <= 0 {
+		return fmt.Errorf("max_concurrent_jobs must be positive, got %d", c.MaxConcurrentJobs)
+	}
+	if c.DownloadTimeout <= 0 {
+		return fmt.Errorf("download_timeout must be positive, got %s", c.DownloadTimeout)
+	}
+	if c.RateLimit.RequestsPerSecond < 0 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("rate_limit values must not be negative")
+	}
+	if c.Offline && c.CacheDir == "" {
+		return fmt.Errorf("offline mode requires cache_dir")
+	}
+	if c.GitCacheDir == "" {
+		return fmt.Errorf("git_cache_dir must not be empty")
+	}
+	if c.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative")
+	}
+	if c.Retry.Count < 0 || c.Retry.BaseDelay < 0 || c.Retry.MaxDelay < 0 || c.Retry.MaxRetryAfter < 0 {
+		return fmt.Errorf("retry count and delays must not be negative")
+	}
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %g", c.Retry.Jitter)
+	}
+	if _, err := source.ProxyFunc(c.Proxy); err != nil {
+		return err
+	}
+	if _, err := NewResolver(c.Resolver); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RetryConfig 控制下载失败后的重试策略。
+type RetryConfig struct {
+	Count         int           `yaml:"count"`
+	BaseDelay     time.Duration `yaml:"base_delay"`
+	MaxDelay      time.Duration `yaml:"max_delay"`
+	Jitter        float64       `yaml:"jitter"`
+	MaxRetryAfter time.Duration `yaml:"max_retry_after"`
+}
+
+// delay 返回第 attempt 次（从 0 开始）失败后的等待时间：
+// 以 BaseDelay 为基数指数增长，不超过 MaxDelay，并叠加 ±Jitter 比例的随机抖动。
+func (r RetryConfig) delay(attempt int) time.Duration {
+	d := r.BaseDelay << attempt
+	if d <= 0 || (r.MaxDelay > 0 && d > r.MaxDelay) {
+		d = r.MaxDelay
+	}
+	if r.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * r.Jitter * float64(d))
+	}
+	return d
+}
+
+// downloadJob 是分发给下载协程的任务，index 用于按源列表顺序还原结果。
+type downloadJob struct {
+	index  int
+	source source.Source
+}
+
+// downloadResult 保存了下载任务的内容和可能发生的错误。
+// stale 表示下载失败后改用了缓存中的旧内容，staleSince 为该缓存的下载时间。
+type downloadResult struct {
+	index      int
+	source     source.Source
+	content    []byte
+	err        error
+	staleErr   error // 回退到缓存前的下载错误
+	stale      bool
+	staleSince time.Time
+	duration   time.Duration
+}
+
+// Outcome 记录单个源的下载耗时与错误，用于构建报告。
+type Outcome struct {
+	Duration time.Duration
+	Err      error // 下载失败的原因，回退到缓存时同样记录
+}
+
+// Result 是下载成功（或回退到缓存）的源及其内容。
+type Result struct {
+	Source     source.Source
+	Content    []byte
+	Stale      bool
+	StaleSince time.Time
+}
+
+// errNotRetryable 包装不应重试的下载错误。
+type errNotRetryable struct{ err error }
+
+func (e errNotRetryable) Error() string { return e.err.Error() }
+func (e errNotRetryable) Unwrap() error { return e.err }
+
+// errRetryAfter 表示服务器返回了 429/503，wait 为 Retry-After 要求的等待时间（未提供时为 0）。
+type errRetryAfter struct {
+	err  error
+	wait time.Duration
+}
+
+func (e errRetryAfter) Error() string { return e.err.Error() }
+func (e errRetryAfter) Unwrap() error { return e.err }
+
+// Downloader 负责下载单个规则源，由所有下载协程共享。
+type Downloader struct {
+	gitDir   string
+	timeout  time.Duration
+	maxSize  source.ByteSize
+	proxy    string
+	retry    RetryConfig
+	cache    *sourceCache
+	fallback bool
+	limiter  *hostLimiter
+	slots    *concurrencyLimiter
+	resolver *net.Resolver
+	netrc    *netrc
+	offline  bool
+
+	mu      sync.Mutex
+	clients map[string]*http.Client // 按代理地址和 TLS 设置复用的客户端
+}
+
+// New 根据配置创建 Downloader。
+func New(cfg *Config) (*Downloader, error) {
+	cache, err := newSourceCache(cfg.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory '%s': %w", cfg.CacheDir, err)
+	}
+	resolver, err := NewResolver(cfg.Resolver)
+	if err != nil {
+		return nil, err
+	}
+	// 显式配置的 netrc_file 必须存在，默认的 ~/.netrc 不存在时忽略
+	credentials, err := loadNetrc(netrcPath(cfg.NetrcFile), cfg.NetrcFile != "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc file: %w", err)
+	}
+	return &Downloader{
+		gitDir:   cfg.GitCacheDir,
+		timeout:  cfg.DownloadTimeout,
+		maxSize:  cfg.MaxSize,
+		proxy:    cfg.Proxy,
+		retry:    cfg.Retry,
+		cache:    cache,
+		fallback: cfg.CacheFallback,
+		limiter:  newHostLimiter(cfg.RateLimit),
+		slots:    newConcurrencyLimiter(cfg.MaxConcurrentJobs, cfg.AdaptiveConcurrency),
+		resolver: resolver,
+		netrc:    credentials,
+		offline:  cfg.Offline,
+		clients:  make(map[string]*http.Client),
+	}, nil
+}
+
+// clientFor 返回下载 src 使用的客户端。源未单独配置代理时使用全局代理。
+// 客户端按代理地址和 TLS 设置复用。
+func (d *Downloader) clientFor(src source.Source) (*http.Client, error) {
+	proxy := d.proxy
+	if src.Proxy != "" {
+		proxy = src.Proxy
+	}
+	key := proxy
+	if !src.TLS.IsZero() {
+		key = fmt.Sprintf("%s|%+v", proxy, src.TLS)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if client, ok := d.clients[key]; ok {
+		return client, nil
+	}
+	pf, err := source.ProxyFunc(proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = pf
+	if !src.TLS.IsZero() {
+		tlsConfig, err := src.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig.InsecureSkipVerify {
+			logging.Downloader.Warn("⚠️ TLS certificate verification is disabled", "source", src.Name)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if d.resolver != nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Resolver: d.resolver}
+		transport.DialContext = dialer.DialContext
+	}
+	client := &http.Client{Transport: transport}
+	d.clients[key] = client
+	return client, nil
+}
+
+// limitsFor 返回 src 生效的超时、重试次数和大小上限，源上的配置优先于全局配置。
+func (d *Downloader) limitsFor(src source.Source) (timeout time.Duration, retries int, maxSize source.ByteSize) {
+	timeout, retries, maxSize = d.timeout, d.retry.Count, d.maxSize
+	if src.Timeout > 0 {
+		timeout = src.Timeout
+	}
+	if src.Retries != nil {
+		retries = *src.Retries
+	}
+	if src.MaxSize > 0 {
+		maxSize = src.MaxSize
+	}
+	return timeout, retries, maxSize
+}
+
+// downloadWorker 是一个工作协程，它从 jobs 通道接收规则源，
+// 下载后将结果发送到 results 通道。
+func downloadWorker(ctx context.Context, id int, d *Downloader, jobs <-chan downloadJob, results chan<- downloadResult, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for job := range jobs {
+		result := downloadResult{index: job.index, source: job.source}
+		// 构建已取消时不再发起新的下载，只把剩余任务标记为失败
+		if err := ctx.Err(); err != nil {
+			result.err = err
+			results <- result
+			continue
+		}
+		logging.Downloader.Debug("⬇️ Downloading", "worker", id, "url", job.source.URL)
+		start := time.Now()
+		result.content, result.err = d.fetchWithRetry(ctx, job.source)
+		result.duration = time.Since(start)
+		if result.err != nil && d.fallback && ctx.Err() == nil {
+			d.useStaleCopy(&result)
+		}
+		results <- result
+	}
+}
+
+// fetchWithRetry 下载规则源，遇到网络错误、429 或 5xx 响应时按指数退避重试，
+// 服务器给出 Retry-After 时按其要求等待。
+func (d *Downloader) fetchWithRetry(ctx context.Context, src source.Source) ([]byte, error) {
+	_, retries, _ := d.limitsFor(src)
+	for attempt := 0; ; attempt++ {
+		if err := d.slots.acquire(ctx); err != nil {
+			return nil, err
+		}
+		body, err := d.fetch(ctx, src)
+		d.slots.release(err)
+		var permanent errNotRetryable
+		if err == nil || errors.As(err, &permanent) || attempt >= retries || ctx.Err() != nil {
+			return body, err
+		}
+		delay := d.retry.delay(attempt)
+		var throttled errRetryAfter
+		if errors.As(err, &throttled) && throttled.wait > 0 {
+			if d.retry.MaxRetryAfter > 0 && throttled.wait > d.retry.MaxRetryAfter {
+				return nil, fmt.Errorf("%w (server asked to retry after %s, more than max_retry_after %s)", err, throttled.wait, d.retry.MaxRetryAfter)
+			}
+			delay = throttled.wait
+		}
+		logging.Downloader.Warn("⚠️ Download failed, retrying", "source", src.Name, "attempt", attempt+1, "attempts", retries+1,
+			"error", err, "delay", delay.Round(time.Millisecond))
+		if err := SleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SleepContext 等待 d 或直到 ctx 结束。
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// useStaleCopy 在下载失败时尝试改用缓存中的旧内容，并在成功时清除 result 中的错误。
+func (d *Downloader) useStaleCopy(result *downloadResult) {
+	cached, body, err := d.cache.load(result.source.URL)
+	if err != nil || cached == nil {
+		return
+	}
+	if err := verifyPin(result.source, body); err != nil {
+		logging.Downloader.Warn("⚠️ Stale cached copy rejected", "source", result.source.Name, "error", err)
+		return
+	}
+	logging.Downloader.Warn("⚠️ Download failed, using stale cached copy", "source", result.source.Name, "error", result.err,
+		"fetched_at", cached.FetchedAt.Format(time.RFC3339))
+	result.content = body
+	result.staleErr = result.err
+	result.err = nil
+	result.stale = true
+	result.staleSince = cached.FetchedAt
+}
+
+// fetch 执行一次下载并校验内容哈希，校验通过的新内容写入缓存。
+// 返回 errNotRetryable 表示重试也无济于事。
+func (d *Downloader) fetch(ctx context.Context, src source.Source) ([]byte, error) {
+	body, entry, err := d.FetchContent(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPin(src, body); err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := d.cache.store(entry, body); err != nil {
+			logging.Downloader.Warn("⚠️ Failed to cache source", "source", src.Name, "error", err)
+		}
+	}
+	return body, nil
+}
+
+// FetchContent 读取源的内容。存在缓存时发送条件请求，304 响应直接复用缓存内容。
+// 返回的 cacheEntry 非 nil 时表示内容是新获取的，应写入缓存。
+func (d *Downloader) FetchContent(ctx context.Context, src source.Source) ([]byte, *cacheEntry, error) {
+	timeout, _, maxSize := d.limitsFor(src)
+	if path, ok := src.LocalPath(); ok {
+		body, err := readLocalSource(path, maxSize)
+		return body, nil, err
+	}
+	if d.offline {
+		return d.fetchOffline(src)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if src.IsGit() {
+		body, err := fetchGitSource(ctx, d.gitDir, src, maxSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 同样写入下载缓存，以便仓库不可用时回退
+		return body, &cacheEntry{URL: src.URL, FetchedAt: time.Now()}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", src.URL, nil)
+	if err != nil {
+		return nil, nil, errNotRetryable{fmt.Errorf("failed to create request: %w", err)}
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; AdRulesBot-Go/1.0)")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	applyRequestOptions(req, src)
+	// 源上显式配置的 Authorization 优先于 netrc
+	if req.Header.Get("Authorization") == "" {
+		if cred, ok := d.netrc.lookup(req.URL.Hostname()); ok {
+			req.SetBasicAuth(cred.login, cred.password)
+		}
+	}
+
+	client, err := d.clientFor(src)
+	if err != nil {
+		return nil, nil, errNotRetryable{err}
+	}
+
+	cached, cachedBody, err := d.cache.load(src.URL)
+	if err != nil {
+		logging.Downloader.Warn("⚠️ Ignoring unreadable cache", "source", src.Name, "error", err)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	if err := d.limiter.wait(ctx, req.URL.Host); err != nil {
+		return nil, nil, fmt.Errorf("rate limiter: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// 错误信息中只保留配置中的原始 URL，避免泄露查询参数里的密钥
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = src.URL
+		}
+		return nil, nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		logging.Downloader.Debug("♻️ Not modified, using cached copy", "source", src.Name, "fetched_at", cached.FetchedAt.Format(time.RFC3339))
+		return cachedBody, nil, nil
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		wait := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if wait > 0 {
+			d.limiter.pause(req.URL.Host, time.Now().Add(wait))
+		}
+		return nil, nil, errRetryAfter{fmt.Errorf("bad status: %s", resp.Status), wait}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("bad status: %s", resp.Status)
+		if resp.StatusCode < 500 {
+			return nil, nil, errNotRetryable{err}
+		}
+		return nil, nil, err
+	}
+
+	body, err := readLimited(resp, maxSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, nil, errNotRetryable{fmt.Errorf("downloaded file is empty")}
+	}
+	if err := checkListContent(body, resp.Header.Get("Content-Type")); err != nil {
+		return nil, nil, err
+	}
+
+	entry := &cacheEntry{
+		URL:          src.URL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	return body, entry, nil
+}
+
+// ParseRetryAfter 解析 Retry-After 头（秒数或 HTTP 日期），返回需要等待的时间。
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// fetchOffline 在离线模式下从下载缓存读取源的内容，从未下载过的源直接失败。
+func (d *Downloader) fetchOffline(src source.Source) ([]byte, *cacheEntry, error) {
+	cached, body, err := d.cache.load(src.URL)
+	if err != nil {
+		return nil, nil, errNotRetryable{fmt.Errorf("failed to read cache: %w", err)}
+	}
+	if cached == nil {
+		return nil, nil, errNotRetryable{fmt.Errorf("not in download cache (offline mode)")}
+	}
+	logging.Downloader.Debug("📦 Loaded from cache", "source", src.Name, "fetched_at", cached.FetchedAt.Format(time.RFC3339))
+	return body, nil, nil
+}
+
+// applyRequestOptions 将源上配置的请求头与查询参数加入请求，值中的 ${VAR} 会替换为环境变量。
+func applyRequestOptions(req *http.Request, src source.Source) {
+	for key, value := range src.Headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+	if len(src.Query) > 0 {
+		q := req.URL.Query()
+		for key, value := range src.Query {
+			q.Set(key, os.ExpandEnv(value))
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// readLimited 读取并解压响应体，超过 maxSize 时立即中止读取，避免把超大响应读入内存。
+// Content-Length 已声明超限时不读取任何内容，解压后的大小同样受限。maxSize 为 0 表示不限制。
+func readLimited(resp *http.Response, maxSize source.ByteSize) ([]byte, error) {
+	if maxSize > 0 && resp.ContentLength > int64(maxSize) {
+		return nil, errNotRetryable{fmt.Errorf("response size %d exceeds max size of %s", resp.ContentLength, maxSize)}
+	}
+	body, err := decodeBody(resp)
+	if err != nil {
+		return nil, errNotRetryable{err}
+	}
+	defer body.Close()
+
+	var reader io.Reader = Progress.countReader(body)
+	if maxSize > 0 {
+		reader = io.LimitReader(reader, int64(maxSize)+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if maxSize > 0 && int64(len(content)) > int64(maxSize) {
+		return nil, errNotRetryable{fmt.Errorf("response exceeds max size of %s, aborted", maxSize)}
+	}
+	return maybeGunzip(content, maxSize)
+}
+
+// readLocalSource 读取本地规则文件。本地文件的错误不会因重试而改变。
+func readLocalSource(path string, maxSize source.ByteSize) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errNotRetryable{err}
+	}
+	if maxSize > 0 && info.Size() > int64(maxSize) {
+		return nil, errNotRetryable{fmt.Errorf("file exceeds max size of %s", maxSize)}
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errNotRetryable{err}
+	}
+	if len(body) == 0 {
+		return nil, errNotRetryable{fmt.Errorf("local file is empty")}
+	}
+	Progress.addBytes(len(body))
+	return maybeGunzip(body, maxSize)
+}
+
+// All 并发下载所有源，按源列表顺序返回成功的结果以及失败的源，
+// outcomes 以源的 URL 为键记录每个源的下载耗时与错误。
+func All(ctx context.Context, cfg *Config, sources []source.Source) (downloads []Result, failed []source.Source, outcomes map[string]Outcome, err error) {
+	d, err := New(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	total := len(sources)
+	jobs := make(chan downloadJob, total)
+	results := make(chan downloadResult, total)
+	var wg sync.WaitGroup
+
+	for i := 1; i <= cfg.MaxConcurrentJobs; i++ {
+		wg.Add(1)
+		go downloadWorker(ctx, i, d, jobs, results, &wg)
+	}
+
+	for i, src := range sources {
+		jobs <- downloadJob{index: i, source: src}
+	}
+	close(jobs)
+	Progress.start(total)
+
+	// 按源列表顺序保存结果，保证编译输入的顺序稳定
+	ordered := make([]*downloadResult, total)
+	outcomes = make(map[string]Outcome, total)
+	for i := 0; i < total; i++ {
+		res := <-results
+		outcomes[res.source.URL] = Outcome{Duration: res.duration, Err: errors.Join(res.err, res.staleErr)}
+		Progress.sourceDone(res.err != nil)
+		switch {
+		case res.err != nil:
+			logging.Downloader.Error("❌ Download failed", "source", res.source.Name, "error", res.err)
+			failed = append(failed, res.source)
+		case res.stale:
+			ordered[res.index] = &res
+		default:
+			logging.Downloader.Info("✅ Downloaded", "source", res.source.Name, "bytes", len(res.content))
+			ordered[res.index] = &res
+		}
+	}
+	wg.Wait() // 等待所有 worker 完成
+	Progress.finish()
+	if d.slots != nil {
+		logging.Downloader.Debug("🔧 Final download concurrency", "concurrency", d.slots.current(), "max", cfg.MaxConcurrentJobs)
+	}
+
+	for _, res := range ordered {
+		if res != nil {
+			downloads = append(downloads, Result{
+				Source:     res.source,
+				Content:    res.content,
+				Stale:      res.stale,
+				StaleSince: res.staleSince,
+			})
+		}
+	}
+	return downloads, failed, outcomes, nil
+}
+
+// verifyPin 校验内容的 SHA-256 是否与源上固定的哈希一致。
+// pin 为 warn 时只记录警告，否则拒绝该内容。
+func verifyPin(src source.Source, body []byte) error {
+	sum := sha256.Sum256(body)
+	got := hex.EncodeToString(sum[:])
+	logging.Downloader.Debug("🔐 Content checksum", "source", src.Name, "sha256", got)
+	if src.SHA256 == "" || got == src.SHA256 {
+		return nil
+	}
+	if src.Pin == source.PinWarn {
+		logging.Downloader.Warn("⚠️ Content changed", "source", src.Name, "sha256", got, "pinned", src.SHA256)
+		return nil
+	}
+	return errNotRetryable{fmt.Errorf("sha256 mismatch: got %s, pinned %s", got, src.SHA256)}
+}
@@ -0,0 +1,181 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"adguardlist/internal/source"
+)
+
+// testConfig 返回不限速、重试间隔很短、缓存位于临时目录的下载配置。
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.CacheDir = t.TempDir()
+	cfg.GitCacheDir = t.TempDir()
+	cfg.NetrcFile = ""
+	cfg.RateLimit = RateLimitConfig{}
+	cfg.Retry = RetryConfig{Count: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxRetryAfter: time.Second}
+	t.Setenv("NETRC", "/nonexistent")
+	return cfg
+}
+
+// testSource 返回指向 url 的源。
+func testSource(url string) source.Source {
+	return source.Source{Name: "test", URL: url, Format: "auto"}
+}
+
+func TestFetchWithRetry(t *testing.T) {
+	const body = "||ads.example.com^\n"
+	tests := []struct {
+		name         string
+		responses    []int // 依次返回的状态码，用完后重复最后一个
+		retryAfter   string
+		maxSize      source.ByteSize
+		wantErr      string
+		wantRequests int32
+	}{
+		{name: "success", responses: []int{200}, wantRequests: 1},
+		{name: "server errors are retried", responses: []int{500, 502, 200}, wantRequests: 3},
+		{name: "retries are limited", responses: []int{500}, wantErr: "500", wantRequests: 3},
+		{name: "client errors are not retried", responses: []int{404}, wantErr: "404", wantRequests: 1},
+		{name: "short Retry-After is honored", responses: []int{429, 200}, retryAfter: "0", wantRequests: 2},
+		{name: "long Retry-After gives up", responses: []int{503}, retryAfter: "120", wantErr: "max_retry_after", wantRequests: 1},
+		{name: "oversized response is rejected", responses: []int{200}, maxSize: 8, wantErr: "exceeds max size", wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1)) - 1
+				status := tt.responses[min(n, len(tt.responses)-1)]
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(body))
+				}
+			}))
+			defer srv.Close()
+
+			cfg := testConfig(t)
+			cfg.MaxSize = tt.maxSize
+			d, err := New(&cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := d.fetchWithRetry(context.Background(), testSource(srv.URL))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("fetchWithRetry() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("fetchWithRetry() error = %v, want it to contain %q", err, tt.wantErr)
+			case tt.wantErr == "" && string(got) != body:
+				t.Errorf("fetchWithRetry() = %q, want %q", got, body)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"-5", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("ParseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+// 第二次下载带上缓存的 ETag 与 Last-Modified，304 响应复用缓存的内容；服务器出错时回退到缓存。
+func TestFetchConditionalRequestAndFallback(t *testing.T) {
+	const body = "||ads.example.com^\n"
+	const lastModified = "Wed, 14 Oct 2026 12:00:00 GMT"
+	var fail atomic.Bool
+	var conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == lastModified {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t)
+	src := testSource(srv.URL)
+	for i := 0; i < 2; i++ {
+		downloads, failed, _, err := All(context.Background(), &cfg, []source.Source{src})
+		if err != nil || len(failed) != 0 || len(downloads) != 1 || string(downloads[0].Content) != body || downloads[0].Stale {
+			t.Fatalf("download %d = %+v, failed %v, error %v", i+1, downloads, failed, err)
+		}
+	}
+	if n := conditional.Load(); n != 1 {
+		t.Errorf("conditional requests answered with 304 = %d, want 1", n)
+	}
+
+	fail.Store(true)
+	downloads, failed, outcomes, err := All(context.Background(), &cfg, []source.Source{src})
+	if err != nil || len(failed) != 0 || len(downloads) != 1 || !downloads[0].Stale || string(downloads[0].Content) != body {
+		t.Fatalf("fallback download = %+v, failed %v, error %v", downloads, failed, err)
+	}
+	if outcomes[src.URL].Err == nil {
+		t.Error("outcome of the stale download has no error")
+	}
+
+	cfg.CacheFallback = false
+	if _, failed, _, _ := All(context.Background(), &cfg, []source.Source{src}); len(failed) != 1 {
+		t.Errorf("failed = %v, want the source to fail without cache_fallback", failed)
+	}
+}
+
+// 固定了 sha256 的源内容不符时不重试，pin 为 warn 时只记录警告。
+func TestFetchPinnedSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("||ads.example.com^\n"))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t)
+	d, err := New(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := testSource(srv.URL)
+	src.SHA256 = strings.Repeat("0", 64)
+	var permanent errNotRetryable
+	if _, err := d.fetchWithRetry(context.Background(), src); !errors.As(err, &permanent) {
+		t.Errorf("fetchWithRetry() error = %v, want a non-retryable sha256 mismatch", err)
+	}
+	src.Pin = source.PinWarn
+	if _, err := d.fetchWithRetry(context.Background(), src); err != nil {
+		t.Errorf("fetchWithRetry() with pin warn error = %v", err)
+	}
+}
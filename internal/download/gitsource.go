@@ -0,0 +1,91 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/source"
+)
+
+// gitLocks 避免多个源同时操作同一个仓库的本地克隆。
+var gitLocks sync.Map
+
+// fetchGitSource 在 cacheDir 中维护仓库的 bare 克隆（首次克隆，之后 fetch 更新），
+// 并读取 ref（默认为远端默认分支）下 path 文件的内容。文件超过 maxSize 时不读取。
+func fetchGitSource(ctx context.Context, cacheDir string, src source.Source, maxSize source.ByteSize) ([]byte, error) {
+	sum := sha256.Sum256([]byte(src.Git))
+	dir := filepath.Join(cacheDir, hex.EncodeToString(sum[:8]))
+
+	lock, _ := gitLocks.LoadOrStore(dir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return nil, errNotRetryable{err}
+		}
+		os.RemoveAll(dir)
+		logging.Downloader.Debug("📥 Cloning", "repository", src.Git)
+		if _, err := RunGit(ctx, "", "clone", "--quiet", "--bare", "--", src.Git, dir); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	} else {
+		logging.Downloader.Debug("🔄 Fetching", "repository", src.Git)
+		if _, err := RunGit(ctx, dir, "fetch", "--quiet", "--prune", "--tags", "origin", "+refs/heads/*:refs/heads/*"); err != nil {
+			return nil, err
+		}
+	}
+
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// object 以 source.Normalize 校验过的 ref 开头，不会被当作选项（cat-file 不接受 "--"）
+	object := ref + ":" + src.Path
+	if maxSize > 0 {
+		out, err := RunGit(ctx, dir, "cat-file", "-s", object)
+		if err != nil {
+			return nil, errNotRetryable{err}
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		if err != nil {
+			return nil, errNotRetryable{fmt.Errorf("unexpected git cat-file output %q", out)}
+		}
+		if size > int64(maxSize) {
+			return nil, errNotRetryable{fmt.Errorf("file size %d exceeds max size of %s", size, maxSize)}
+		}
+	}
+	body, err := RunGit(ctx, dir, "show", object, "--")
+	if err != nil {
+		return nil, errNotRetryable{err}
+	}
+	if len(body) == 0 {
+		return nil, errNotRetryable{fmt.Errorf("%s is empty at %s", src.Path, ref)}
+	}
+	return body, nil
+}
+
+// RunGit 在 dir 中执行 git 命令并返回标准输出，失败时错误中附带标准错误输出。
+func RunGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
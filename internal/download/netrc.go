@@ -0,0 +1,129 @@
+package download
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcEntry 是 .netrc 中一台主机的登录信息。
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrc 保存按主机名索引的凭据。nil 表示没有可用凭据。
+type netrc struct {
+	machines map[string]netrcEntry
+}
+
+// netrcPath 返回要读取的 .netrc 路径：优先使用配置，其次是 NETRC 环境变量，最后是 ~/.netrc。
+func netrcPath(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if env := os.Getenv("NETRC"); env != "" {
+		return env
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// loadNetrc 读取并解析 path。required 为 false 时文件不存在不算错误。
+func loadNetrc(path string, required bool) (*netrc, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	n := parseNetrc(string(data))
+	if len(n.machines) == 0 {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// parseNetrc 解析 .netrc 内容，支持 machine、login、password 与 account，跳过 macdef 宏定义。
+// default 条目会被忽略，避免把凭据发送给列表中的公共主机。
+func parseNetrc(data string) *netrc {
+	n := &netrc{machines: make(map[string]netrcEntry)}
+	var (
+		current *netrcEntry
+		host    string
+	)
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if _, ok := n.machines[host]; host != "" && !ok {
+			// 与 curl 一致，同一主机以第一个条目为准
+			n.machines[host] = *current
+		}
+		current = nil
+	}
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			if strings.HasPrefix(fields[j], "#") {
+				break
+			}
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				flush()
+				host = strings.ToLower(next())
+				current = &netrcEntry{}
+			case "default":
+				flush()
+				host = ""
+				current = &netrcEntry{}
+			case "login":
+				if v := next(); current != nil {
+					current.login = v
+				}
+			case "password":
+				if v := next(); current != nil {
+					current.password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				// 宏定义持续到下一个空行
+				flush()
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	flush()
+	return n
+}
+
+// lookup 返回 host 对应的凭据。
+func (n *netrc) lookup(host string) (netrcEntry, bool) {
+	if n == nil {
+		return netrcEntry{}, false
+	}
+	e, ok := n.machines[strings.ToLower(host)]
+	return e, ok
+}
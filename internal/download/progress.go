@@ -0,0 +1,174 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress 是下载阶段的进度显示，stderr 不是终端或处于 quiet 模式时为 nil。
+var Progress *progressDisplay
+
+// progressInterval 是进度行的刷新间隔。
+const progressInterval = 200 * time.Millisecond
+
+// progressDisplay 在终端最后一行显示下载进度。它同时作为日志的输出：
+// 写入日志前先清除进度行，写入后重绘，两者不会交错。所有方法在 nil 上调用时不做任何事。
+type progressDisplay struct {
+	out   io.Writer
+	bytes atomic.Int64
+
+	mu                  sync.Mutex
+	line                string // 当前显示的进度行，为空表示没有显示
+	total, done, failed int
+	started             time.Time
+	stop                chan struct{}
+	stopped             chan struct{}
+}
+
+// NewProgress 在 f 是终端时返回进度显示，否则返回 nil。
+func NewProgress(f *os.File) *progressDisplay {
+	if os.Getenv("TERM") == "dumb" {
+		return nil
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progressDisplay{out: f}
+}
+
+// Write 实现 io.Writer，用作日志的输出。
+func (p *progressDisplay) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != "" {
+		io.WriteString(p.out, "\r\033[K")
+	}
+	n, err := p.out.Write(b)
+	if p.line != "" {
+		io.WriteString(p.out, p.line)
+	}
+	return n, err
+}
+
+// start 开始显示 total 个源的下载进度，并定期刷新已下载的字节数与预计剩余时间。
+func (p *progressDisplay) start(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.total, p.done, p.failed = total, 0, 0
+	p.bytes.Store(0)
+	p.started = time.Now()
+	p.stop, p.stopped = make(chan struct{}), make(chan struct{})
+	p.redraw()
+	p.mu.Unlock()
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// sourceDone 记录一个源下载完成，failed 表示下载失败且没有可用的缓存。
+func (p *progressDisplay) sourceDone(failed bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if failed {
+		p.failed++
+	}
+	p.redraw()
+}
+
+// addBytes 累加已下载的字节数。
+func (p *progressDisplay) addBytes(n int) {
+	if p == nil {
+		return
+	}
+	p.bytes.Add(int64(n))
+}
+
+// countReader 返回统计读取字节数的 r。
+func (p *progressDisplay) countReader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &countingReader{r: r, p: p}
+}
+
+// finish 停止刷新并清除进度行。
+func (p *progressDisplay) finish() {
+	if p == nil || p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != "" {
+		io.WriteString(p.out, "\r\033[K")
+		p.line = ""
+	}
+	p.stop = nil
+}
+
+// redraw 重新生成并输出进度行，调用方需持有 p.mu。
+func (p *progressDisplay) redraw() {
+	elapsed := time.Since(p.started)
+	eta := "--"
+	if p.done > 0 && p.done < p.total {
+		remaining := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+		eta = remaining.Round(time.Second).String()
+	} else if p.done == p.total {
+		eta = "0s"
+	}
+	p.line = fmt.Sprintf("⬇️ %d/%d sources, %d failed, %d remaining, %s, elapsed %s, ETA %s",
+		p.done-p.failed, p.total, p.failed, p.total-p.done, FormatBytes(p.bytes.Load()),
+		elapsed.Round(time.Second), eta)
+	io.WriteString(p.out, "\r\033[K"+p.line)
+}
+
+// countingReader 在读取时累加 progressDisplay 的字节数。
+type countingReader struct {
+	r io.Reader
+	p *progressDisplay
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.p.addBytes(n)
+	return n, err
+}
+
+// FormatBytes 以 1024 进位、保留一位小数输出字节数。
+func FormatBytes(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
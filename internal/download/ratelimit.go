@@ -0,0 +1,122 @@
+package download
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig 控制对同一主机的请求频率。
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// TokenBucket 是一个简单的令牌桶：以 rate 个/秒的速度补充令牌，最多累积 burst 个。
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	paused time.Time // 服务器要求暂停（Retry-After）时，在此时间之前不发放令牌
+}
+
+// NewTokenBucket 返回以 rate 个/秒补充、最多累积 burst 个令牌的令牌桶，初始时令牌是满的。
+func NewTokenBucket(rate, burst float64) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait 阻塞直到取得一个令牌或 ctx 结束。
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		if now.Before(b.paused) {
+			delay := b.paused.Sub(now)
+			b.mu.Unlock()
+			if err := SleepContext(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := SleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Pause 在 until 之前停止发放令牌，已有更晚的暂停时间时不变。
+func (b *TokenBucket) Pause(until time.Time) {
+	b.mu.Lock()
+	if until.After(b.paused) {
+		b.paused = until
+	}
+	b.mu.Unlock()
+}
+
+// hostLimiter 为每个主机维护独立的令牌桶。nil 表示不限速。
+type hostLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*TokenBucket
+}
+
+// newHostLimiter 根据配置创建限速器，requests_per_second 不大于 0 时返回 nil。
+func newHostLimiter(cfg RateLimitConfig) *hostLimiter {
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := cfg.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		rate:    cfg.RequestsPerSecond,
+		burst:   float64(burst),
+		buckets: make(map[string]*TokenBucket),
+	}
+}
+
+// wait 阻塞直到允许向 host 发送下一个请求。
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if l == nil {
+		return nil
+	}
+	return l.bucket(host).Wait(ctx)
+}
+
+// pause 让发往 host 的请求暂停到 until，用于遵守服务器返回的 Retry-After。
+func (l *hostLimiter) pause(host string, until time.Time) {
+	if l == nil {
+		return
+	}
+	l.bucket(host).Pause(until)
+}
+
+// bucket 返回 host 对应的令牌桶，不存在时创建。
+func (l *hostLimiter) bucket(host string) *TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = NewTokenBucket(l.rate, l.burst)
+		l.buckets[host] = b
+	}
+	return b
+}
@@ -0,0 +1,205 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ResolverConfig 指定下载使用的 DNS 解析器，Address 为空时使用系统解析器。
+type ResolverConfig struct {
+	Address   string `yaml:"address"`
+	Bootstrap string `yaml:"bootstrap"`
+}
+
+// maxDNSMessage 是 DNS 消息的最大长度。
+const maxDNSMessage = 65535
+
+// NewResolver 根据配置创建下载使用的 DNS 解析器，address 为空时返回 nil 表示使用系统解析器。
+// address 支持以下形式：
+//
+//	1.1.1.1、udp://1.1.1.1:53、tcp://1.1.1.1:53   普通 DNS
+//	tls://dns.google 或 tls://8.8.8.8:853          DNS over TLS
+//	https://cloudflare-dns.com/dns-query           DNS over HTTPS
+//
+// DoT/DoH 服务器地址中的主机名由 bootstrap（普通 DNS 的 IP 地址）解析，未配置时使用系统解析器。
+func NewResolver(cfg ResolverConfig) (*net.Resolver, error) {
+	raw := strings.TrimSpace(cfg.Address)
+	if raw == "" {
+		return nil, nil
+	}
+	bootstrap, err := bootstrapResolver(cfg.Bootstrap)
+	if err != nil {
+		return nil, err
+	}
+
+	network, addr := "", raw
+	if i := strings.Index(raw, "://"); i >= 0 {
+		network, addr = raw[:i], raw[i+3:]
+	}
+	var dial func(ctx context.Context, network, address string) (net.Conn, error)
+	switch network {
+	case "", "udp", "tcp":
+		server, err := withDefaultPort(addr, "53")
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolver %q: %w", raw, err)
+		}
+		dial = func(ctx context.Context, netw, _ string) (net.Conn, error) {
+			if network != "" {
+				netw = network
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, netw, server)
+		}
+	case "tls":
+		server, err := withDefaultPort(addr, "853")
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolver %q: %w", raw, err)
+		}
+		host, _, _ := net.SplitHostPort(server)
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{Resolver: bootstrap},
+			Config:    &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+		}
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", server)
+		}
+	case "https":
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid resolver %q", raw)
+		}
+		transport := &http.Transport{
+			DialContext:       (&net.Dialer{Resolver: bootstrap}).DialContext,
+			ForceAttemptHTTP2: true,
+			IdleConnTimeout:   90 * time.Second,
+		}
+		client := &http.Client{Transport: transport}
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, client: client, endpoint: raw}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported resolver scheme %q", network)
+	}
+	return &net.Resolver{PreferGo: true, Dial: dial}, nil
+}
+
+// bootstrapResolver 返回用于解析 DoT/DoH 服务器主机名的普通 DNS 解析器，addr 为空时返回系统解析器。
+func bootstrapResolver(addr string) (*net.Resolver, error) {
+	if addr = strings.TrimSpace(addr); addr == "" {
+		return nil, nil
+	}
+	server, err := withDefaultPort(addr, "53")
+	if err != nil {
+		return nil, fmt.Errorf("invalid resolver bootstrap %q: %w", addr, err)
+	}
+	if host, _, _ := net.SplitHostPort(server); net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("resolver bootstrap %q must be an IP address", addr)
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}, nil
+}
+
+// withDefaultPort 在 addr 未带端口时补上 port。
+func withDefaultPort(addr, port string) (string, error) {
+	if addr == "" {
+		return "", fmt.Errorf("empty address")
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr, nil
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port), nil
+}
+
+// dohConn 把 Go 解析器的 TCP 格式 DNS 查询（2 字节长度前缀 + 消息）转换为 DoH 请求（RFC 8484）。
+// 它没有实现 net.PacketConn，因此解析器总是按流式格式读写。
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	deadline time.Time
+
+	query    bytes.Buffer
+	response *bytes.Reader
+}
+
+func (c *dohConn) Write(p []byte) (int, error) {
+	return c.query.Write(p)
+}
+
+func (c *dohConn) Read(p []byte) (int, error) {
+	if c.response == nil {
+		resp, err := c.exchange()
+		if err != nil {
+			return 0, err
+		}
+		c.response = bytes.NewReader(resp)
+	}
+	return c.response.Read(p)
+}
+
+// exchange 发送缓冲区中的查询，并返回带长度前缀的响应。
+func (c *dohConn) exchange() ([]byte, error) {
+	q := c.query.Bytes()
+	if len(q) < 2 || len(q) < 2+int(binary.BigEndian.Uint16(q)) {
+		return nil, fmt.Errorf("doh: incomplete dns query")
+	}
+	msg := q[2 : 2+int(binary.BigEndian.Uint16(q))]
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("doh: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: bad status: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessage+1))
+	if err != nil {
+		return nil, fmt.Errorf("doh: %w", err)
+	}
+	if len(body) > maxDNSMessage {
+		return nil, fmt.Errorf("doh: response too large")
+	}
+	out := make([]byte, 2, 2+len(body))
+	binary.BigEndian.PutUint16(out, uint16(len(body)))
+	return append(out, body...), nil
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr{} }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { c.deadline = t; return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// dohAddr 是 dohConn 的占位地址。
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
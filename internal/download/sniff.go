@@ -0,0 +1,92 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLines 是判断内容是否为规则列表时检查的非空行数。
+const sniffLines = 200
+
+// checkListContent 检查下载内容确实是规则列表，而不是被当作列表返回的 HTML 页面
+// （如强制门户、Cloudflare 验证页或托管平台的错误页）。
+// 此类页面通常是暂时性的，因此返回的错误允许重试，失败后仍可回退到缓存。
+func checkListContent(body []byte, contentType string) error {
+	sniffed := http.DetectContentType(body)
+	if strings.HasPrefix(sniffed, "text/html") || strings.HasPrefix(sniffed, "text/xml") {
+		return fmt.Errorf("response is an HTML page, not a filter list%s", describeTitle(body))
+	}
+	// 部分服务器会把纯文本列表标为 text/html，因此只有正文也像标记语言时才拒绝
+	if isMarkupType(contentType) && markupRatio(body) > 0.5 {
+		return fmt.Errorf("response served as %s does not look like a filter list%s", contentType, describeTitle(body))
+	}
+	return nil
+}
+
+// isMarkupType 判断 Content-Type 是否声明为 HTML/XML 文档。
+func isMarkupType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/xml", "application/xml":
+		return true
+	}
+	return false
+}
+
+// markupRatio 返回前 sniffLines 个非空行中形如 HTML 标签的行所占比例。
+func markupRatio(body []byte) float64 {
+	var total, markup int
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		total++
+		if line[0] == '<' && bytes.IndexByte(line, '>') > 0 {
+			markup++
+		}
+		if total >= sniffLines {
+			break
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(markup) / float64(total)
+}
+
+// describeTitle 提取页面的 <title> 用于错误信息，便于判断是哪类错误页。
+func describeTitle(body []byte) string {
+	lower := bytes.ToLower(body)
+	if len(lower) != len(body) {
+		// 大小写转换改变了字节长度时下标无法对应，退而使用小写内容
+		body = lower
+	}
+	start := bytes.Index(lower, []byte("<title"))
+	if start < 0 {
+		return ""
+	}
+	open := bytes.IndexByte(lower[start:], '>')
+	if open < 0 {
+		return ""
+	}
+	start += open + 1
+	end := bytes.Index(lower[start:], []byte("</title>"))
+	if end < 0 {
+		return ""
+	}
+	title := strings.Join(strings.Fields(string(body[start:start+end])), " ")
+	if title == "" {
+		return ""
+	}
+	if r := []rune(title); len(r) > 80 {
+		title = string(r[:80]) + "..."
+	}
+	return fmt.Sprintf(" (title %q)", title)
+}
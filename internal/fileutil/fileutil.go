@@ -0,0 +1,29 @@
+// Package fileutil 提供写入输出文件的辅助函数。
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic 先写入同目录下的临时文件再重命名，
+// 构建中途被中断时不会留下写了一半的输出文件。
+func WriteAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,298 @@
+// Package list 是构建规则列表的入口：Builder 组合下载、编译与输出的配置，按阶段下载规则源、
+// 编译合并列表并写出输出与发布目录。Build 依次执行全部阶段；命令行的 build 子命令逐个调用
+// 各阶段，在其间插入隔离、健康度、变更日志、历史、通知与外部发布等步骤。
+package list
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"adguardlist/internal/compile"
+	"adguardlist/internal/download"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/publish"
+	"adguardlist/internal/source"
+	"adguardlist/internal/transform"
+)
+
+// Builder 按选项构建一份规则列表，由 New 创建。
+type Builder struct {
+	sources      []source.Source
+	download     download.Config
+	compile      compile.Config
+	output       output.Config
+	aliases      map[string]string
+	timeout      time.Duration
+	maxShrink    float64
+	keepPrevious bool
+}
+
+// Option 修改 Builder 的配置。
+type Option func(b *Builder)
+
+// New 创建 Builder 并依次应用 opts。下载、编译与输出使用与配置文件相同的默认值，
+// 不限制构建时间，也不检查规则数的缩水。
+func New(opts ...Option) *Builder {
+	b := &Builder{
+		download: download.DefaultConfig(),
+		compile:  compile.DefaultConfig(),
+		output:   output.DefaultConfig(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithSources 追加参与构建的规则源，未启用的源不会下载。
+func WithSources(sources ...source.Source) Option {
+	return func(b *Builder) {
+		b.sources = append(b.sources, sources...)
+	}
+}
+
+// WithTransforms 设置对合并列表应用的转换，替换默认的转换；可用的名称见 transform.Known。
+func WithTransforms(names ...string) Option {
+	return func(b *Builder) {
+		b.compile.Transformations = names
+	}
+}
+
+// WithOutputs 设置与 AdGuard 规则列表一同生成的额外输出格式。
+func WithOutputs(formats ...output.FormatConfig) Option {
+	return func(b *Builder) {
+		b.output.Outputs = formats
+	}
+}
+
+// WithOutputDir 设置输出目录与发布目录，默认分别为 rules 与 publish。
+func WithOutputDir(outputDir, publishDir string) Option {
+	return func(b *Builder) {
+		b.output.OutputDir, b.output.PublishDir = outputDir, publishDir
+	}
+}
+
+// WithConcurrency 设置同时下载的源数量上限。
+func WithConcurrency(n int) Option {
+	return func(b *Builder) {
+		b.download.MaxConcurrentJobs = n
+	}
+}
+
+// WithDownloadConfig 替换全部下载配置，需放在 WithConcurrency 之前，否则会覆盖其设置。
+func WithDownloadConfig(cfg download.Config) Option {
+	return func(b *Builder) {
+		b.download = cfg
+	}
+}
+
+// WithCompileConfig 替换全部编译配置，需放在 WithTransforms 之前，否则会覆盖其设置。
+func WithCompileConfig(cfg compile.Config) Option {
+	return func(b *Builder) {
+		b.compile = cfg
+	}
+}
+
+// WithOutputConfig 替换全部输出配置，需放在 WithOutputs 与 WithOutputDir 之前，否则会覆盖其设置。
+func WithOutputConfig(cfg output.Config) Option {
+	return func(b *Builder) {
+		b.output = cfg
+	}
+}
+
+// WithAliases 设置发布文件的副本（新文件名到原文件名），见 publish.Config.Aliases。
+func WithAliases(aliases map[string]string) Option {
+	return func(b *Builder) {
+		b.aliases = aliases
+	}
+}
+
+// WithTimeout 设置整个构建的时限，超时后中止构建；0 表示不限制。
+func WithTimeout(d time.Duration) Option {
+	return func(b *Builder) {
+		b.timeout = d
+	}
+}
+
+// WithMaxShrink 设置允许的规则数降幅（百分比），新列表比上一次发布的列表减少更多时构建失败；0 表示不检查。
+func WithMaxShrink(percent float64) Option {
+	return func(b *Builder) {
+		b.maxShrink = percent
+	}
+}
+
+// WithPrevious 设置是否总是读取上一次发布的列表并记入结果的 Previous，
+// 用于变更日志与作业摘要；启用增量补丁时无论如何都会读取。
+func WithPrevious(keep bool) Option {
+	return func(b *Builder) {
+		b.keepPrevious = keep
+	}
+}
+
+// Check 检查 Builder 的配置是否合法，并填充额外输出格式等的默认值。
+func (b *Builder) Check() error {
+	if err := b.download.Check(); err != nil {
+		return err
+	}
+	if err := b.compile.Check(); err != nil {
+		return err
+	}
+	if err := b.output.Check(); err != nil {
+		return err
+	}
+	if err := publish.Check(publish.Config{Aliases: b.aliases}); err != nil {
+		return err
+	}
+	if b.timeout < 0 {
+		return fmt.Errorf("build timeout must not be negative, got %s", b.timeout)
+	}
+	if b.maxShrink < 0 || b.maxShrink > 100 {
+		return fmt.Errorf("max shrink percent must be between 0 and 100, got %g", b.maxShrink)
+	}
+	return nil
+}
+
+// Context 返回应用了构建时限的 ctx，没有时限时原样返回。
+func (b *Builder) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.timeout > 0 {
+		return context.WithTimeout(ctx, b.timeout)
+	}
+	return ctx, func() {}
+}
+
+// Build 依次执行 Download、Compile 与 Package，下载全部启用的源，写出规则列表、额外输出、报告、
+// 压缩副本、校验和、签名与索引页。返回的结果记录各源的下载情况、统计、写入的发布文件与各阶段的耗时；
+// 没有源下载成功、规则数缩水过多、超时或 ctx 被取消时返回错误，不会写出不完整的输出。
+func (b *Builder) Build(ctx context.Context) (*output.Result, error) {
+	if err := b.Check(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := b.Context(ctx)
+	defer cancel()
+	sources, err := source.Normalize(append([]source.Source(nil), b.sources...))
+	if err != nil {
+		return nil, err
+	}
+	res := &output.Result{Sources: source.Enabled(sources)}
+	if len(res.Sources) == 0 {
+		return nil, fmt.Errorf("no enabled sources to build")
+	}
+	if err := b.Download(ctx, res); err != nil {
+		return nil, err
+	}
+	if err := b.Compile(ctx, res); err != nil {
+		return nil, err
+	}
+	stageStart := time.Now()
+	if err := b.Package(ctx, res); err != nil {
+		return nil, err
+	}
+	res.TimeStage("publish", stageStart)
+	return res, nil
+}
+
+// Download 并发下载 res.Sources，结果记入 res 的 Downloads、Failed 与 Outcomes，耗时记为 download 阶段。
+// 部分源下载失败不是错误，是否继续构建由调用者决定。
+func (b *Builder) Download(ctx context.Context, res *output.Result) error {
+	stageStart := time.Now()
+	var err error
+	res.Downloads, res.Failed, res.Outcomes, err = download.All(ctx, &b.download, res.Sources)
+	if err != nil {
+		return err
+	}
+	res.TimeStage("download", stageStart)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("build aborted during download: %w", err)
+	}
+	return nil
+}
+
+// Compile 编译 res.Downloads 并写入列表及其额外输出，写入的发布文件记录在 res.Published 中。
+// 报告与输出都在缩水检查之后写入；merge、compile、transform 与 write 各阶段的耗时记录在 res.Timings 中。
+func (b *Builder) Compile(ctx context.Context, res *output.Result) error {
+	if len(res.Downloads) == 0 {
+		return fmt.Errorf("no rules were downloaded successfully")
+	}
+	logging.Compiler.Info("⚙️ Compiling rules...")
+	compiled := compile.Compile(&b.compile, res.Downloads, output.CollectFor(&b.output))
+	res.Timings = append(res.Timings,
+		output.StageTiming{Name: "merge", Duration: compiled.MergeTime},
+		output.StageTiming{Name: "compile", Duration: compiled.CompileTime})
+	stageStart := time.Now()
+	res.Stats = compiled.Stats
+	compile.LogDuplicates(compiled.Stats)
+	compile.LogContributions(compiled.Stats)
+	if err := compile.Refine(ctx, &b.compile, compiled, res.Downloads); err != nil {
+		return err
+	}
+	res.Dead, res.Excluded, res.Truncated, res.MaxRules = compiled.Dead, compiled.Excluded, compiled.Truncated, b.compile.MaxRules
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("build aborted during compilation: %w", err)
+	}
+	res.TimeStage("transform", stageStart)
+
+	// 生成最终的输出文件
+	stageStart = time.Now()
+	logging.Publisher.Info("📝 Generating final output file...")
+	res.RuleCount = transform.CountRules(compiled.Content)
+	keepPrevious := b.keepPrevious || b.output.Deltas.Enabled
+	if b.maxShrink > 0 || keepPrevious {
+		previous, err := output.ReadPrevious(&b.output)
+		if err != nil {
+			return err
+		}
+		if err := b.checkShrinkage(res.RuleCount, previous); err != nil {
+			return err
+		}
+		if keepPrevious {
+			res.Previous = previous
+		}
+	}
+	res.BuildTime = time.Now()
+	res.Content = append(output.RenderHeader(&b.output, res), compiled.Content...)
+
+	// 通过缩水检查后创建目录并写入报告与文件
+	if err := output.WriteSourceReport(&b.output, compiled.Stats); err != nil {
+		return err
+	}
+	if err := output.WriteRejectedReport(&b.output, compiled.Rejected); err != nil {
+		return err
+	}
+	if err := output.WriteConflictReport(&b.output, compiled.Conflicts); err != nil {
+		return err
+	}
+	if err := output.WriteOutputs(&b.output, res); err != nil {
+		return err
+	}
+	if err := output.WriteExtraOutputs(&b.output, res, compiled); err != nil {
+		return err
+	}
+	if err := output.WriteCategoryOutputs(&b.output, res, compiled); err != nil {
+		return err
+	}
+	if err := output.WriteDeltas(&b.output, res); err != nil {
+		return err
+	}
+	res.TimeStage("write", stageStart)
+	return nil
+}
+
+// Package 为 res.Published 中的全部发布文件生成压缩副本、别名副本、校验和与签名，并生成索引页。
+// 耗时不单独记录，由调用者与其他发布步骤一起记为 publish 阶段。
+func (b *Builder) Package(ctx context.Context, res *output.Result) error {
+	if err := output.WriteCompressed(&b.output, res); err != nil {
+		return err
+	}
+	if err := publish.WriteAliases(&publish.Config{Aliases: b.aliases}, &b.output, res); err != nil {
+		return err
+	}
+	if err := output.WriteChecksums(&b.output, res); err != nil {
+		return err
+	}
+	if err := output.SignPublished(ctx, &b.output, res); err != nil {
+		return err
+	}
+	return output.WriteIndex(&b.output, res)
+}
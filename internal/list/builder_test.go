@@ -0,0 +1,78 @@
+package list
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/output"
+	"adguardlist/internal/source"
+)
+
+// 从 file:// 源构建列表，写出规则列表、额外输出与校验和；第二次构建的规则数缩水过多时拒绝发布。
+func TestBuildLocalSource(t *testing.T) {
+	dir := t.TempDir()
+	listPath := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(listPath, []byte("! local list\n||ads.example.com^\n0.0.0.0 tracker.example.net\n||ads.example.com^\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dl := download.DefaultConfig()
+	dl.CacheDir, dl.GitCacheDir = filepath.Join(dir, "cache"), filepath.Join(dir, "git")
+	outputDir, publishDir := filepath.Join(dir, "rules"), filepath.Join(dir, "publish")
+	newBuilder := func() *Builder {
+		return New(
+			WithSources(source.Source{Name: "local", URL: "file://" + listPath}),
+			WithDownloadConfig(dl),
+			WithOutputDir(outputDir, publishDir),
+			WithOutputs(output.FormatConfig{Format: "hosts"}),
+			WithMaxShrink(50),
+		)
+	}
+
+	res, err := newBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if res.RuleCount != 2 || len(res.Failed) != 0 {
+		t.Errorf("Build() rules = %d, failed = %v, want 2 rules and no failures", res.RuleCount, res.Failed)
+	}
+	content, err := os.ReadFile(filepath.Join(publishDir, "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range []string{"||ads.example.com^\n", "||tracker.example.net^\n"} {
+		if strings.Count(string(content), rule) != 1 {
+			t.Errorf("output.txt = %q, want %q exactly once", content, rule)
+		}
+	}
+	hosts, err := os.ReadFile(filepath.Join(publishDir, "hosts.txt"))
+	if err != nil || !strings.Contains(string(hosts), "0.0.0.0 tracker.example.net\n") {
+		t.Errorf("hosts.txt = %q, error %v, want the tracker domain", hosts, err)
+	}
+	for _, name := range []string{"output.txt", "hosts.txt", "SHA256SUMS"} {
+		if _, err := os.Stat(filepath.Join(publishDir, name)); err != nil || !slices.Contains(res.Published, name) {
+			t.Errorf("%s was not published: %v, published %v", name, err, res.Published)
+		}
+	}
+
+	// 源只剩一条规则，比上一次发布的列表少 50%，仍在允许范围内；清空后被拒绝
+	if err := os.WriteFile(listPath, []byte("||ads.example.com^\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newBuilder().Build(context.Background()); err != nil {
+		t.Fatalf("Build() with half the rules error = %v", err)
+	}
+	if err := os.WriteFile(listPath, []byte("! nothing left\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newBuilder().Build(context.Background()); err == nil || !strings.Contains(err.Error(), "max_shrink_percent") {
+		t.Errorf("Build() of an emptied list error = %v, want the shrink check to refuse it", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(publishDir, "output.txt")); !strings.Contains(string(got), "||ads.example.com^\n") {
+		t.Errorf("refused build changed output.txt to %q", got)
+	}
+}
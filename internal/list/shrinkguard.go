@@ -0,0 +1,28 @@
+package list
+
+import (
+	"fmt"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// checkShrinkage 将新列表的规则数与上一次发布的列表 previous（见 output.ReadPrevious）比较，
+// 减少超过 b.maxShrink（配置文件中的 max_shrink_percent）时返回错误。检查在写入任何报告与输出之前进行，
+// 被拒绝的构建不会改动已发布的文件。上游部分源暂时返回空内容或截断的内容时，这可以避免发布一个明显缩水的列表。
+func (b *Builder) checkShrinkage(rules int, previous []byte) error {
+	if b.maxShrink <= 0 || previous == nil {
+		return nil
+	}
+	prev := transform.CountRules(previous)
+	if prev == 0 {
+		return nil
+	}
+	shrink := float64(prev-rules) / float64(prev) * 100
+	if shrink > b.maxShrink {
+		return fmt.Errorf("refusing to publish %s: %d rules is %.1f%% fewer than the previous %d (max_shrink_percent %g); "+
+			"check the failed or truncated sources, or run build -force to publish anyway", b.output.OutputFile, rules, shrink, prev, b.maxShrink)
+	}
+	logging.Compiler.Debug("📏 Rule count compared with the previous list", "file", b.output.OutputFile, "rules", rules, "previous", prev)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package logging 设置日志的格式与级别，并提供各组件使用的日志记录器。
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Config 控制日志的格式与级别，命令行的 -log-format、-log-level 与 -v 优先于配置文件。
+type Config struct {
+	Format string `yaml:"format"` // text 或 json
+	Level  string `yaml:"level"`  // debug、info、warn 或 error
+}
+
+// 日志格式。
+const (
+	FormatText    = "text"
+	logFormatJSON = "json"
+)
+
+// 各组件的日志记录器，由 Setup 设置，每条日志带有 component 字段。
+// 不属于任何组件的日志（构建流程、子命令）使用 slog 的默认记录器。
+var (
+	Downloader = slog.Default() // 下载、缓存与 Git 源
+	Merger     = slog.Default() // 源格式转换、跨源去重与统计
+	Compiler   = slog.Default() // 编译与编译后的规则处理
+	Publisher  = slog.Default() // 写入输出、压缩、签名与报告
+)
+
+// Check 校验日志格式与级别。
+func Check(lc Config) error {
+	if lc.Format != FormatText && lc.Format != logFormatJSON {
+		return fmt.Errorf("logging.format must be %q or %q, got %q", FormatText, logFormatJSON, lc.Format)
+	}
+	if _, err := parseLogLevel(lc.Level); err != nil {
+		return fmt.Errorf("logging.level: %w", err)
+	}
+	return nil
+}
+
+// parseLogLevel 解析日志级别名称，不区分大小写。
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (supported: debug, info, warn, error)", s)
+	}
+	return level, nil
+}
+
+// Setup 按 lc 创建日志处理器并设为默认，同时重新设置各组件的记录器。
+// 标准库 log 包的输出也会经过该处理器，以 INFO 级别记录。
+func Setup(w io.Writer, lc Config) error {
+	if err := Check(lc); err != nil {
+		return err
+	}
+	level, _ := parseLogLevel(lc.Level)
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if lc.Format == logFormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	logger := slog.New(h)
+	slog.SetDefault(logger)
+	Downloader = logger.With("component", "downloader")
+	Merger = logger.With("component", "merger")
+	Compiler = logger.With("component", "compiler")
+	Publisher = logger.With("component", "publisher")
+	return nil
+}
@@ -0,0 +1,14 @@
+// Package maputil 提供各个包共用的 map 辅助函数。
+package maputil
+
+import "sort"
+
+// SortedKeys 返回 m 的键，按字典序排列。
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
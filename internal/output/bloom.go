@@ -0,0 +1,86 @@
+package output
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+)
+
+// bloom 格式的文件结构（所有整数均为小端序）：
+//
+//	magic   [8]byte  "ADLBLOOM"
+//	version uint8    1
+//	k       uint8    哈希函数个数
+//	_       [6]byte  保留，为 0
+//	m       uint64   位数组的位数，是 8 的倍数
+//	n       uint64   写入的域名数
+//	bits    [m/8]byte 位数组，第 i 位位于 bits[i/8] 的第 i%8 位（低位在前）
+//
+// 第 j 个哈希（j = 0..k-1）为 (h1 + j*h2) mod m，按 uint64 回绕计算，
+// 其中 h1 是小写域名的 64 位 FNV-1a，h2 是 h1 循环右移 33 位后最低位置 1。
+// 屏蔽范围包括子域名，客户端应依次检查域名本身及其各级上级域名。
+const (
+	bloomMagic   = "ADLBLOOM"
+	bloomVersion = 1
+	bloomHeader  = 32
+)
+
+// defaultBloomFalsePositiveRate 是未配置 false_positive_rate 时的误判率。
+const defaultBloomFalsePositiveRate = 0.001
+
+// checkFalsePositiveRate 校验 bloom 格式的误判率，默认 0.001。
+func checkFalsePositiveRate(o *FormatConfig) error {
+	if o.FalsePositiveRate == 0 {
+		o.FalsePositiveRate = defaultBloomFalsePositiveRate
+	}
+	if o.FalsePositiveRate <= 0 || o.FalsePositiveRate >= 1 {
+		return fmt.Errorf("false_positive_rate must be between 0 and 1, got %v", o.FalsePositiveRate)
+	}
+	return nil
+}
+
+// bloomParams 根据元素个数 n 与误判率 p 计算位数 m（向上取整到 8 的倍数）与哈希个数 k。
+func bloomParams(n int, p float64) (m uint64, k int) {
+	if n == 0 {
+		return 8, 1
+	}
+	bits := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	m = (uint64(bits) + 7) / 8 * 8
+	k = int(math.Round(float64(m) / float64(n) * math.Ln2))
+	return m, min(max(k, 1), 32)
+}
+
+// bloomHashes 返回 domain 的两个基础哈希，见文件结构说明。
+func bloomHashes(domain string) (h1, h2 uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(domain))
+	h1 = h.Sum64()
+	return h1, (h1>>33 | h1<<31) | 1
+}
+
+// renderBloom 将被屏蔽的域名写入按 o.FalsePositiveRate 确定大小的布隆过滤器。
+// 布隆过滤器无法表达放行，使用 outputList.suffixDomains。
+func renderBloom(o FormatConfig, l *outputList) ([]byte, int) {
+	domains := slices.Clone(l.suffixDomains)
+	slices.Sort(domains)
+	domains = slices.Compact(domains)
+	m, k := bloomParams(len(domains), o.FalsePositiveRate)
+
+	data := make([]byte, bloomHeader+m/8)
+	copy(data, bloomMagic)
+	data[8] = bloomVersion
+	data[9] = byte(k)
+	binary.LittleEndian.PutUint64(data[16:], m)
+	binary.LittleEndian.PutUint64(data[24:], uint64(len(domains)))
+	bits := data[bloomHeader:]
+	for _, d := range domains {
+		h1, h2 := bloomHashes(d)
+		for j := 0; j < k; j++ {
+			i := (h1 + uint64(j)*h2) % m
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	return data, len(domains)
+}
@@ -0,0 +1,106 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"adguardlist/internal/compile"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// WriteCategoryOutputs 为每个分类生成一份列表，包含来自该分类的源的规则。
+// 同一规则出现在多个源中时属于这些源的全部分类；允许列表追加的例外、自定义规则等
+// 不来自任何源的规则出现在每个分类的列表中。文件头只列出该分类的源。
+func WriteCategoryOutputs(cfg *Config, res *Result, compiled *compile.Result) error {
+	if len(compiled.Categories) == 0 {
+		return nil
+	}
+	lines := make([][]string, len(compiled.Categories))
+	for _, line := range transform.SplitLines(compiled.Content) {
+		trimmed := strings.TrimSpace(line)
+		if !transform.IsRuleLine(trimmed) {
+			continue
+		}
+		mask, ok := compiled.RuleCategories[transform.DedupeKey(trimmed)]
+		if !ok {
+			mask = ^uint64(0)
+		}
+		for i := range compiled.Categories {
+			if mask&(1<<i) != 0 {
+				lines[i] = append(lines[i], trimmed)
+			}
+		}
+	}
+
+	for i, category := range compiled.Categories {
+		name := strings.ReplaceAll(cfg.CategoryFile, "%s", category)
+		body := transform.JoinLines(lines[i], true)
+		data := append(RenderHeader(categoryHeaderConfig(cfg, category), categoryResult(res, category, len(lines[i]))), body...)
+		for _, dir := range []string{cfg.OutputDir, cfg.PublishDir} {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return fmt.Errorf("failed to create directory for '%s': %w", p, err)
+			}
+			if err := fileutil.WriteAtomic(p, data); err != nil {
+				return fmt.Errorf("failed to write %s category list to '%s': %w", category, p, err)
+			}
+		}
+		res.Published = append(res.Published, path.Clean(name))
+		res.Describe(path.Clean(name), "adguard ("+category+")", len(lines[i]))
+		logging.Publisher.Info("🏷️ Wrote category list", "category", category, "rules", len(lines[i]), "path", filepath.Join(cfg.PublishDir, name))
+	}
+	return nil
+}
+
+// categoryHeaderConfig 返回标题中带有分类名称的配置副本。
+func categoryHeaderConfig(cfg *Config, category string) *Config {
+	c := *cfg
+	c.Header.Title = fmt.Sprintf("%s (%s)", cfg.Header.Title, category)
+	return &c
+}
+
+// categoryResult 返回只包含该分类的源的构建结果副本，用于生成分类列表的文件头。
+// 删除失效域名、截断等统计针对的是合并后的列表，不写入分类列表的文件头。
+func categoryResult(res *Result, category string, rules int) *Result {
+	r := *res
+	r.Sources, r.Downloads, r.Failed = nil, nil, nil
+	for _, src := range res.Sources {
+		if slices.Contains(src.Categories, category) {
+			r.Sources = append(r.Sources, src)
+		}
+	}
+	for _, d := range res.Downloads {
+		if slices.Contains(d.Source.Categories, category) {
+			r.Downloads = append(r.Downloads, d)
+		}
+	}
+	for _, src := range res.Failed {
+		if slices.Contains(src.Categories, category) {
+			r.Failed = append(r.Failed, src)
+		}
+	}
+	r.RuleCount = rules
+	r.Truncated, r.Dead, r.Excluded = 0, 0, 0
+	return &r
+}
+
+// checkCategoryFile 校验 category_file：必须包含 %s，且是发布目录内的相对路径。
+func checkCategoryFile(file string) error {
+	if file == "" {
+		return nil
+	}
+	if !strings.Contains(file, "%s") {
+		return fmt.Errorf("category_file must contain %%s, got %q", file)
+	}
+	clean := path.Clean(file)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(file, "\\") {
+		return fmt.Errorf("category_file must be a relative path inside the publish directory, got %q", file)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package output
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+)
+
+// WriteChecksums 在发布目录中生成 cfg.ChecksumsFile，记录每个发布文件的 SHA-256，
+// 格式与 sha256sum 相同，可以用 `sha256sum -c SHA256SUMS` 校验。配置为空时不生成。
+func WriteChecksums(cfg *Config, res *Result) error {
+	if cfg.ChecksumsFile == "" {
+		return nil
+	}
+	names := append([]string(nil), res.Published...)
+	sort.Strings(names)
+	var b bytes.Buffer
+	res.Checksums = make(map[string]string, len(names))
+	for _, name := range names {
+		sum, err := FileSHA256(filepath.Join(cfg.PublishDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to hash published file '%s': %w", name, err)
+		}
+		res.Checksums[name] = sum
+		fmt.Fprintf(&b, "%s  %s\n", sum, name)
+	}
+	path := filepath.Join(cfg.PublishDir, cfg.ChecksumsFile)
+	if err := fileutil.WriteAtomic(path, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write checksums to '%s': %w", path, err)
+	}
+	res.Published = append(res.Published, cfg.ChecksumsFile)
+	res.Describe(cfg.ChecksumsFile, "sha256sum", 0)
+	logging.Publisher.Info("🔐 Wrote SHA-256 checksums", "files", len(names), "path", path)
+	return nil
+}
+
+// FileSHA256 返回文件内容的十六进制 SHA-256。
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+)
+
+// 发布文件的压缩格式，同时也是压缩副本的扩展名。
+const (
+	compressGzip = "gz"
+	compressZstd = "zst"
+)
+
+// compressors 将压缩格式映射到实现。
+var compressors = map[string]func([]byte) ([]byte, error){
+	compressGzip: gzipBytes,
+	compressZstd: zstdBytes,
+}
+
+// gzipBytes 以最高压缩率压缩 data。不写入文件名与修改时间，内容不变时压缩结果也不变。
+func gzipBytes(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// zstdBytes 以最高压缩率压缩 data。
+func zstdBytes(data []byte) ([]byte, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil), nil
+}
+
+// WriteCompressed 为发布目录中的每个文件生成 cfg.Compress 中各格式的压缩副本，
+// 文件名为原文件名加 ".gz"、".zst" 扩展名，生成的副本同样记入 res.Published。
+func WriteCompressed(cfg *Config, res *Result) error {
+	if len(cfg.Compress) == 0 {
+		return nil
+	}
+	files := append([]string(nil), res.Published...)
+	for _, name := range files {
+		path := filepath.Join(cfg.PublishDir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s' for compression: %w", path, err)
+		}
+		for _, format := range cfg.Compress {
+			compressed, err := compressors[format](data)
+			if err != nil {
+				return fmt.Errorf("failed to compress '%s' with %s: %w", path, format, err)
+			}
+			out := path + "." + format
+			if err := fileutil.WriteAtomic(out, compressed); err != nil {
+				return fmt.Errorf("failed to write '%s': %w", out, err)
+			}
+			res.Published = append(res.Published, name+"."+format)
+			if a, ok := res.Artifacts[name]; ok {
+				res.Describe(name+"."+format, a.Format+", "+format, a.Rules)
+			}
+			logging.Publisher.Debug("🗜️ Compressed file", "path", out, "bytes", len(data), "compressed", len(compressed))
+		}
+	}
+	logging.Publisher.Info("🗜️ Wrote compressed copies of published files", "formats", strings.Join(cfg.Compress, "/"), "files", len(files))
+	return nil
+}
@@ -0,0 +1,331 @@
+package output
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// DeltasConfig 控制增量补丁：每次构建生成从上一次发布的列表到新列表的补丁，
+// 客户端按清单依次应用补丁即可更新，无需重新下载完整列表。
+type DeltasConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	Keep    int    `yaml:"keep"`
+}
+
+// deltaManifestFile 是增量补丁目录中的清单文件名。
+const deltaManifestFile = "manifest.json"
+
+// deltaManifest 描述当前发布的列表与可用的补丁，补丁按生成时间从新到旧排列。
+type deltaManifest struct {
+	File      string       `json:"file"`
+	SHA256    string       `json:"sha256"`
+	Size      int          `json:"size"`
+	Generated time.Time    `json:"generated"`
+	Deltas    []deltaEntry `json:"deltas"`
+}
+
+// deltaEntry 是一个补丁：在内容哈希为 From 的列表上应用 File 后得到哈希为 To 的列表。
+type deltaEntry struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	File      string    `json:"file"`
+	SHA256    string    `json:"sha256"`
+	Size      int       `json:"size"`
+	Added     int       `json:"added"`
+	Removed   int       `json:"removed"`
+	Generated time.Time `json:"generated"`
+}
+
+// WriteDeltas 生成从 res.Previous 到 res.Content 的补丁并更新清单，
+// 只保留最近 cfg.Deltas.Keep 个补丁，更早的补丁文件（含压缩副本与签名）会被删除。
+// 清单与补丁保存在输出目录中（与列表一起提交到仓库，CI 中每次重新生成的发布目录不会保留它们），
+// 再拷贝到发布目录。
+func WriteDeltas(cfg *Config, res *Result) error {
+	dc := cfg.Deltas
+	if !dc.Enabled {
+		return nil
+	}
+	for _, base := range []string{cfg.OutputDir, cfg.PublishDir} {
+		dir := filepath.Join(base, dc.Dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create delta directory '%s': %w", dir, err)
+		}
+	}
+	manifestPath := filepath.Join(cfg.OutputDir, dc.Dir, deltaManifestFile)
+	manifest, err := readDeltaManifest(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read delta manifest '%s': %w", manifestPath, err)
+	}
+
+	to := SHA256Hex(res.Content)
+	if res.Previous != nil {
+		if from := SHA256Hex(res.Previous); from != to {
+			patch, added, removed := unifiedDiff(cfg.OutputFile, splitKeepNewline(res.Previous), splitKeepNewline(res.Content))
+			name := path.Join(dc.Dir, from[:16]+".patch")
+			if err := fileutil.WriteAtomic(filepath.Join(cfg.OutputDir, name), patch); err != nil {
+				return fmt.Errorf("failed to write delta '%s': %w", name, err)
+			}
+			entry := deltaEntry{
+				From: from, To: to, File: name, SHA256: SHA256Hex(patch), Size: len(patch),
+				Added: added, Removed: removed, Generated: res.BuildTime.UTC().Truncate(time.Second),
+			}
+			// 同一来源的旧补丁已被覆盖，从清单中去掉
+			kept := []deltaEntry{entry}
+			for _, e := range manifest.Deltas {
+				if e.From != from {
+					kept = append(kept, e)
+				}
+			}
+			manifest.Deltas = kept
+			logging.Publisher.Info("🧩 Wrote delta", "file", name, "added", added, "removed", removed, "bytes", len(patch), "list_bytes", len(res.Content))
+		}
+	}
+	if len(manifest.Deltas) > dc.Keep {
+		manifest.Deltas = manifest.Deltas[:dc.Keep]
+	}
+	for _, base := range []string{cfg.OutputDir, cfg.PublishDir} {
+		if err := pruneDeltas(filepath.Join(base, dc.Dir), manifest.Deltas); err != nil {
+			return err
+		}
+	}
+
+	manifest.File = cfg.OutputFile
+	manifest.SHA256 = to
+	manifest.Size = len(res.Content)
+	manifest.Generated = res.BuildTime.UTC().Truncate(time.Second)
+	// 结构体字段都是可序列化的类型，MarshalIndent 不会失败
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := fileutil.WriteAtomic(manifestPath, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write delta manifest '%s': %w", manifestPath, err)
+	}
+	for _, e := range manifest.Deltas {
+		if err := publishDelta(cfg, e.File); err != nil {
+			return err
+		}
+		res.Published = append(res.Published, e.File)
+		res.Describe(e.File, "delta", 0)
+	}
+	name := path.Join(dc.Dir, deltaManifestFile)
+	if err := publishDelta(cfg, name); err != nil {
+		return err
+	}
+	res.Published = append(res.Published, name)
+	res.Describe(name, "delta manifest", 0)
+	return nil
+}
+
+// publishDelta 将输出目录中的补丁或清单 name 拷贝到发布目录。
+func publishDelta(cfg *Config, name string) error {
+	data, err := os.ReadFile(filepath.Join(cfg.OutputDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to read delta '%s': %w", name, err)
+	}
+	if err := fileutil.WriteAtomic(filepath.Join(cfg.PublishDir, name), data); err != nil {
+		return fmt.Errorf("failed to copy delta '%s' to publish directory: %w", name, err)
+	}
+	return nil
+}
+
+// readDeltaManifest 读取上一次构建的清单，文件不存在时返回空清单。
+func readDeltaManifest(path string) (*deltaManifest, error) {
+	m := &deltaManifest{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// pruneDeltas 删除补丁目录 dir 中不属于 kept 中任何补丁的文件（包括补丁的压缩副本与签名）。
+func pruneDeltas(dir string, kept []deltaEntry) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list delta directory '%s': %w", dir, err)
+	}
+	keep := make(map[string]bool, len(kept))
+	for _, e := range kept {
+		keep[path.Base(e.File)] = true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, deltaManifestFile) {
+			continue
+		}
+		base := name
+		if i := strings.Index(name, ".patch"); i >= 0 {
+			base = name[:i+len(".patch")]
+		}
+		if keep[base] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("failed to remove expired delta '%s': %w", name, err)
+		}
+		logging.Publisher.Debug("🧩 Removed expired delta file", "file", name)
+	}
+	return nil
+}
+
+// SHA256Hex 返回 data 的十六进制 SHA-256。
+func SHA256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// splitKeepNewline 将 data 拆分为保留换行符的行，只有文件末尾没有换行符时最后一行才不带换行符。
+func splitKeepNewline(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunk 是 a[aStart:aStart+aLen] 被替换为 b[bStart:bStart+bLen] 的一处改动。
+type hunk struct {
+	aStart, aLen int
+	bStart, bLen int
+}
+
+// diffLines 以两边都只出现一次的行为锚点（patience diff），
+// 取锚点的最长公共子序列后，在锚点之间去掉相同的首尾行，剩下的部分作为改动。
+// 列表中的规则已经去重，几乎每一行都能作为锚点，百万行的列表也能很快完成。
+func diffLines(a, b []string) []hunk {
+	type count struct{ a, b, aIndex int }
+	counts := make(map[string]*count, len(a))
+	for i, line := range a {
+		c := counts[line]
+		if c == nil {
+			c = &count{}
+			counts[line] = c
+		}
+		c.a++
+		c.aIndex = i
+	}
+	for _, line := range b {
+		if c := counts[line]; c != nil {
+			c.b++
+		}
+	}
+	var pairs [][2]int
+	for j, line := range b {
+		if c := counts[line]; c != nil && c.a == 1 && c.b == 1 {
+			pairs = append(pairs, [2]int{c.aIndex, j})
+		}
+	}
+	anchors := longestIncreasing(pairs)
+
+	var hunks []hunk
+	ai, bi := 0, 0
+	emit := func(aEnd, bEnd int) {
+		for ai < aEnd && bi < bEnd && a[ai] == b[bi] {
+			ai++
+			bi++
+		}
+		ae, be := aEnd, bEnd
+		for ae > ai && be > bi && a[ae-1] == b[be-1] {
+			ae--
+			be--
+		}
+		if ae > ai || be > bi {
+			hunks = append(hunks, hunk{aStart: ai, aLen: ae - ai, bStart: bi, bLen: be - bi})
+		}
+		ai, bi = aEnd, bEnd
+	}
+	for _, p := range anchors {
+		emit(p[0], p[1])
+		ai, bi = p[0]+1, p[1]+1
+	}
+	emit(len(a), len(b))
+	return hunks
+}
+
+// longestIncreasing 返回 pairs（按第二个下标递增）中第一个下标也严格递增的最长子序列。
+func longestIncreasing(pairs [][2]int) [][2]int {
+	var tails []int // tails[k] 是长度为 k+1 的子序列末尾元素在 pairs 中的下标
+	prev := make([]int, len(pairs))
+	for i, p := range pairs {
+		k := sort.Search(len(tails), func(k int) bool { return pairs[tails[k]][0] >= p[0] })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	out := make([][2]int, len(tails))
+	if len(tails) == 0 {
+		return out
+	}
+	for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+		out[i] = pairs[k]
+	}
+	return out
+}
+
+// unifiedDiff 生成不带上下文的 unified diff，可以直接用 `patch name < file.patch` 应用。
+// 返回补丁内容以及新增、删除的规则行数（不含注释）。
+func unifiedDiff(name string, a, b []string) (patch []byte, added, removed int) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", name, name)
+	writeLine := func(prefix byte, line string) {
+		buf.WriteByte(prefix)
+		buf.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	for _, h := range diffLines(a, b) {
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(h.aStart, h.aLen), hunkRange(h.bStart, h.bLen))
+		for _, line := range a[h.aStart : h.aStart+h.aLen] {
+			writeLine('-', line)
+			if transform.IsRuleLine(strings.TrimSpace(line)) {
+				removed++
+			}
+		}
+		for _, line := range b[h.bStart : h.bStart+h.bLen] {
+			writeLine('+', line)
+			if transform.IsRuleLine(strings.TrimSpace(line)) {
+				added++
+			}
+		}
+	}
+	return buf.Bytes(), added, removed
+}
+
+// hunkRange 格式化 unified diff 中的行范围；空范围的起始行是其前一行的行号。
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
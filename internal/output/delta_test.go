@@ -0,0 +1,148 @@
+package output
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// applyHunks 按 diffLines 的结果把 a 改写为 b。
+func applyHunks(a, b []string, hunks []hunk) []string {
+	var out []string
+	ai := 0
+	for _, h := range hunks {
+		out = append(out, a[ai:h.aStart]...)
+		out = append(out, b[h.bStart:h.bStart+h.bLen]...)
+		ai = h.aStart + h.aLen
+	}
+	return append(out, a[ai:]...)
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"identical", "a\nb\nc\n", "a\nb\nc\n"},
+		{"empty to full", "", "a\nb\n"},
+		{"full to empty", "a\nb\n", ""},
+		{"insert and delete", "a\nb\nc\nd\n", "a\nc\nx\nd\ne\n"},
+		{"moved line", "a\nb\nc\nd\n", "d\na\nb\nc\n"},
+		{"repeated lines", "!\na\n!\nb\n!\n", "!\nb\n!\na\n!\n"},
+		{"no trailing newline", "a\nb", "a\nc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := splitKeepNewline([]byte(tt.a)), splitKeepNewline([]byte(tt.b))
+			hunks := diffLines(a, b)
+			if got := strings.Join(applyHunks(a, b, hunks), ""); got != tt.b {
+				t.Errorf("applying %+v to %q = %q, want %q", hunks, tt.a, got, tt.b)
+			}
+			if tt.a == tt.b && len(hunks) != 0 {
+				t.Errorf("diffLines() of identical input = %+v, want no hunks", hunks)
+			}
+		})
+	}
+}
+
+// 随机修改的规则列表经补丁还原后与新列表相同，改动集中在被修改的位置。
+func TestDiffLinesRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var a []string
+	for i := 0; i < 2000; i++ {
+		a = append(a, "||d"+strings.Repeat("x", i%7)+string(rune('a'+i%26))+".example.com^\n")
+	}
+	for round := 0; round < 20; round++ {
+		b := slices.Clone(a)
+		for i := 0; i < 30; i++ {
+			j := rng.Intn(len(b))
+			switch rng.Intn(3) {
+			case 0:
+				b = slices.Delete(b, j, j+1)
+			case 1:
+				b = slices.Insert(b, j, "||new"+string(rune('a'+i))+".example.org^\n")
+			default:
+				b[j] = "||changed.example.net^\n"
+			}
+		}
+		hunks := diffLines(a, b)
+		if got := applyHunks(a, b, hunks); !slices.Equal(got, b) {
+			t.Fatalf("round %d: patched list differs from the new list", round)
+		}
+		if len(hunks) > 30 {
+			t.Errorf("round %d: %d hunks for 30 edits", round, len(hunks))
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := splitKeepNewline([]byte("! Title\n||a.com^\n||b.com^\n||c.com^\n"))
+	b := splitKeepNewline([]byte("! Title 2\n||a.com^\n||c.com^\n||d.com^\n"))
+	patch, added, removed := unifiedDiff("output.txt", a, b)
+	want := "--- output.txt\n+++ output.txt\n" +
+		"@@ -1,1 +1,1 @@\n-! Title\n+! Title 2\n" +
+		"@@ -3,1 +2,0 @@\n-||b.com^\n" +
+		"@@ -4,0 +4,1 @@\n+||d.com^\n"
+	if string(patch) != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", patch, want)
+	}
+	// 注释行不计入新增与删除的规则数
+	if added != 1 || removed != 1 {
+		t.Errorf("added, removed = %d, %d, want 1, 1", added, removed)
+	}
+
+	// 只有末尾确实没有换行符的文件才标记 "No newline at end of file"
+	patch, _, _ = unifiedDiff("output.txt", splitKeepNewline([]byte("a\nb\n")), splitKeepNewline([]byte("a\nc")))
+	if want := "--- output.txt\n+++ output.txt\n@@ -2,1 +2,1 @@\n-b\n+c\n\\ No newline at end of file\n"; string(patch) != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", patch, want)
+	}
+}
+
+// 清单与补丁保存在输出目录中，发布目录每次重新生成时补丁链仍然连续，超过 keep 的补丁被删除。
+func TestWriteDeltas(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.OutputDir, cfg.PublishDir = filepath.Join(dir, "rules"), filepath.Join(dir, "publish")
+	cfg.Deltas.Enabled, cfg.Deltas.Keep = true, 2
+
+	lists := []string{"||a.com^\n", "||a.com^\n||b.com^\n", "||b.com^\n", "||c.com^\n"}
+	for i := 1; i < len(lists); i++ {
+		if err := os.RemoveAll(cfg.PublishDir); err != nil {
+			t.Fatal(err)
+		}
+		res := &Result{Content: []byte(lists[i]), Previous: []byte(lists[i-1]), BuildTime: time.Now()}
+		if err := WriteDeltas(&cfg, res); err != nil {
+			t.Fatalf("WriteDeltas() build %d error = %v", i, err)
+		}
+	}
+
+	for _, base := range []string{cfg.OutputDir, cfg.PublishDir} {
+		data, err := os.ReadFile(filepath.Join(base, "deltas", deltaManifestFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m deltaManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.SHA256 != SHA256Hex([]byte(lists[3])) || len(m.Deltas) != 2 {
+			t.Fatalf("%s manifest = %+v, want the last list and 2 deltas", base, m)
+		}
+		// 补丁从新到旧排列，依次衔接
+		if m.Deltas[0].To != m.SHA256 || m.Deltas[1].To != m.Deltas[0].From || m.Deltas[1].From != SHA256Hex([]byte(lists[1])) {
+			t.Errorf("%s deltas = %+v, want a chain from list 1 to list 3", base, m.Deltas)
+		}
+		entries, err := os.ReadDir(filepath.Join(base, "deltas"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 {
+			t.Errorf("%s has %d delta files, want 2 patches and the manifest", base, len(entries))
+		}
+	}
+}
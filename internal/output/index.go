@@ -0,0 +1,211 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+)
+
+// IndexConfig 控制发布目录中的索引页：HTML 与 Markdown 两个文件列出全部发布文件的格式、条目数、
+// 大小、SHA-256 与订阅地址。订阅地址为 BaseURL 加文件名，BaseURL 为空时根据 GITHUB_REPOSITORY
+// 使用 jsDelivr 上 release 分支的地址，两者都没有时使用相对链接。
+type IndexConfig struct {
+	HTML     string `yaml:"html"`
+	Markdown string `yaml:"markdown"`
+	BaseURL  string `yaml:"base_url"`
+}
+
+// artifact 是一个发布文件的格式与规则数，rules 为 0 表示不适用（例如签名文件）。
+type artifact struct {
+	Format string
+	Rules  int
+}
+
+// Describe 记录发布文件 name 的格式与规则数。
+func (r *Result) Describe(name, format string, rules int) {
+	if r.Artifacts == nil {
+		r.Artifacts = make(map[string]artifact)
+	}
+	r.Artifacts[name] = artifact{Format: format, Rules: rules}
+}
+
+// indexEntry 是索引页中的一行。
+type indexEntry struct {
+	File   string
+	URL    string
+	Format string
+	Rules  int
+	Size   int64
+	SHA256 string
+	// Subscribe 是 AdGuard 格式列表的一键订阅链接，abp: 协议需要以 template.URL 绕过模板的 URL 过滤
+	Subscribe template.URL
+}
+
+// indexPage 是渲染索引页所需的数据。
+type indexPage struct {
+	Title     string
+	Generated string
+	Rules     int
+	Sources   int
+	Succeeded int
+	Entries   []indexEntry
+}
+
+// indexHTML 是 HTML 索引页的模板。
+var indexHTML = template.Must(template.New("index").Funcs(template.FuncMap{
+	"bytes":  func(n int64) string { return download.FormatBytes(n) },
+	"digits": GroupDigits,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 1100px; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+th, td { border-bottom: 1px solid #ddd; padding: 6px 8px; text-align: left; vertical-align: top; }
+td.num { text-align: right; white-space: nowrap; }
+code { font-size: 12px; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Generated}} · {{digits .Rules}} rules · {{.Succeeded}}/{{.Sources}} sources downloaded</p>
+<table>
+<thead><tr><th>File</th><th>Format</th><th>Rules</th><th>Size</th><th>SHA-256</th></tr></thead>
+<tbody>
+{{- range .Entries}}
+<tr><td><a href="{{.URL}}">{{.File}}</a>{{if .Subscribe}} · <a href="{{.Subscribe}}">subscribe</a>{{end}}</td><td>{{.Format}}</td><td class="num">{{if .Rules}}{{digits .Rules}}{{end}}</td><td class="num">{{bytes .Size}}</td><td><code>{{.SHA256}}</code></td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// WriteIndex 在发布目录中生成 cfg.Index 的 HTML 与 Markdown 索引页，列出 res.Published 中的全部文件。
+// 与徽章相同，索引页本身不列入发布文件，不生成压缩副本与签名。
+func WriteIndex(cfg *Config, res *Result) error {
+	ic := cfg.Index
+	if ic.HTML == "" && ic.Markdown == "" {
+		return nil
+	}
+	base := PublishBaseURL(cfg)
+
+	page := indexPage{
+		Title:     cfg.Header.Title,
+		Generated: res.BuildTime.UTC().Format("2006-01-02 15:04 UTC"),
+		Rules:     res.RuleCount,
+		Sources:   len(res.Sources),
+		Succeeded: len(res.Downloads),
+	}
+	for _, name := range res.Published {
+		path := filepath.Join(cfg.PublishDir, filepath.FromSlash(name))
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat published file '%s': %w", path, err)
+		}
+		sum, ok := res.Checksums[name]
+		if !ok {
+			if sum, err = FileSHA256(path); err != nil {
+				return fmt.Errorf("failed to hash published file '%s': %w", path, err)
+			}
+		}
+		a := res.Artifacts[name]
+		e := indexEntry{File: name, URL: base + name, Format: a.Format, Rules: a.Rules, Size: info.Size(), SHA256: sum}
+		if e.Format == "" {
+			e.Format = "other"
+		}
+		if strings.HasPrefix(a.Format, "adguard") && !strings.Contains(a.Format, ", ") && base != "" {
+			e.Subscribe = template.URL("abp:subscribe?location=" + url.QueryEscape(e.URL) + "&title=" + strings.ReplaceAll(url.QueryEscape(cfg.Header.Title), "+", "%20"))
+		}
+		page.Entries = append(page.Entries, e)
+	}
+
+	if ic.HTML != "" {
+		var b bytes.Buffer
+		if err := indexHTML.Execute(&b, page); err != nil {
+			return fmt.Errorf("failed to render index page: %w", err)
+		}
+		if err := fileutil.WriteAtomic(filepath.Join(cfg.PublishDir, ic.HTML), b.Bytes()); err != nil {
+			return fmt.Errorf("failed to write index page '%s': %w", ic.HTML, err)
+		}
+		res.Extras = append(res.Extras, ic.HTML)
+	}
+	if ic.Markdown != "" {
+		if err := fileutil.WriteAtomic(filepath.Join(cfg.PublishDir, ic.Markdown), renderIndexMarkdown(page)); err != nil {
+			return fmt.Errorf("failed to write index page '%s': %w", ic.Markdown, err)
+		}
+		res.Extras = append(res.Extras, ic.Markdown)
+	}
+	logging.Publisher.Debug("🗂️ Wrote index pages", "files", len(page.Entries), "html", ic.HTML, "markdown", ic.Markdown)
+	return nil
+}
+
+// PublishBaseURL 返回发布文件的订阅地址前缀（以 / 结尾），无法确定时返回空字符串。
+func PublishBaseURL(cfg *Config) string {
+	base := cfg.Index.BaseURL
+	if base == "" && os.Getenv("GITHUB_REPOSITORY") != "" {
+		base = fmt.Sprintf("https://cdn.jsdelivr.net/gh/%s@release/", os.Getenv("GITHUB_REPOSITORY"))
+	}
+	if base != "" && !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base
+}
+
+// renderIndexMarkdown 以 Markdown 表格的形式输出索引页。
+func renderIndexMarkdown(page indexPage) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", page.Title)
+	fmt.Fprintf(&b, "Generated %s · %s rules · %d/%d sources downloaded\n\n", page.Generated, GroupDigits(page.Rules), page.Succeeded, page.Sources)
+	b.WriteString("| File | Format | Rules | Size | SHA-256 |\n|---|---|---:|---:|---|\n")
+	for _, e := range page.Entries {
+		rules := ""
+		if e.Rules > 0 {
+			rules = GroupDigits(e.Rules)
+		}
+		fmt.Fprintf(&b, "| [%s](%s) | %s | %s | %s | `%s` |\n", MarkdownCell(e.File), e.URL, MarkdownCell(e.Format), rules, download.FormatBytes(e.Size), e.SHA256)
+	}
+	return b.Bytes()
+}
+
+// checkIndex 校验 index 配置。
+func checkIndex(ic IndexConfig) error {
+	for _, name := range []string{ic.HTML, ic.Markdown} {
+		if name != "" && filepath.Base(name) != name {
+			return fmt.Errorf("index: page names must be plain file names, got %q", name)
+		}
+	}
+	if ic.BaseURL != "" {
+		if u, err := url.Parse(ic.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("index.base_url must be an http(s) url, got %q", ic.BaseURL)
+		}
+	}
+	return nil
+}
+
+// GroupDigits 以逗号分隔千位输出非负整数 n。
+func GroupDigits(n int) string {
+	s := strconv.Itoa(n)
+	out := s[:(len(s)-1)%3+1]
+	for i := len(out); i < len(s); i += 3 {
+		out += "," + s[i:i+3]
+	}
+	return out
+}
+
+// MarkdownCell 转义表格单元格中的竖线并去掉换行。
+func MarkdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "\r", "").Replace(s)
+}
@@ -0,0 +1,119 @@
+package output
+
+import (
+	"encoding/json"
+	"time"
+
+	"adguardlist/internal/transform"
+)
+
+// jsonList 是 json 输出格式的顶层结构。
+type jsonList struct {
+	Title     string       `json:"title"`
+	Version   string       `json:"version"`
+	Generated time.Time    `json:"generated"`
+	Expires   string       `json:"expires"`
+	Homepage  string       `json:"homepage"`
+	Counts    JSONCounts   `json:"counts"`
+	Sources   []jsonSource `json:"sources"`
+	Rules     []jsonRule   `json:"rules"`
+}
+
+// JSONCounts 是与文件头中相同的统计信息。
+type JSONCounts struct {
+	Rules     int `json:"rules"`
+	Sources   int `json:"sources"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Stale     int `json:"stale"`
+	Excluded  int `json:"excluded"`
+	Dead      int `json:"dead"`
+	Truncated int `json:"truncated"`
+}
+
+// jsonSource 是单个源的状态与统计，Fetched 为该源的规则行数，Unique 为不在其他源中的规则数，
+// Rules 为最终输出中来自该源的规则数。
+type jsonSource struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Status     string `json:"status"` // ok、stale 或 failed
+	Format     string `json:"format,omitempty"`
+	Bytes      int    `json:"bytes"`
+	Lines      int    `json:"lines"`
+	Fetched    int    `json:"fetched"`
+	Duplicates int    `json:"duplicates"`
+	Repeated   int    `json:"repeated"`
+	Rejected   int    `json:"rejected"`
+	Unique     int    `json:"unique"`
+	Rules      int    `json:"rules"`
+}
+
+// jsonRule 是一条规则及其来源，来源无法确定（自定义规则、追加的例外等）时为空。
+type jsonRule struct {
+	Rule   string `json:"rule"`
+	Source string `json:"source,omitempty"`
+}
+
+// renderJSON 生成包含规则列表与构建元数据的 JSON 文件，供程序读取而无需解析注释头部。
+func renderJSON(o FormatConfig, l *outputList) ([]byte, int) {
+	list := newJSONList(l)
+	// jsonList 只包含字符串、数字与时间，编码不会失败
+	data, _ := json.MarshalIndent(list, "", "  ")
+	return append(data, '\n'), len(list.Rules)
+}
+
+// newJSONList 汇总规则及其来源、各源状态与构建元数据，json 与 sqlite 格式共用。
+func newJSONList(l *outputList) jsonList {
+	res, cfg := l.res, l.cfg
+	list := jsonList{
+		Title:     cfg.Header.Title,
+		Version:   res.BuildTime.Format("200601021504"),
+		Generated: res.BuildTime.UTC().Truncate(time.Second),
+		Expires:   cfg.Header.Expires,
+		Homepage:  cfg.Header.HomepageURL(),
+		Counts: JSONCounts{
+			Rules:     len(l.rules),
+			Sources:   len(res.Sources),
+			Succeeded: len(res.Downloads),
+			Failed:    len(res.Failed),
+			Stale:     res.StaleCount(),
+			Excluded:  res.Excluded,
+			Dead:      res.Dead,
+			Truncated: res.Truncated,
+		},
+		Sources: make([]jsonSource, 0, len(res.Sources)),
+		Rules:   make([]jsonRule, 0, len(l.rules)),
+	}
+
+	perSource := make([]int, len(res.Downloads))
+	for _, rule := range l.rules {
+		r := jsonRule{Rule: rule}
+		if idx, ok := l.compiled.RuleSources[transform.DedupeKey(rule)]; ok {
+			r.Source = res.Downloads[idx].Source.Name
+			perSource[idx]++
+		}
+		list.Rules = append(list.Rules, r)
+	}
+
+	downloaded := make(map[string]int, len(res.Downloads))
+	for i, d := range res.Downloads {
+		downloaded[d.Source.URL] = i
+	}
+	for _, src := range res.Sources {
+		s := jsonSource{Name: src.Name, URL: src.URL, Status: "failed"}
+		if i, ok := downloaded[src.URL]; ok {
+			s.Status = "ok"
+			if res.Downloads[i].Stale {
+				s.Status = "stale"
+			}
+			if i < len(l.compiled.Stats) {
+				st := l.compiled.Stats[i]
+				s.Format, s.Bytes, s.Lines, s.Fetched = st.Format, st.Bytes, st.Lines, st.Rules
+				s.Duplicates, s.Repeated, s.Rejected, s.Unique = st.Duplicates, st.Repeated, st.Rejected, st.Unique
+			}
+			s.Rules = perSource[i]
+		}
+		list.Sources = append(list.Sources, s)
+	}
+	return list
+}
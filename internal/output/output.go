@@ -0,0 +1,252 @@
+// Package output 将编译结果写入输出与发布目录：规则列表及其额外格式、分类列表、报告、
+// 压缩副本、校验和、签名、增量补丁与索引页。
+package output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"adguardlist/internal/compile"
+	"adguardlist/internal/download"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/source"
+)
+
+// Config 控制构建结果的写出：输出与发布目录、文件头部、额外输出格式与分类列表、
+// 各种报告、压缩副本、校验和、签名、增量补丁与索引页。
+type Config struct {
+	OutputDir      string         `yaml:"output_dir"`
+	PublishDir     string         `yaml:"publish_dir"`
+	OutputFile     string         `yaml:"output_file"`
+	ConflictReport string         `yaml:"conflict_report"`
+	RejectedReport string         `yaml:"rejected_report"`
+	SourceReport   string         `yaml:"source_report"`
+	Index          IndexConfig    `yaml:"index"`
+	Outputs        []FormatConfig `yaml:"outputs"`
+	Compress       []string       `yaml:"compress"`
+	ChecksumsFile  string         `yaml:"checksums_file"`
+	Signing        SigningConfig  `yaml:"signing"`
+	Deltas         DeltasConfig   `yaml:"deltas"`
+	CategoryFile   string         `yaml:"category_file"`
+	Header         HeaderConfig   `yaml:"header"`
+}
+
+// DefaultConfig 返回输出的默认配置。
+func DefaultConfig() Config {
+	return Config{
+		OutputDir:      "rules",
+		PublishDir:     "publish",
+		OutputFile:     "output.txt",
+		ConflictReport: "conflicts.txt",
+		RejectedReport: "rejected_rules.txt",
+		SourceReport:   "source_stats.txt",
+		Index:          IndexConfig{HTML: "index.html", Markdown: "index.md"},
+		ChecksumsFile:  "SHA256SUMS",
+		Deltas:         DeltasConfig{Dir: "deltas", Keep: 14},
+		CategoryFile:   "categories/%s.txt",
+		Header: HeaderConfig{
+			Title:   "5whys Adguard Home Rules List (Use with a lot of false rejects)",
+			Expires: "12 hours",
+		},
+	}
+}
+
+// Check 检查输出配置中的取值是否合法，并填充额外输出格式的默认值。
+func (c *Config) Check() error {
+	if c.OutputDir == "" || c.PublishDir == "" || c.OutputFile == "" {
+		return fmt.Errorf("output_dir, publish_dir and output_file must not be empty")
+	}
+	if filepath.Base(c.ChecksumsFile) != c.ChecksumsFile {
+		return fmt.Errorf("checksums_file must be a plain file name, got %q", c.ChecksumsFile)
+	}
+	if c.Deltas.Enabled {
+		if c.Deltas.Dir == "" || filepath.Base(c.Deltas.Dir) != c.Deltas.Dir {
+			return fmt.Errorf("deltas.dir must be a plain directory name, got %q", c.Deltas.Dir)
+		}
+		if c.Deltas.Keep < 1 {
+			return fmt.Errorf("deltas.keep must be at least 1, got %d", c.Deltas.Keep)
+		}
+	}
+	if err := checkCategoryFile(c.CategoryFile); err != nil {
+		return err
+	}
+	if err := checkOutputs(c); err != nil {
+		return err
+	}
+	for _, format := range c.Compress {
+		if compressors[format] == nil {
+			return fmt.Errorf("compress: unsupported format %q (supported: %s, %s)", format, compressGzip, compressZstd)
+		}
+	}
+	return checkIndex(c.Index)
+}
+
+// HeaderConfig 控制生成文件头部的文本内容。
+type HeaderConfig struct {
+	Title    string `yaml:"title"`
+	Expires  string `yaml:"expires"`
+	Homepage string `yaml:"homepage"`
+	// IPNSKey 是发布到 IPFS 时更新的 IPNS 名称，写在头部中；由 publishers.ipfs 决定，不从配置文件读取
+	IPNSKey string `yaml:"-"`
+}
+
+// HomepageURL 返回头部中使用的主页地址，未配置时根据 GITHUB_REPOSITORY 推导。
+func (h HeaderConfig) HomepageURL() string {
+	if h.Homepage != "" {
+		return h.Homepage
+	}
+	return fmt.Sprintf("https://github.com/%s", os.Getenv("GITHUB_REPOSITORY"))
+}
+
+// Result 汇总一次构建的统计信息与最终内容。
+type Result struct {
+	Sources   []source.Source
+	Downloads []download.Result
+	Failed    []source.Source
+	RuleCount int
+	Excluded  int // 被 exclusions.txt 删除的规则数
+	Dead      int // 作为失效域名删除的规则数
+	Truncated int // 因超过 max_rules 被截断的规则数
+	MaxRules  int // 截断时使用的 max_rules
+	BuildTime time.Time
+	Content   []byte
+	Published []string                    // 写入发布目录的文件名，用于生成压缩副本、校验和等
+	Extras    []string                    // 写入发布目录、但不列入校验和的文件（索引页、趋势图与徽章），以 / 分隔
+	Previous  []byte                      // 上一次发布的列表，仅在启用增量补丁、变更日志或生成作业摘要时读取
+	Outcomes  map[string]download.Outcome // 每个源的下载耗时与错误，以 URL 为键
+	Stats     []compile.SourceStats       // 合并列表编译时各源的统计
+	Timings   []StageTiming
+	Checksums map[string]string // 发布文件的 SHA-256，由 WriteChecksums 记录
+
+	// Quarantined 是被隔离、本次没有下载的源，不计入 Sources
+	Quarantined []source.Source
+	// Artifacts 以 Published 中的文件名为键，记录发布文件的格式与规则数，用于生成索引页
+	Artifacts map[string]artifact
+	// IPFSCID 是发布文件添加到 IPFS 后目录的 CID，未启用 IPFS 发布时为空
+	IPFSCID string
+	// RenderText 用本次构建的结果渲染发布目标中的文本模板（release 说明、提交信息），
+	// 模板可用的字段与通知相同；text 为空时使用 fallback
+	RenderText func(name, text, fallback string) (string, error)
+}
+
+// StaleCount 返回回退到缓存旧内容的源数量。
+func (r *Result) StaleCount() int {
+	n := 0
+	for _, d := range r.Downloads {
+		if d.Stale {
+			n++
+		}
+	}
+	return n
+}
+
+// StageTiming 是构建中一个阶段的耗时。
+type StageTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// TimeStage 记录从 start 开始的阶段 name 的耗时。
+func (r *Result) TimeStage(name string, start time.Time) {
+	r.Timings = append(r.Timings, StageTiming{Name: name, Duration: time.Since(start)})
+}
+
+// RenderHeader 生成输出文件的注释头部。
+func RenderHeader(cfg *Config, res *Result) []byte {
+	var header bytes.Buffer
+	header.WriteString(fmt.Sprintf("# Title: %s\n", cfg.Header.Title))
+	header.WriteString(fmt.Sprintf("# Version: %s\n", res.BuildTime.Format("200601021504")))
+	header.WriteString(fmt.Sprintf("# Generated: %s\n", res.BuildTime.Format(time.RFC3339)))
+	header.WriteString(fmt.Sprintf("# Expires: %s\n", cfg.Header.Expires))
+	header.WriteString(fmt.Sprintf("# Total sources: %d (Success: %d, Failed: %d)\n", len(res.Sources), len(res.Downloads), len(res.Failed)))
+	if stale := res.StaleCount(); stale > 0 {
+		header.WriteString(fmt.Sprintf("# Stale sources: %d (download failed, served from cache)\n", stale))
+	}
+	header.WriteString(fmt.Sprintf("# Total rules: %d\n", res.RuleCount))
+	if res.Truncated > 0 {
+		header.WriteString(fmt.Sprintf("# Truncated rules: %d (max_rules %d)\n", res.Truncated, res.MaxRules))
+	}
+	if res.Dead > 0 {
+		header.WriteString(fmt.Sprintf("# Dead domains removed: %d (NXDOMAIN in consecutive builds)\n", res.Dead))
+	}
+	if res.Excluded > 0 {
+		header.WriteString(fmt.Sprintf("# Excluded rules: %d (matched setting exclusions)\n", res.Excluded))
+	}
+	header.WriteString(fmt.Sprintf("# Homepage: %s\n", cfg.Header.HomepageURL()))
+	if cfg.Header.IPNSKey != "" {
+		header.WriteString(fmt.Sprintf("# IPNS: /ipns/%s\n", cfg.Header.IPNSKey))
+	}
+	header.WriteString("#\n")
+	header.WriteString("# Source URLs:\n")
+	staleSince := make(map[string]time.Time)
+	for _, d := range res.Downloads {
+		if d.Stale {
+			staleSince[d.Source.URL] = d.StaleSince
+		}
+	}
+	for _, src := range res.Sources {
+		line := src.URL
+		if src.Name != src.URL {
+			line = fmt.Sprintf("%s: %s", src.Name, src.URL)
+		}
+		if since, ok := staleSince[src.URL]; ok {
+			line += fmt.Sprintf(" (stale, cached %s)", since.Format(time.RFC3339))
+		}
+		header.WriteString(fmt.Sprintf("# - %s\n", line))
+	}
+	header.WriteString("#\n")
+	header.WriteString("####################################################################################\n\n")
+	return header.Bytes()
+}
+
+// WriteOutputs 将最终内容写入输出目录并拷贝到 publish 目录。
+func WriteOutputs(cfg *Config, res *Result) error {
+	content := res.Content
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", cfg.OutputDir, err)
+	}
+	if err := os.MkdirAll(cfg.PublishDir, 0755); err != nil {
+		return fmt.Errorf("failed to create publish directory '%s': %w", cfg.PublishDir, err)
+	}
+
+	outputFilePath := filepath.Join(cfg.OutputDir, cfg.OutputFile)
+	publishFilePath := filepath.Join(cfg.PublishDir, cfg.OutputFile)
+
+	if err := fileutil.WriteAtomic(outputFilePath, content); err != nil {
+		return fmt.Errorf("failed to write final output to '%s': %w", outputFilePath, err)
+	}
+	logging.Publisher.Info("✅ Wrote output", "path", outputFilePath)
+
+	// 拷贝到 publish 目录
+	if err := fileutil.WriteAtomic(publishFilePath, content); err != nil {
+		return fmt.Errorf("failed to copy output to '%s': %w", publishFilePath, err)
+	}
+	logging.Publisher.Info("✅ Copied output", "path", publishFilePath)
+	res.Published = append(res.Published, cfg.OutputFile)
+	res.Describe(cfg.OutputFile, "adguard", res.RuleCount)
+	return nil
+}
+
+// ReadPrevious 返回上一次发布的列表，用于缩水检查以及生成增量补丁、变更日志与作业摘要中的差异，
+// 需在 WriteOutputs 覆盖之前读取。发布目录中没有时（例如 CI 中每次重新生成发布目录）读取输出目录中
+// 提交到仓库的副本，都没有时返回 nil。
+func ReadPrevious(cfg *Config) ([]byte, error) {
+	for _, dir := range []string{cfg.PublishDir, cfg.OutputDir} {
+		path := filepath.Join(dir, cfg.OutputFile)
+		prev, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous list '%s': %w", path, err)
+		}
+		return prev, nil
+	}
+	return nil, nil
+}
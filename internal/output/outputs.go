@@ -0,0 +1,672 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"adguardlist/internal/compile"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/transform"
+)
+
+// FormatConfig 是一个额外输出格式的配置，与 AdGuard 规则列表由同一份编译结果生成。
+type FormatConfig struct {
+	Format            string  `yaml:"format"`
+	File              string  `yaml:"file"`                // 文件名，默认使用格式的默认文件名
+	Sinkhole          string  `yaml:"sinkhole"`            // hosts 格式中域名指向的地址，默认 0.0.0.0
+	Style             string  `yaml:"style"`               // dnsmasq 的写法或 unbound 的 local-zone 类型
+	Action            string  `yaml:"action"`              // rpz 格式的策略：nxdomain（默认）、nodata 或 cname
+	Target            string  `yaml:"target"`              // rpz 的 cname 目标域名，或 mikrotik-rsc 的转发地址
+	Category          string  `yaml:"category"`            // openwrt 格式文件头中的分类名称
+	SetName           string  `yaml:"set_name"`            // ipset 与 nftables 格式的集合名称
+	FalsePositiveRate float64 `yaml:"false_positive_rate"` // bloom 格式的误判率，默认 0.001
+}
+
+// outputFormat 描述一种额外输出格式。
+type outputFormat struct {
+	file    string // 默认文件名
+	comment string // 注释前缀，为空表示该格式不支持注释，不输出文件头
+	ips     bool   // 该格式由 IP 规则生成，见 outputList.ips
+	sources bool   // 该格式需要每条规则的来源，见 outputList.RuleSources
+	// check 校验该格式特有的选项并填充默认值，可以为 nil
+	check func(o *FormatConfig) error
+	// render 生成文件内容（不含文件头），返回内容与其中的条目数
+	render func(o FormatConfig, l *outputList) ([]byte, int)
+	// build 与 render 作用相同，用于依赖外部库、可能失败的二进制格式；两者只设置其一
+	build func(o FormatConfig, l *outputList) ([]byte, int, error)
+}
+
+// outputList 是生成额外输出格式所用的编译结果。
+type outputList struct {
+	domains []string // 被整体屏蔽的域名，见 BlockedDomainList
+	// excepted 与 suffixDomains 供覆盖子域名的格式使用，见 exceptionsUnder
+	excepted      []string
+	suffixDomains []string
+	rules         []string // 全部规则行（已去掉注释与空行）
+	ips           []string // 源中 IP 地址与网段屏蔽规则针对的地址
+	buildTime     time.Time
+	cfg           *Config
+	res           *Result
+	compiled      *compile.Result
+}
+
+// outputFormats 是支持的额外输出格式。
+var outputFormats = map[string]outputFormat{
+	"hosts":   {file: "hosts.txt", comment: "#", check: checkSinkhole, render: renderHosts},
+	"dnsmasq": {file: "dnsmasq.conf", comment: "#", check: checkStyle("address", "local"), render: renderDnsmasq},
+	"unbound": {file: "unbound.conf", comment: "#", check: checkStyle(unboundZoneTypes...), render: renderUnbound},
+	"rpz":     {file: "rpz.zone", comment: ";", check: checkRPZ, render: renderRPZ},
+	"pihole":  {file: "pihole.txt", comment: "#", render: renderPiholeDomains},
+	// pihole-regex 与 pihole 配套使用，包含无法表达为精确域名的通配符与正则规则
+	"pihole-regex": {file: "pihole_regex.txt", comment: "#", render: renderPiholeRegex},
+	"clash":        {file: "clash.yaml", comment: "#", render: renderClash},
+	// clash-domain 是 mihomo domain 类型规则集的文本形式，可用 `mihomo convert-ruleset domain text` 转换为 .mrs
+	"clash-domain": {file: "clash_domain.txt", comment: "#", render: suffixTemplate("+.%s")},
+	// Surge DOMAIN-SET 中前导点表示同时匹配域名及其子域名
+	"surge":       {file: "surge.txt", comment: "#", render: suffixTemplate(".%s")},
+	"quantumultx": {file: "quantumultx.list", comment: "#", render: suffixTemplate("HOST-SUFFIX,%s,reject")},
+	// SmartDNS 的 address /domain/# 返回 SOA（即屏蔽），同样覆盖子域名
+	"smartdns": {file: "smartdns.conf", comment: "#", render: renderSmartDNS},
+	// Blocky 的通配符条目 *.domain 匹配域名本身及其全部子域名
+	"blocky":   {file: "blocky.txt", comment: "#", render: suffixTemplate("*.%s")},
+	"dnscrypt": {file: "blocked-names.txt", comment: "#", render: renderDnscrypt},
+	// mikrotik-adlist 供 RouterOS 7.15+ 的 /ip dns adlist 订阅，格式与 hosts 相同
+	"mikrotik-adlist": {file: "mikrotik_adlist.txt", comment: "#", check: checkSinkhole, render: renderHosts},
+	"mikrotik-rsc":    {file: "mikrotik.rsc", comment: "#", check: checkMikrotikScript, render: renderMikrotikScript},
+	// openwrt 供 OpenWrt adblock 的自定义源使用：按字母排序的纯域名，文件头带有 Category 行
+	"openwrt": {file: "openwrt.txt", comment: "#", check: checkCategory, render: renderOpenWrt},
+	// pfblockerng 是 pfBlockerNG DNSBL 源使用的纯域名列表，域名会被解析到 pfBlockerNG 自身的 VIP
+	"pfblockerng": {file: "pfblockerng.txt", comment: "#", render: domainTemplate("%s")},
+	// ipset 与 nftables 由源中的 IP 地址与网段规则生成，这些规则在 DNS 列表中不起作用
+	"ipset":    {file: "ipset.txt", ips: true, check: checkSetName, render: renderIpset},
+	"nftables": {file: "nftables.nft", comment: "#", ips: true, check: checkSetName, render: renderNftables},
+	// json 包含全部规则及其来源与构建元数据，不带注释头部
+	"json": {file: "output.json", sources: true, render: renderJSON},
+	// protobuf 是 schema/domainset.proto 中 DomainSet 消息的二进制编码，不带注释头部
+	"protobuf": {file: "domains.pb", render: renderProtobuf},
+	// sqlite 与 json 内容相同，表结构见 sqliteSchema
+	"sqlite": {file: "rules.sqlite", sources: true, build: buildSQLite},
+	// bloom 是被屏蔽域名的布隆过滤器，文件结构见 bloom.go
+	"bloom": {file: "domains.bloom", check: checkFalsePositiveRate, render: renderBloom},
+}
+
+// defaultSinkhole 是 hosts 格式默认使用的黑洞地址。
+const defaultSinkhole = "0.0.0.0"
+
+// check 校验输出配置并填充默认值。
+func (o *FormatConfig) check() error {
+	f, ok := outputFormats[o.Format]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", o.Format)
+	}
+	if o.File == "" {
+		o.File = f.file
+	}
+	if filepath.Base(o.File) != o.File {
+		return fmt.Errorf("output %s: file must be a plain file name, got %q", o.Format, o.File)
+	}
+	if f.check != nil {
+		if err := f.check(o); err != nil {
+			return fmt.Errorf("output %s: %w", o.Format, err)
+		}
+	}
+	return nil
+}
+
+// checkSinkhole 校验 sinkhole 选项，默认 0.0.0.0。
+func checkSinkhole(o *FormatConfig) error {
+	if o.Sinkhole == "" {
+		o.Sinkhole = defaultSinkhole
+	}
+	if net.ParseIP(o.Sinkhole) == nil {
+		return fmt.Errorf("invalid sinkhole address %q", o.Sinkhole)
+	}
+	return nil
+}
+
+// checkStyle 返回校验 style 选项的函数，style 只能是 styles 之一，默认为第一个。
+func checkStyle(styles ...string) func(o *FormatConfig) error {
+	return func(o *FormatConfig) error {
+		if o.Style == "" {
+			o.Style = styles[0]
+		}
+		if !slices.Contains(styles, o.Style) {
+			return fmt.Errorf("style must be one of %s, got %q", strings.Join(styles, ", "), o.Style)
+		}
+		return nil
+	}
+}
+
+// BlockedDomainList 返回编译结果中被整体屏蔽的域名（不带修饰符的 "||domain^" 规则），
+// 去掉有同名例外规则的域名，保持规则的原有顺序。其他规则无法用纯域名格式表达，会被忽略。
+func BlockedDomainList(content []byte) []string {
+	lines := transform.SplitLines(content)
+	allowed := make(map[string]bool)
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "@@") {
+			if d, ok := transform.ParseAdblockRule(trimmed).Domain(); ok {
+				allowed[strings.ToLower(strings.TrimSuffix(d, "."))] = true
+			}
+		}
+	}
+	var domains []string
+	for _, line := range lines {
+		d, ok := transform.SimpleBlockedDomain(strings.TrimSpace(line))
+		if ok && !allowed[d] && !transform.IsIPAddress(d) {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// newOutputList 汇总生成额外输出格式所需的编译结果。
+func newOutputList(cfg *Config, res *Result, compiled *compile.Result) *outputList {
+	l := &outputList{
+		domains:   BlockedDomainList(compiled.Content),
+		ips:       compiled.IPTargets,
+		buildTime: res.BuildTime,
+		cfg:       cfg,
+		res:       res,
+		compiled:  compiled,
+	}
+	for _, line := range transform.SplitLines(compiled.Content) {
+		if trimmed := strings.TrimSpace(line); transform.IsRuleLine(trimmed) {
+			l.rules = append(l.rules, trimmed)
+		}
+	}
+	l.excepted, l.suffixDomains = exceptionsUnder(l.domains, allowedDomainList(l.rules))
+	return l
+}
+
+// exceptionsUnder 返回 allowed 中上级域名在 domains 中被屏蔽的例外域名（excepted），以及 domains 中
+// 去掉这些例外域名的上级域名后剩下的域名（suffix）。允许列表与关键域名保护会在被屏蔽的上级域名下
+// 追加例外规则，覆盖子域名的格式需要为 excepted 生成放行条目，无法表达放行的格式则改用 suffix，
+// 不屏蔽其上级域名，否则这些子域名仍然被屏蔽。
+func exceptionsUnder(domains, allowed []string) (excepted, suffix []string) {
+	blocked := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		blocked[d] = true
+	}
+	covering := make(map[string]bool)
+	for _, a := range allowed {
+		if !transform.HasBlockedParent(a, blocked) {
+			continue
+		}
+		excepted = append(excepted, a)
+		for p := a; strings.Contains(p, "."); {
+			p = p[strings.Index(p, ".")+1:]
+			if blocked[p] {
+				covering[p] = true
+			}
+		}
+	}
+	if len(covering) == 0 {
+		return excepted, domains
+	}
+	suffix = make([]string, 0, len(domains)-len(covering))
+	for _, d := range domains {
+		if !covering[d] {
+			suffix = append(suffix, d)
+		}
+	}
+	return excepted, suffix
+}
+
+// renderOutputHeader 生成额外输出文件的注释头部。
+func renderOutputHeader(cfg *Config, res *Result, format, comment string, count int) []byte {
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "%s Title: %s (%s format)\n", comment, cfg.Header.Title, format)
+	fmt.Fprintf(&header, "%s Version: %s\n", comment, res.BuildTime.Format("200601021504"))
+	fmt.Fprintf(&header, "%s Generated: %s\n", comment, res.BuildTime.Format(time.RFC3339))
+	fmt.Fprintf(&header, "%s Total entries: %d\n", comment, count)
+	fmt.Fprintf(&header, "%s Homepage: %s\n", comment, cfg.Header.HomepageURL())
+	fmt.Fprintf(&header, "%s\n", comment)
+	return header.Bytes()
+}
+
+// WriteExtraOutputs 按 cfg.Outputs 生成各额外格式的文件，与主输出一样写入输出目录与发布目录。
+// compiled 提供 IP 规则、规则来源等只在编译阶段可以得到的信息。
+func WriteExtraOutputs(cfg *Config, res *Result, compiled *compile.Result) error {
+	if len(cfg.Outputs) == 0 {
+		return nil
+	}
+	l := newOutputList(cfg, res, compiled)
+	for _, o := range cfg.Outputs {
+		f := outputFormats[o.Format]
+		var body []byte
+		var count int
+		if f.build != nil {
+			var err error
+			if body, count, err = f.build(o, l); err != nil {
+				return fmt.Errorf("failed to build %s output: %w", o.Format, err)
+			}
+		} else {
+			body, count = f.render(o, l)
+		}
+		var data []byte
+		if f.comment != "" {
+			data = renderOutputHeader(cfg, res, o.Format, f.comment, count)
+		}
+		data = append(data, body...)
+		for _, dir := range []string{cfg.OutputDir, cfg.PublishDir} {
+			path := filepath.Join(dir, o.File)
+			if err := fileutil.WriteAtomic(path, data); err != nil {
+				return fmt.Errorf("failed to write %s output to '%s': %w", o.Format, path, err)
+			}
+		}
+		logging.Publisher.Info("✅ Wrote output", "format", o.Format, "entries", count, "path", filepath.Join(cfg.PublishDir, o.File))
+		res.Published = append(res.Published, o.File)
+		res.Describe(o.File, o.Format, count)
+	}
+	return nil
+}
+
+// renderHosts 生成 /etc/hosts 格式的列表，每个域名指向 o.Sinkhole。
+func renderHosts(o FormatConfig, l *outputList) ([]byte, int) {
+	var b bytes.Buffer
+	for _, d := range l.domains {
+		fmt.Fprintf(&b, "%s %s\n", o.Sinkhole, d)
+	}
+	return b.Bytes(), len(l.domains)
+}
+
+// checkOutputs 校验 cfg.Outputs，文件名不能与主输出或其他输出重复。
+func checkOutputs(cfg *Config) error {
+	files := map[string]bool{cfg.OutputFile: true}
+	for i := range cfg.Outputs {
+		o := &cfg.Outputs[i]
+		if err := o.check(); err != nil {
+			return err
+		}
+		if files[o.File] {
+			return fmt.Errorf("output %s: file %q is already used by another output", o.Format, o.File)
+		}
+		files[o.File] = true
+	}
+	return nil
+}
+
+// renderDnsmasq 生成 dnsmasq 配置：address 写法为 "address=/domain/#"（返回 0.0.0.0/::），
+// local 写法为 "local=/domain/"（返回 NXDOMAIN）。两者都覆盖子域名，被屏蔽域名下的例外域名
+// 写作 "server=/domain/#"，dnsmasq 按最长的域名匹配，这些域名照常转发给上游。
+func renderDnsmasq(o FormatConfig, l *outputList) ([]byte, int) {
+	var b bytes.Buffer
+	for _, d := range l.domains {
+		if o.Style == "local" {
+			fmt.Fprintf(&b, "local=/%s/\n", d)
+		} else {
+			fmt.Fprintf(&b, "address=/%s/#\n", d)
+		}
+	}
+	for _, d := range l.excepted {
+		fmt.Fprintf(&b, "server=/%s/#\n", d)
+	}
+	return b.Bytes(), len(l.domains) + len(l.excepted)
+}
+
+// unboundZoneTypes 是 unbound 输出可用的 local-zone 类型，第一个为默认值。
+var unboundZoneTypes = []string{"always_nxdomain", "always_refuse", "always_null", "refuse", "static"}
+
+// renderUnbound 生成 unbound 配置片段 `local-zone: "domain" always_nxdomain`，
+// 可在 server: 段中通过 include 引用。local-zone 同样覆盖子域名，被屏蔽域名下的例外域名
+// 写作 transparent 类型的 local-zone，unbound 按最长的区域匹配，这些域名照常解析。
+func renderUnbound(o FormatConfig, l *outputList) ([]byte, int) {
+	var b bytes.Buffer
+	for _, d := range l.domains {
+		fmt.Fprintf(&b, "local-zone: \"%s\" %s\n", d, o.Style)
+	}
+	for _, d := range l.excepted {
+		fmt.Fprintf(&b, "local-zone: \"%s\" transparent\n", d)
+	}
+	return b.Bytes(), len(l.domains) + len(l.excepted)
+}
+
+// checkRPZ 校验 rpz 格式的 action 与 target。
+func checkRPZ(o *FormatConfig) error {
+	switch o.Action {
+	case "":
+		o.Action = "nxdomain"
+	case "nxdomain", "nodata":
+	case "cname":
+		target := strings.TrimSuffix(o.Target, ".")
+		if !transform.IsValidHostname(target) {
+			return fmt.Errorf("action cname requires a valid target domain, got %q", o.Target)
+		}
+		o.Target = target
+	default:
+		return fmt.Errorf("action must be nxdomain, nodata or cname, got %q", o.Action)
+	}
+	return nil
+}
+
+// renderRPZ 生成 BIND/PowerDNS 使用的 Response Policy Zone 文件。每个域名生成域名本身与
+// "*.domain" 两条记录以覆盖子域名，被屏蔽域名下的例外域名以同样的两条记录指向 rpz-passthru.，
+// 更具体的记录优先。SOA 序列号由构建版本换算而来，见 rpzSerial。
+func renderRPZ(o FormatConfig, l *outputList) ([]byte, int) {
+	rdata := "."
+	switch o.Action {
+	case "nodata":
+		rdata = "*."
+	case "cname":
+		rdata = o.Target + "."
+	}
+	var b bytes.Buffer
+	b.WriteString("$TTL 300\n")
+	fmt.Fprintf(&b, "@ IN SOA localhost. hostmaster.localhost. ( %d 3600 600 86400 300 )\n", rpzSerial(l.buildTime))
+	b.WriteString("  IN NS localhost.\n\n")
+	for _, d := range l.domains {
+		fmt.Fprintf(&b, "%s CNAME %s\n*.%s CNAME %s\n", d, rdata, d, rdata)
+	}
+	for _, d := range l.excepted {
+		fmt.Fprintf(&b, "%s CNAME rpz-passthru.\n*.%s CNAME rpz-passthru.\n", d, d)
+	}
+	return b.Bytes(), len(l.domains) + len(l.excepted)
+}
+
+// rpzSerial 将构建版本（200601021504）换算为 RFC 1912 推荐的 YYYYMMDDnn 形式的 SOA 序列号：
+// 前八位是版本中的日期，nn 是版本中的时刻所在的 15 分钟时段（00–95），例如版本 202610141930
+// 对应序列号 2026101478。同一时段内的两次构建序列号相同，运维人员可据此把区域文件对应到列表版本。
+func rpzSerial(t time.Time) uint32 {
+	date, _ := strconv.Atoi(t.Format("20060102"))
+	return uint32(date*100 + (t.Hour()*60+t.Minute())/15)
+}
+
+// renderPiholeDomains 生成 Pi-hole gravity 可订阅的纯域名列表。Pi-hole 的域名列表只精确匹配，
+// 子域名需要配合 pihole-regex 输出或 Pi-hole 自身的通配符设置。
+func renderPiholeDomains(o FormatConfig, l *outputList) ([]byte, int) {
+	return transform.JoinLines(l.domains, true), len(l.domains)
+}
+
+// renderPiholeRegex 将无法表达为精确域名的屏蔽规则转换为 Pi-hole 的正则（POSIX ERE）列表：
+// 含 * 的 "||ads*.example.com^" 转换为 "(^|\.)ads.*\.example\.com$"，
+// "/regex/" 规则在可以转换为 ERE 时原样保留。带修饰符与例外规则无法表达，会被跳过。
+func renderPiholeRegex(o FormatConfig, l *outputList) ([]byte, int) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, line := range l.rules {
+		r := transform.ParseAdblockRule(line)
+		if r.Allow || len(r.Modifiers) > 0 {
+			continue
+		}
+		re, ok := piholeRegex(r.Pattern)
+		if ok && !seen[re] {
+			seen[re] = true
+			out = append(out, re)
+		}
+	}
+	return transform.JoinLines(out, true), len(out)
+}
+
+// unsupportedEscape 匹配 POSIX ERE 不支持的字母数字转义，如 \b、\s、\1。
+var unsupportedEscape = regexp.MustCompile(`\\[a-zA-Z0-9]`)
+
+// piholeRegex 将 adblock 模式转换为 POSIX ERE，不需要或无法转换时返回 ok=false。
+func piholeRegex(pattern string) (string, bool) {
+	if transform.IsRegexRule(pattern) {
+		re := pattern[1 : len(pattern)-1]
+		re = strings.NewReplacer(`\d`, "[0-9]", `\w`, "[a-zA-Z0-9_]").Replace(re)
+		// ERE 不支持零宽断言、非贪婪匹配、\b 等转义类与反向引用
+		if strings.Contains(re, "(?") || strings.Contains(re, "*?") || strings.Contains(re, "+?") || unsupportedEscape.MatchString(re) {
+			return "", false
+		}
+		return re, true
+	}
+	if !strings.Contains(pattern, "*") {
+		return "", false
+	}
+	var prefix, suffix string
+	p := pattern
+	switch {
+	case strings.HasPrefix(p, "||"):
+		prefix, p = `(^|\.)`, p[2:]
+	case strings.HasPrefix(p, "|"):
+		prefix, p = "^", p[1:]
+	}
+	if strings.HasSuffix(p, "^") || strings.HasSuffix(p, "|") {
+		suffix, p = "$", p[:len(p)-1]
+	}
+	if strings.Trim(p, "*.") == "" || strings.ContainsAny(p, "/:^|") {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, c := range p {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '.':
+			b.WriteString(`\.`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteString(suffix)
+	return b.String(), true
+}
+
+// renderClash 生成 Clash rule-provider（behavior: classical）使用的 YAML 规则集。
+// DOMAIN-SUFFIX 覆盖子域名且规则集无法表达放行，使用 outputList.suffixDomains。
+func renderClash(o FormatConfig, l *outputList) ([]byte, int) {
+	var b bytes.Buffer
+	b.WriteString("payload:\n")
+	for _, d := range l.suffixDomains {
+		fmt.Fprintf(&b, "  - DOMAIN-SUFFIX,%s\n", d)
+	}
+	return b.Bytes(), len(l.suffixDomains)
+}
+
+// domainTemplate 返回按 format 为每个域名生成一行的 render 函数，format 中的 %s 为域名。
+func domainTemplate(format string) func(o FormatConfig, l *outputList) ([]byte, int) {
+	return func(o FormatConfig, l *outputList) ([]byte, int) {
+		var b bytes.Buffer
+		for _, d := range l.domains {
+			fmt.Fprintf(&b, format+"\n", d)
+		}
+		return b.Bytes(), len(l.domains)
+	}
+}
+
+// suffixTemplate 与 domainTemplate 相同，用于条目覆盖子域名且无法表达放行的格式，
+// 使用 outputList.suffixDomains。
+func suffixTemplate(format string) func(o FormatConfig, l *outputList) ([]byte, int) {
+	return func(o FormatConfig, l *outputList) ([]byte, int) {
+		var b bytes.Buffer
+		for _, d := range l.suffixDomains {
+			fmt.Fprintf(&b, format+"\n", d)
+		}
+		return b.Bytes(), len(l.suffixDomains)
+	}
+}
+
+// renderSmartDNS 生成 SmartDNS 配置：每个域名写作 "address /domain/#"，被屏蔽域名下的例外域名
+// 写作 "address /domain/-"，表示忽略上级域名的 address 规则。
+func renderSmartDNS(o FormatConfig, l *outputList) ([]byte, int) {
+	var b bytes.Buffer
+	for _, d := range l.domains {
+		fmt.Fprintf(&b, "address /%s/#\n", d)
+	}
+	for _, d := range l.excepted {
+		fmt.Fprintf(&b, "address /%s/-\n", d)
+	}
+	return b.Bytes(), len(l.domains) + len(l.excepted)
+}
+
+// renderDnscrypt 生成 dnscrypt-proxy 的 blocked-names.txt：纯域名条目本身就覆盖子域名
+// （放行需要单独的 allowed-names，因此使用 outputList.suffixDomains），
+// 含 * 的通配符规则转换为其模式语法，如 "||ads*.example.com^" 转换为 "ads*.example.com"，
+// 未锚定的 "banner*" 转换为 "*banner*"。
+func renderDnscrypt(o FormatConfig, l *outputList) ([]byte, int) {
+	lines := append([]string(nil), l.suffixDomains...)
+	seen := make(map[string]bool)
+	for _, line := range l.rules {
+		r := transform.ParseAdblockRule(line)
+		if r.Allow || len(r.Modifiers) > 0 || transform.IsRegexRule(r.Pattern) || !strings.Contains(r.Pattern, "*") {
+			continue
+		}
+		if p, ok := dnscryptPattern(r.Pattern); ok && !seen[p] {
+			seen[p] = true
+			lines = append(lines, p)
+		}
+	}
+	return transform.JoinLines(lines, true), len(lines)
+}
+
+// dnscryptPattern 将含通配符的 adblock 模式转换为 dnscrypt-proxy 的模式，无法转换时返回 ok=false。
+func dnscryptPattern(pattern string) (string, bool) {
+	p := pattern
+	anchoredStart := strings.HasPrefix(p, "|")
+	p = strings.TrimPrefix(strings.TrimPrefix(p, "|"), "|")
+	anchoredEnd := strings.HasSuffix(p, "^") || strings.HasSuffix(p, "|")
+	p = strings.TrimRight(p, "^|")
+	if strings.Trim(p, "*.") == "" || strings.ContainsAny(p, "/:^|") {
+		return "", false
+	}
+	if !anchoredStart && !strings.HasPrefix(p, "*") {
+		p = "*" + p
+	}
+	if !anchoredEnd && !strings.HasSuffix(p, "*") {
+		p += "*"
+	}
+	return p, true
+}
+
+// mikrotikComment 是 mikrotik-rsc 脚本添加的静态条目的注释，导入前用它删除上一次导入的条目。
+const mikrotikComment = "adguardlist"
+
+// checkMikrotikScript 校验 mikrotik-rsc 的 target，设置时必须是 IP 地址。
+func checkMikrotikScript(o *FormatConfig) error {
+	if o.Target != "" && net.ParseIP(o.Target) == nil {
+		return fmt.Errorf("target must be the IP address of the DNS server to forward to, got %q", o.Target)
+	}
+	return nil
+}
+
+// renderMikrotikScript 生成 RouterOS 的 .rsc 脚本，先删除上次导入的条目，再为每个域名添加
+// 匹配子域名的静态 DNS 条目：默认返回 NXDOMAIN，设置了 target 时改为 FWD 转发到该地址。
+// 静态条目无法表达放行，使用 outputList.suffixDomains。
+func renderMikrotikScript(o FormatConfig, l *outputList) ([]byte, int) {
+	entry := "type=NXDOMAIN"
+	if o.Target != "" {
+		entry = "type=FWD forward-to=" + o.Target
+	}
+	var b bytes.Buffer
+	b.WriteString("/ip dns static\n")
+	fmt.Fprintf(&b, "remove [find comment=%q]\n", mikrotikComment)
+	for _, d := range l.suffixDomains {
+		fmt.Fprintf(&b, "add name=%s %s match-subdomain=yes comment=%q\n", d, entry, mikrotikComment)
+	}
+	return b.Bytes(), len(l.suffixDomains)
+}
+
+// checkCategory 校验 openwrt 格式的 category，默认 "adguardlist"。
+func checkCategory(o *FormatConfig) error {
+	if o.Category == "" {
+		o.Category = "adguardlist"
+	}
+	if strings.ContainsAny(o.Category, " \t\r\n") {
+		return fmt.Errorf("category must not contain whitespace, got %q", o.Category)
+	}
+	return nil
+}
+
+// renderOpenWrt 生成 OpenWrt adblock/banIP 自定义源使用的列表：文件头中的 Category 行
+// 标明分类，正文为按字母排序、去重的小写域名，每行一个。adblock 同样屏蔽子域名，使用 outputList.suffixDomains。
+func renderOpenWrt(o FormatConfig, l *outputList) ([]byte, int) {
+	domains := append([]string(nil), l.suffixDomains...)
+	sort.Strings(domains)
+	domains = slices.Compact(domains)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Category: %s\n", o.Category)
+	b.Write(transform.JoinLines(domains, true))
+	return b.Bytes(), len(domains)
+}
+
+// CollectFor 返回 cfg 中的额外输出格式与分类列表在编译时需要额外收集的信息。
+func CollectFor(cfg *Config) compile.Collect {
+	need := func(need func(f outputFormat) bool) bool {
+		for _, o := range cfg.Outputs {
+			if need(outputFormats[o.Format]) {
+				return true
+			}
+		}
+		return false
+	}
+	return compile.Collect{
+		IPTargets:   need(func(f outputFormat) bool { return f.ips }),
+		RuleSources: need(func(f outputFormat) bool { return f.sources }),
+		Categories:  cfg.CategoryFile != "",
+	}
+}
+
+// checkSetName 校验 ipset 与 nftables 格式的集合名称，默认 "adguardlist"。
+func checkSetName(o *FormatConfig) error {
+	if o.SetName == "" {
+		o.SetName = "adguardlist"
+	}
+	if !setNamePattern.MatchString(o.SetName) {
+		return fmt.Errorf("set_name must consist of letters, digits, '_' and '-', got %q", o.SetName)
+	}
+	return nil
+}
+
+// setNamePattern 是 ipset 与 nftables 都接受的集合名称，ipset 限制名称不超过 31 个字符。
+var setNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,27}$`)
+
+// splitIPFamilies 将地址按 IPv4 与 IPv6 分开。
+func splitIPFamilies(ips []string) (v4, v6 []string) {
+	for _, ip := range ips {
+		if strings.Contains(ip, ":") {
+			v6 = append(v6, ip)
+		} else {
+			v4 = append(v4, ip)
+		}
+	}
+	return v4, v6
+}
+
+// renderIpset 生成 `ipset restore` 使用的文件，IPv4 与 IPv6 地址分别放入
+// set_name 加 "4"、"6" 后缀的 hash:net 集合，重复导入时不会报错。
+func renderIpset(o FormatConfig, l *outputList) ([]byte, int) {
+	v4, v6 := splitIPFamilies(l.ips)
+	var b bytes.Buffer
+	for _, set := range []struct {
+		name, family string
+		ips          []string
+	}{{o.SetName + "4", "inet", v4}, {o.SetName + "6", "inet6", v6}} {
+		fmt.Fprintf(&b, "create %s hash:net family %s -exist\n", set.name, set.family)
+		for _, ip := range set.ips {
+			fmt.Fprintf(&b, "add %s %s -exist\n", set.name, ip)
+		}
+	}
+	return b.Bytes(), len(l.ips)
+}
+
+// renderNftables 生成可用 `nft -f` 加载的集合定义，在 inet 表 set_name 中定义
+// set_name_v4 与 set_name_v6 两个 interval 集合，供防火墙规则引用。
+func renderNftables(o FormatConfig, l *outputList) ([]byte, int) {
+	v4, v6 := splitIPFamilies(l.ips)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "table inet %s {\n", o.SetName)
+	for _, set := range []struct {
+		suffix, typ string
+		ips         []string
+	}{{"_v4", "ipv4_addr", v4}, {"_v6", "ipv6_addr", v6}} {
+		fmt.Fprintf(&b, "\tset %s%s {\n\t\ttype %s\n\t\tflags interval\n", o.SetName, set.suffix, set.typ)
+		if len(set.ips) > 0 {
+			fmt.Fprintf(&b, "\t\telements = { %s }\n", strings.Join(set.ips, ", "))
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), len(l.ips)
+}
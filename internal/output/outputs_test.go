@@ -0,0 +1,48 @@
+package output
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"adguardlist/internal/compile"
+)
+
+// testList 由 content 生成额外输出格式所用的编译结果。
+func testList(content string) *outputList {
+	cfg := DefaultConfig()
+	res := &Result{BuildTime: time.Date(2026, 10, 14, 19, 30, 0, 0, time.UTC)}
+	return newOutputList(&cfg, res, &compile.Result{Content: []byte(content)})
+}
+
+// 允许列表与关键域名保护在被屏蔽的上级域名下追加的例外，在覆盖子域名的格式中同样生效。
+func TestExtraOutputsExceptionUnderBlockedParent(t *testing.T) {
+	l := testList("||example.com^\n||ads.example.org^\n||same.example.net^\n@@||cdn.example.com^$important\n@@||same.example.net^\n@@||other.example.org^\n")
+	tests := []struct {
+		format string
+		o      FormatConfig
+		want   string
+	}{
+		{"dnsmasq", FormatConfig{Style: "address"}, "address=/example.com/#\naddress=/ads.example.org/#\nserver=/cdn.example.com/#\n"},
+		{"dnsmasq", FormatConfig{Style: "local"}, "local=/example.com/\nlocal=/ads.example.org/\nserver=/cdn.example.com/#\n"},
+		{"unbound", FormatConfig{Style: "always_nxdomain"}, "local-zone: \"example.com\" always_nxdomain\nlocal-zone: \"ads.example.org\" always_nxdomain\nlocal-zone: \"cdn.example.com\" transparent\n"},
+		{"smartdns", FormatConfig{}, "address /example.com/#\naddress /ads.example.org/#\naddress /cdn.example.com/-\n"},
+		{"blocky", FormatConfig{}, "*.ads.example.org\n"},
+		{"clash", FormatConfig{}, "payload:\n  - DOMAIN-SUFFIX,ads.example.org\n"},
+		// 精确匹配的格式不受影响，同名例外规则仍然去掉该域名
+		{"hosts", FormatConfig{Sinkhole: "0.0.0.0"}, "0.0.0.0 example.com\n0.0.0.0 ads.example.org\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.o.Style, func(t *testing.T) {
+			got, _ := outputFormats[tt.format].render(tt.o, l)
+			if string(got) != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	rpz, _ := renderRPZ(FormatConfig{Action: "nxdomain"}, l)
+	if want := "cdn.example.com CNAME rpz-passthru.\n*.cdn.example.com CNAME rpz-passthru.\n"; !strings.HasSuffix(string(rpz), want) {
+		t.Errorf("renderRPZ() = %q, want it to end with %q", rpz, want)
+	}
+}
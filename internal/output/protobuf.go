@@ -0,0 +1,82 @@
+package output
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+
+	"adguardlist/internal/transform"
+)
+
+// protobuf 线格式中用到的字段类型。
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+// DomainSet 消息的字段编号，见 schema/domainset.proto。
+const (
+	domainSetTitle     = 1
+	domainSetVersion   = 2
+	domainSetGenerated = 3
+	domainSetBlocked   = 4
+	domainSetAllowed   = 5
+)
+
+// renderProtobuf 将屏蔽域名与例外域名编码为 schema/domainset.proto 中的 DomainSet 消息。
+// 编码很简单，直接按线格式写出，不需要引入 protobuf 运行库。
+func renderProtobuf(o FormatConfig, l *outputList) ([]byte, int) {
+	blocked := slices.Clone(l.domains)
+	slices.Sort(blocked)
+	allowed := allowedDomainList(l.rules)
+
+	b := appendProtoString(nil, domainSetTitle, l.cfg.Header.Title)
+	b = appendProtoString(b, domainSetVersion, l.buildTime.Format("200601021504"))
+	b = appendProtoVarint(b, domainSetGenerated, uint64(l.buildTime.Unix()))
+	for _, d := range blocked {
+		b = appendProtoString(b, domainSetBlocked, d)
+	}
+	for _, d := range allowed {
+		b = appendProtoString(b, domainSetAllowed, d)
+	}
+	return b, len(blocked)
+}
+
+// allowedDomainList 返回不带修饰符（$important 除外）的例外域名规则放行的域名，已排序去重。
+func allowedDomainList(rules []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, line := range rules {
+		r := transform.ParseAdblockRule(line)
+		if !r.Allow || !strings.HasPrefix(r.Pattern, "||") {
+			continue
+		}
+		if len(r.Modifiers) > 1 || len(r.Modifiers) == 1 && !strings.EqualFold(r.Modifiers[0], "important") {
+			continue
+		}
+		d, ok := r.Domain()
+		if !ok {
+			continue
+		}
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// appendProtoString 追加一个 string 类型的字段。
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendProtoVarint 追加一个 varint 类型（int64、bool 等）的字段。
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoVarint)
+	return binary.AppendUvarint(b, v)
+}
@@ -0,0 +1,81 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"adguardlist/internal/compile"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+)
+
+// WriteSourceReport 将每个源的贡献统计写入输出目录下的 cfg.SourceReport，配置为空时不生成。
+func WriteSourceReport(cfg *Config, stats []compile.SourceStats) error {
+	if cfg.SourceReport == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	b.WriteString("# Per-source contribution: rules fetched, rules kept after dedupe, and rules found in no other source\n")
+	b.WriteString("# source\tformat\tbytes\tfetched\tkept\tunique\tunique %\n")
+	for _, st := range stats {
+		fmt.Fprintf(&b, "%s\t%s\t%d\t%d\t%d\t%d\t%.1f\n", st.Name, st.Format, st.Bytes, st.Rules, st.Kept(), st.Unique, st.UniquePercent())
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", cfg.OutputDir, err)
+	}
+	path := filepath.Join(cfg.OutputDir, cfg.SourceReport)
+	if err := fileutil.WriteAtomic(path, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write source report to '%s': %w", path, err)
+	}
+	return nil
+}
+
+// WriteRejectedReport 将被拒绝的规则写入输出目录下的 cfg.RejectedReport，配置为空时不生成。
+func WriteRejectedReport(cfg *Config, rejected []compile.RejectedRule) error {
+	if cfg.RejectedReport == "" {
+		return nil
+	}
+	path := filepath.Join(cfg.OutputDir, cfg.RejectedReport)
+	if len(rejected) > 0 {
+		logging.Compiler.Info("🚫 Rejected invalid rules", "count", len(rejected), "report", path)
+	}
+	var b bytes.Buffer
+	b.WriteString("# Lines dropped because they are not valid AdGuard DNS filtering rules\n")
+	b.WriteString("# source\tline\treason\trule\n")
+	for _, r := range rejected {
+		fmt.Fprintf(&b, "%s\t%d\t%s\t%s\n", r.Source, r.Line, r.Reason, r.Rule)
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", cfg.OutputDir, err)
+	}
+	if err := fileutil.WriteAtomic(path, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write rejected rules report to '%s': %w", path, err)
+	}
+	return nil
+}
+
+// WriteConflictReport 将冲突写入输出目录下的 cfg.ConflictReport，配置为空时不生成。
+func WriteConflictReport(cfg *Config, conflicts []compile.Conflict) error {
+	if cfg.ConflictReport == "" {
+		return nil
+	}
+	if len(conflicts) > 0 {
+		logging.Compiler.Info("⚔️ Found block/allow conflicts", "count", len(conflicts), "report", filepath.Join(cfg.OutputDir, cfg.ConflictReport))
+	}
+	var b bytes.Buffer
+	b.WriteString("# Domains blocked by one source and allowed by another (or by the allowlist)\n")
+	b.WriteString("# domain\tblocked by\tallowed by\tresolution\n")
+	for _, c := range conflicts {
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\n", c.Domain, c.BlockedBy, c.AllowedBy, c.Resolution)
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", cfg.OutputDir, err)
+	}
+	path := filepath.Join(cfg.OutputDir, cfg.ConflictReport)
+	if err := fileutil.WriteAtomic(path, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write conflict report to '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+)
+
+// SigningConfig 控制发布文件的签名。配置中只写环境变量名，密钥本身通过 CI 的 secret 注入；
+// 变量名留空表示不使用该签名方式，变量为空时跳过签名并给出警告，便于没有 secret 的 fork 正常构建。
+type SigningConfig struct {
+	MinisignKeyEnv      string `yaml:"minisign_key_env"`
+	MinisignPasswordEnv string `yaml:"minisign_password_env"`
+	GPGKeyEnv           string `yaml:"gpg_key_env"`
+	GPGPassphraseEnv    string `yaml:"gpg_passphrase_env"`
+	GPGKeyID            string `yaml:"gpg_key_id"`
+}
+
+// 签名文件的扩展名。
+const (
+	minisignSigExt = ".minisig"
+	gpgSigExt      = ".asc"
+)
+
+// SignPublished 为 res.Published 中的每个文件生成 minisign 与 GPG 分离签名，
+// 签名文件写在原文件旁边并加入 res.Published。
+func SignPublished(ctx context.Context, cfg *Config, res *Result) error {
+	sc := cfg.Signing
+	files := append([]string(nil), res.Published...)
+	var signed []string
+
+	if key, ok := signingSecret("minisign", sc.MinisignKeyEnv); ok {
+		sk, err := parseMinisignKey(key, os.Getenv(sc.MinisignPasswordEnv))
+		if err != nil {
+			return fmt.Errorf("failed to load minisign key from $%s: %w", sc.MinisignKeyEnv, err)
+		}
+		for _, name := range files {
+			path := filepath.Join(cfg.PublishDir, name)
+			sig, err := sk.signFile(path, name, time.Now())
+			if err != nil {
+				return fmt.Errorf("failed to sign '%s' with minisign: %w", path, err)
+			}
+			if err := fileutil.WriteAtomic(path+minisignSigExt, sig); err != nil {
+				return fmt.Errorf("failed to write signature to '%s': %w", path+minisignSigExt, err)
+			}
+			signed = append(signed, name+minisignSigExt)
+			res.Describe(name+minisignSigExt, "minisign signature", 0)
+		}
+		logging.Publisher.Info("✍️ Signed published files with minisign", "files", len(files), "key_id", sk.id())
+	}
+
+	if key, ok := signingSecret("GPG", sc.GPGKeyEnv); ok {
+		if err := gpgSign(ctx, cfg, key, files); err != nil {
+			return err
+		}
+		for _, name := range files {
+			signed = append(signed, name+gpgSigExt)
+			res.Describe(name+gpgSigExt, "gpg signature", 0)
+		}
+		logging.Publisher.Info("✍️ Signed published files with GPG", "files", len(files))
+	}
+
+	res.Published = append(res.Published, signed...)
+	return nil
+}
+
+// signingSecret 读取环境变量 env 中的密钥，未配置或为空时返回 ok=false。
+func signingSecret(kind, env string) (string, bool) {
+	if env == "" {
+		return "", false
+	}
+	v := os.Getenv(env)
+	if v == "" {
+		logging.Publisher.Warn("⚠️ Signing is configured but the key variable is empty, skipping", "kind", kind, "env", env)
+		return "", false
+	}
+	return v, true
+}
+
+// minisignKey 是解密后的 minisign 私钥。
+type minisignKey struct {
+	keyNum [8]byte
+	priv   ed25519.PrivateKey
+}
+
+// minisign 私钥文件解码后的长度：算法标识、KDF 参数与加密的密钥数据。
+const minisignSecretKeyLen = 2 + 2 + 2 + 32 + 8 + 8 + 104
+
+// parseMinisignKey 解析 minisign 私钥文件的内容（"untrusted comment" 行与 base64 行），
+// 密钥加密时用 password 解密。
+func parseMinisignKey(text, password string) (*minisignKey, error) {
+	raw, err := decodeMinisignBlock(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != minisignSecretKeyLen {
+		return nil, fmt.Errorf("invalid secret key length %d", len(raw))
+	}
+	sigAlg, kdfAlg, cksumAlg := raw[0:2], raw[2:4], raw[4:6]
+	if string(sigAlg) != "Ed" || string(cksumAlg) != "B2" {
+		return nil, fmt.Errorf("unsupported key algorithm %q/%q", sigAlg, cksumAlg)
+	}
+	salt := raw[6:38]
+	opsLimit := binary.LittleEndian.Uint64(raw[38:46])
+	memLimit := binary.LittleEndian.Uint64(raw[46:54])
+	data := append([]byte(nil), raw[54:]...)
+
+	switch string(kdfAlg) {
+	case "Sc":
+		if password == "" {
+			return nil, errors.New("key is encrypted but no password is set")
+		}
+		n, r, p := minisignScryptParams(opsLimit, memLimit)
+		stream, err := scrypt.Key([]byte(password), salt, n, r, p, len(data))
+		if err != nil {
+			return nil, err
+		}
+		subtle.XORBytes(data, data, stream)
+	case "\x00\x00":
+		// 未加密的密钥（minisign -W）
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", kdfAlg)
+	}
+
+	k := &minisignKey{priv: ed25519.PrivateKey(data[8:72])}
+	copy(k.keyNum[:], data[0:8])
+	h, _ := blake2b.New256(nil)
+	h.Write(sigAlg)
+	h.Write(data[0:72])
+	if subtle.ConstantTimeCompare(h.Sum(nil), data[72:104]) != 1 {
+		return nil, errors.New("wrong password or corrupted key")
+	}
+	return k, nil
+}
+
+// minisignScryptParams 按 libsodium 的 pickparams 将 opslimit/memlimit 换算为 scrypt 的 N、r、p，
+// 与 minisign 加密私钥时使用的参数一致。
+func minisignScryptParams(opsLimit, memLimit uint64) (n, r, p int) {
+	if opsLimit < 32768 {
+		opsLimit = 32768
+	}
+	r = 8
+	var maxN uint64
+	if opsLimit < memLimit/32 {
+		p = 1
+		maxN = opsLimit / uint64(r*4)
+	} else {
+		maxN = memLimit / uint64(r*128)
+	}
+	nLog2 := uint(1)
+	for ; nLog2 < 63; nLog2++ {
+		if uint64(1)<<nLog2 > maxN/2 {
+			break
+		}
+	}
+	if p == 0 {
+		maxrp := (opsLimit / 4) / (uint64(1) << nLog2)
+		if maxrp > 0x3fffffff {
+			maxrp = 0x3fffffff
+		}
+		p = int(maxrp) / r
+	}
+	return 1 << nLog2, r, p
+}
+
+// decodeMinisignBlock 返回 minisign 文件中第一个非注释行的 base64 解码结果。
+func decodeMinisignBlock(text string) ([]byte, error) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(line)
+	}
+	return nil, errors.New("no key data found")
+}
+
+// id 返回 minisign 显示的密钥 ID。
+func (k *minisignKey) id() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.keyNum[:]))
+}
+
+// signFile 生成 path 的 minisign 签名（预哈希的 "ED" 格式），trusted comment 中记录时间与文件名。
+func (k *minisignKey) signFile(path, name string, now time.Time) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, _ := blake2b.New512(nil)
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(k.priv, h.Sum(nil))
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", now.Unix(), name)
+	global := ed25519.Sign(k.priv, append(append([]byte(nil), sig...), trusted...))
+
+	blob := append(append([]byte("ED"), k.keyNum[:]...), sig...)
+	var b bytes.Buffer
+	b.WriteString("untrusted comment: signature from minisign secret key\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(blob) + "\n")
+	b.WriteString("trusted comment: " + trusted + "\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(global) + "\n")
+	return b.Bytes(), nil
+}
+
+// gpgSign 将 key（ASCII armored 私钥）导入临时的 GnuPG 目录，
+// 为 files 中的每个文件生成 ASCII armored 分离签名，结束后删除该目录。
+func gpgSign(ctx context.Context, cfg *Config, key string, files []string) error {
+	sc := cfg.Signing
+	home, err := os.MkdirTemp("", "adguardlist-gnupg-")
+	if err != nil {
+		return fmt.Errorf("failed to create GnuPG home: %w", err)
+	}
+	defer os.RemoveAll(home)
+	// 导入私钥会启动 gpg-agent，退出前关闭它以免残留进程占用已删除的目录
+	defer exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+
+	if err := runGPG(ctx, home, key, "--import"); err != nil {
+		return fmt.Errorf("failed to import GPG key from $%s: %w", sc.GPGKeyEnv, err)
+	}
+	var passphrase string
+	if sc.GPGPassphraseEnv != "" {
+		passphrase = os.Getenv(sc.GPGPassphraseEnv)
+	}
+	for _, name := range files {
+		path := filepath.Join(cfg.PublishDir, name)
+		args := []string{"--armor", "--detach-sign", "--output", path + gpgSigExt}
+		if passphrase != "" {
+			args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+		}
+		if sc.GPGKeyID != "" {
+			args = append(args, "--local-user", sc.GPGKeyID)
+		}
+		if err := runGPG(ctx, home, passphrase, append(args, path)...); err != nil {
+			return fmt.Errorf("failed to sign '%s' with GPG: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// runGPG 以批处理模式在 home 中执行 gpg，stdin 作为标准输入，失败时错误中附带标准错误输出。
+func runGPG(ctx context.Context, home, stdin string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "gpg", append([]string{"--batch", "--yes", "--no-tty", "--homedir", home}, args...)...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("gpg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package output
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"adguardlist/internal/transform"
+)
+
+// sqliteSchema 是 sqlite 输出格式的表结构：meta 保存构建元数据，sources 保存各源的状态与贡献统计，
+// rules 保存全部规则及其来源，domain 列为域名规则匹配的域名，可以直接查询哪个源屏蔽了某个域名。
+const sqliteSchema = `
+CREATE TABLE meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE sources (
+	id           INTEGER PRIMARY KEY,
+	name         TEXT NOT NULL,
+	url          TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	format       TEXT,
+	bytes        INTEGER NOT NULL,
+	lines        INTEGER NOT NULL,
+	fetched      INTEGER NOT NULL,
+	duplicates   INTEGER NOT NULL,
+	repeated     INTEGER NOT NULL,
+	rejected     INTEGER NOT NULL,
+	unique_rules INTEGER NOT NULL,
+	rules        INTEGER NOT NULL
+);
+CREATE TABLE rules (
+	id        INTEGER PRIMARY KEY,
+	rule      TEXT NOT NULL,
+	allow     INTEGER NOT NULL,
+	domain    TEXT,
+	source_id INTEGER REFERENCES sources(id)
+);
+`
+
+// sqliteIndexes 在写入全部数据后创建，比逐行维护索引快得多。
+const sqliteIndexes = `CREATE INDEX rules_domain ON rules(domain);`
+
+// buildSQLite 在临时文件中生成 SQLite 数据库并返回其内容，数据与 json 格式相同。
+func buildSQLite(o FormatConfig, l *outputList) ([]byte, int, error) {
+	list := newJSONList(l)
+	tmp, err := os.CreateTemp("", "adguardlist-*.sqlite")
+	if err != nil {
+		return nil, 0, err
+	}
+	path := tmp.Name()
+	tmp.Close()
+	defer os.Remove(path)
+
+	if err := fillSQLite(path, list); err != nil {
+		return nil, 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, len(list.Rules), nil
+}
+
+// fillSQLite 在 path 处创建表并写入 list。
+func fillSQLite(path string, list jsonList) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// 数据库只在本次构建中生成一次，不需要日志与同步写入
+	if _, err := db.Exec("PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF;" + sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	meta := [][2]string{
+		{"title", list.Title},
+		{"version", list.Version},
+		{"generated", list.Generated.Format(time.RFC3339)},
+		{"expires", list.Expires},
+		{"homepage", list.Homepage},
+		{"rules", strconv.Itoa(list.Counts.Rules)},
+		{"sources", strconv.Itoa(list.Counts.Sources)},
+		{"succeeded", strconv.Itoa(list.Counts.Succeeded)},
+		{"failed", strconv.Itoa(list.Counts.Failed)},
+		{"stale", strconv.Itoa(list.Counts.Stale)},
+		{"excluded", strconv.Itoa(list.Counts.Excluded)},
+		{"dead", strconv.Itoa(list.Counts.Dead)},
+		{"truncated", strconv.Itoa(list.Counts.Truncated)},
+	}
+	for _, kv := range meta {
+		if _, err := tx.Exec("INSERT INTO meta (key, value) VALUES (?, ?)", kv[0], kv[1]); err != nil {
+			return fmt.Errorf("failed to insert metadata: %w", err)
+		}
+	}
+
+	sourceIDs := make(map[string]int, len(list.Sources))
+	for i, s := range list.Sources {
+		id := i + 1
+		if _, ok := sourceIDs[s.Name]; !ok {
+			sourceIDs[s.Name] = id
+		}
+		if _, err := tx.Exec("INSERT INTO sources (id, name, url, status, format, bytes, lines, fetched, duplicates, repeated, rejected, unique_rules, rules) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			id, s.Name, s.URL, s.Status, nullString(s.Format), s.Bytes, s.Lines, s.Fetched, s.Duplicates, s.Repeated, s.Rejected, s.Unique, s.Rules); err != nil {
+			return fmt.Errorf("failed to insert source %s: %w", s.Name, err)
+		}
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO rules (rule, allow, domain, source_id) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, rule := range list.Rules {
+		r := transform.ParseAdblockRule(rule.Rule)
+		var domain sql.NullString
+		if d, ok := r.Domain(); ok {
+			domain = nullString(strings.ToLower(strings.TrimSuffix(d, ".")))
+		}
+		var source sql.NullInt64
+		if id, ok := sourceIDs[rule.Source]; ok {
+			source = sql.NullInt64{Int64: int64(id), Valid: true}
+		}
+		if _, err := stmt.Exec(rule.Rule, r.Allow, domain, source); err != nil {
+			return fmt.Errorf("failed to insert rule %q: %w", rule.Rule, err)
+		}
+	}
+	if _, err := tx.Exec(sqliteIndexes); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// nullString 将空字符串转换为 SQL NULL。
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,162 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/transform"
+)
+
+// AdGuardHomeConfig 是构建成功后通知的 AdGuard Home 实例，让其立即使用新的规则而不必等待更新间隔。
+// Mode 为 refresh 时确保 FilterURL 已添加为过滤器（不存在时以 Name 添加）并强制刷新全部过滤器；
+// 为 user_rules 时将合并列表直接写入自定义规则，适合实例无法访问发布地址的情况（列表很大时不推荐）。
+// URL 与 Username 可写 ${VAR}，密码从环境变量 PasswordEnv 读取；FilterURL 为空时使用合并列表的发布地址。
+// 实例通常在内网中，只有在能访问它的机器上运行构建时才适用。
+type AdGuardHomeConfig struct {
+	URL         string `yaml:"url"`
+	Username    string `yaml:"username"`
+	PasswordEnv string `yaml:"password_env"`
+	Mode        string `yaml:"mode"`
+	FilterURL   string `yaml:"filter_url"`
+	Name        string `yaml:"name"`
+}
+
+// AdGuard Home 的更新方式。
+const (
+	adguardHomeRefresh   = "refresh"
+	adguardHomeUserRules = "user_rules"
+)
+
+// adguardHomeClient 调用 AdGuard Home 的控制接口。
+type adguardHomeClient struct {
+	base     string
+	username string
+	password string
+}
+
+// do 以 JSON 发送 payload（可以为 nil），2xx 的 JSON 响应解码到 out（可以为 nil）。
+func (c *adguardHomeClient) do(ctx context.Context, method, endpoint string, payload, out any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+endpoint, body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// publish 按 ac.Mode 更新实例。
+func (ac AdGuardHomeConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	c := &adguardHomeClient{
+		base:     strings.TrimSuffix(os.ExpandEnv(ac.URL), "/"),
+		username: os.ExpandEnv(ac.Username),
+		password: os.Getenv(ac.PasswordEnv),
+	}
+	if ac.Mode == adguardHomeUserRules {
+		rules := transform.SplitLines(res.Content)
+		if err := c.do(ctx, http.MethodPost, "/control/filtering/set_rules", map[string]any{"rules": rules}, nil); err != nil {
+			return fmt.Errorf("failed to set user rules: %w", err)
+		}
+		logging.Publisher.Info("🏠 Updated AdGuard Home user rules", "server", c.base, "rules", res.RuleCount)
+		return nil
+	}
+
+	filterURL := os.ExpandEnv(ac.FilterURL)
+	if filterURL == "" {
+		if base := output.PublishBaseURL(cfg); base != "" {
+			filterURL = base + cfg.OutputFile
+		}
+	}
+	if filterURL != "" {
+		var status struct {
+			Filters []struct {
+				URL string `json:"url"`
+			} `json:"filters"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/control/filtering/status", nil, &status); err != nil {
+			return fmt.Errorf("failed to read filters: %w", err)
+		}
+		found := false
+		for _, f := range status.Filters {
+			found = found || f.URL == filterURL
+		}
+		if !found {
+			name := ac.Name
+			if name == "" {
+				name = cfg.Header.Title
+			}
+			add := map[string]any{"name": name, "url": filterURL, "whitelist": false}
+			if err := c.do(ctx, http.MethodPost, "/control/filtering/add_url", add, nil); err != nil {
+				return fmt.Errorf("failed to add filter %s: %w", filterURL, err)
+			}
+			logging.Publisher.Info("🏠 Added filter to AdGuard Home", "server", c.base, "url", filterURL)
+		}
+	}
+	var refreshed struct {
+		Updated int `json:"updated"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/control/filtering/refresh", map[string]any{"whitelist": false}, &refreshed); err != nil {
+		return fmt.Errorf("failed to refresh filters: %w", err)
+	}
+	logging.Publisher.Info("🏠 Refreshed AdGuard Home filters", "server", c.base, "updated", refreshed.Updated)
+	return nil
+}
+
+// checkAdGuardHome 校验 publishers.adguard_home 并填充默认值：mode 默认为 refresh，
+// password_env 默认为 ADGUARD_HOME_PASSWORD。
+func checkAdGuardHome(instances []AdGuardHomeConfig) error {
+	for i := range instances {
+		ac := &instances[i]
+		if ac.Mode == "" {
+			ac.Mode = adguardHomeRefresh
+		}
+		if ac.PasswordEnv == "" {
+			ac.PasswordEnv = "ADGUARD_HOME_PASSWORD"
+		}
+		if ac.Mode != adguardHomeRefresh && ac.Mode != adguardHomeUserRules {
+			return fmt.Errorf("publishers.adguard_home[%d].mode must be %q or %q, got %q", i, adguardHomeRefresh, adguardHomeUserRules, ac.Mode)
+		}
+		if ac.URL == "" {
+			return fmt.Errorf("publishers.adguard_home[%d].url must not be empty", i)
+		}
+		if os.Expand(ac.URL, func(string) string { return "" }) == ac.URL {
+			if u, err := url.Parse(ac.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("publishers.adguard_home[%d].url must be an http(s) url", i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// CloudflareConfig 将发布文件写入 Cloudflare Workers KV，并可触发 Cloudflare Pages 的部署，
+// 供访问 GitHub 缓慢或受限的用户使用。KV 的键为 KeyPrefix 加文件的相对路径，值为文件内容，
+// 元数据中的 content_type 供 Worker 返回正确的 Content-Type。API token 从环境变量 TokenEnv 读取，
+// 需要 Workers KV Storage 的编辑权限；AccountID 与 NamespaceID 可写 ${VAR}。
+// 设置 PagesDeployHookEnv 时，上传后向该环境变量中的 deploy hook 地址发送 POST，
+// 让连接到仓库（例如 release 分支）的 Pages 项目重新部署。
+type CloudflareConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	AccountID          string `yaml:"account_id"`
+	NamespaceID        string `yaml:"namespace_id"` // 为空时不写入 KV，只触发 Pages 部署
+	TokenEnv           string `yaml:"token_env"`
+	APIURL             string `yaml:"api_url"`
+	KeyPrefix          string `yaml:"key_prefix"`
+	PagesDeployHookEnv string `yaml:"pages_deploy_hook_env"`
+}
+
+// KV 批量写入接口单次请求的限制：最多 10000 个键，请求体不超过 100MB（此处留出余量）。
+const (
+	kvBulkMaxKeys  = 10000
+	kvBulkMaxBytes = 90 << 20
+)
+
+// kvPair 是 KV 批量写入接口的一项。
+type kvPair struct {
+	Key      string         `json:"key"`
+	Value    string         `json:"value"`
+	Base64   bool           `json:"base64"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// publish 写入 KV 并触发 Pages 部署。
+func (cc CloudflareConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	if ns := os.ExpandEnv(cc.NamespaceID); ns != "" {
+		if err := cc.writeKV(ctx, cfg, res, ns); err != nil {
+			return err
+		}
+	}
+	if cc.PagesDeployHookEnv == "" {
+		return nil
+	}
+	hook := os.Getenv(cc.PagesDeployHookEnv)
+	if hook == "" {
+		return fmt.Errorf("$%s is not set", cc.PagesDeployHookEnv)
+	}
+	if err := PostBody(ctx, hook, nil, http.Header{}, "cloudflare pages deploy hook"); err != nil {
+		return err
+	}
+	logging.Publisher.Info("🚀 Triggered Cloudflare Pages deployment")
+	return nil
+}
+
+// writeKV 以批量写入接口将 uploadFiles 中的全部文件写入命名空间 ns。
+func (cc CloudflareConfig) writeKV(ctx context.Context, cfg *output.Config, res *output.Result, ns string) error {
+	token := os.Getenv(cc.TokenEnv)
+	if token == "" {
+		return fmt.Errorf("$%s is not set", cc.TokenEnv)
+	}
+	endpoint := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/bulk",
+		strings.TrimSuffix(cc.APIURL, "/"), os.ExpandEnv(cc.AccountID), ns)
+	version := res.BuildTime.Format("200601021504")
+
+	var batch []kvPair
+	var size, total int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := cloudflareRequest(ctx, http.MethodPut, endpoint, token, batch); err != nil {
+			return fmt.Errorf("failed to write %d keys to workers kv: %w", len(batch), err)
+		}
+		total += len(batch)
+		batch, size = nil, 0
+		return nil
+	}
+	for _, name := range uploadFiles(cfg, res) {
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		pair := kvPair{
+			Key:      path.Join(cc.KeyPrefix, name),
+			Value:    base64.StdEncoding.EncodeToString(data),
+			Base64:   true,
+			Metadata: map[string]any{"content_type": publishContentType(name), "version": version},
+		}
+		if len(batch) == kvBulkMaxKeys || (len(batch) > 0 && size+len(pair.Value) > kvBulkMaxBytes) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, pair)
+		size += len(pair.Value)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	logging.Publisher.Info("☁️ Wrote Workers KV keys", "namespace", ns, "keys", total)
+	return nil
+}
+
+// cloudflareRequest 调用 Cloudflare API，payload 以 JSON 发送；响应的 success 为 false 时返回其中的错误。
+func cloudflareRequest(ctx context.Context, method, endpoint, token string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("%s returned %s: %s", method, resp.Status, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+	if !result.Success || resp.StatusCode/100 != 2 {
+		var msgs []string
+		for _, e := range result.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("%s returned %s: %s", method, resp.Status, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// check 校验 cloudflare 配置。
+func (cc CloudflareConfig) check() error {
+	if !cc.Enabled {
+		return nil
+	}
+	if cc.NamespaceID == "" && cc.PagesDeployHookEnv == "" {
+		return fmt.Errorf("publishers.cloudflare requires namespace_id or pages_deploy_hook_env")
+	}
+	if cc.NamespaceID != "" && (cc.AccountID == "" || cc.TokenEnv == "" || cc.APIURL == "") {
+		return fmt.Errorf("publishers.cloudflare requires account_id, token_env and api_url to write workers kv")
+	}
+	if strings.HasPrefix(cc.KeyPrefix, "/") {
+		return fmt.Errorf("publishers.cloudflare.key_prefix must not start with /")
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"adguardlist/internal/logging"
+)
+
+// ftpConn 是 FTP 的控制连接。
+type ftpConn struct {
+	ctx  context.Context
+	u    *url.URL
+	text *textproto.Conn
+	tls  *tls.Config // ftps 时用于控制与数据连接，否则为 nil
+	epsv bool        // 服务器不支持 EPSV 后改用 PASV
+}
+
+// uploadFTP 通过 FTP（ftps 时为显式 TLS）将 files 上传到 dir。
+func uploadFTP(ctx context.Context, u *url.URL, password, dir string, names []string, files map[string][]byte) error {
+	conn, closeConn, err := dialRemote(ctx, u, "21")
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	c := &ftpConn{ctx: ctx, u: u, text: textproto.NewConn(conn), epsv: true}
+	if _, err := c.expect(2); err != nil {
+		return err
+	}
+	if u.Scheme == "ftps" {
+		if _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			return err
+		}
+		// 数据连接复用控制连接的 TLS 会话，多数服务器要求这样做
+		c.tls = &tls.Config{ServerName: u.Hostname(), ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+		c.text = textproto.NewConn(tls.Client(conn, c.tls))
+		if _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+	}
+	code, err := c.cmd(0, "USER %s", u.User.Username())
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		if _, err := c.cmd(2, "PASS %s", password); err != nil {
+			return err
+		}
+	} else if code/100 != 2 {
+		return fmt.Errorf("ftp login failed: USER returned %d", code)
+	}
+	if _, err := c.cmd(2, "TYPE I"); err != nil {
+		return err
+	}
+	for _, d := range remoteDirs(dir, names) {
+		// 目录已存在时 MKD 返回 550，上传时自然会报告真正的错误
+		c.cmd(0, "MKD %s", d)
+	}
+	for _, name := range names {
+		target := path.Join(dir, name)
+		if err := c.upload(target, files[name]); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", target, err)
+		}
+		logging.Publisher.Debug("⬆️ Uploaded file", "path", target, "bytes", len(files[name]))
+	}
+	c.cmd(0, "QUIT")
+	return nil
+}
+
+// cmd 发送命令并读取响应，class 不为 0 时要求响应码以 class 开头。
+func (c *ftpConn) cmd(class int, format string, args ...any) (int, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, err
+	}
+	verb, _, _ := strings.Cut(format, " ")
+	code, err := c.expect(class)
+	if err != nil {
+		return code, fmt.Errorf("ftp %s failed: %w", verb, err)
+	}
+	return code, nil
+}
+
+// expect 读取一个响应，class 不为 0 时要求响应码以 class 开头。
+func (c *ftpConn) expect(class int) (int, error) {
+	code, _, err := c.text.ReadResponse(class)
+	return code, err
+}
+
+// dataConn 以被动模式打开数据连接。服务器在 PASV 响应中给出的地址被忽略，
+// 总是连接控制连接的主机，避免服务器位于 NAT 之后时返回内网地址。
+func (c *ftpConn) dataConn() (net.Conn, error) {
+	var port int
+	var msg string
+	if c.epsv {
+		if err := c.text.PrintfLine("EPSV"); err != nil {
+			return nil, err
+		}
+		code, m, err := c.text.ReadResponse(0)
+		if err != nil {
+			return nil, err
+		}
+		msg = m
+		// 229 Entering Extended Passive Mode (|||port|)
+		if i := strings.Index(msg, "(|||"); code == 229 && i >= 0 {
+			port, _ = strconv.Atoi(strings.SplitN(msg[i+4:], "|", 2)[0])
+		} else {
+			c.epsv = false
+		}
+	}
+	if !c.epsv {
+		if err := c.text.PrintfLine("PASV"); err != nil {
+			return nil, err
+		}
+		_, m, err := c.text.ReadResponse(227)
+		if err != nil {
+			return nil, fmt.Errorf("ftp PASV failed: %w", err)
+		}
+		msg = m
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		start, end := strings.Index(msg, "("), strings.Index(msg, ")")
+		if start >= 0 && end > start {
+			if f := strings.Split(msg[start+1:end], ","); len(f) == 6 {
+				p1, _ := strconv.Atoi(f[4])
+				p2, _ := strconv.Atoi(f[5])
+				port = p1<<8 | p2
+			}
+		}
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("ftp server returned no usable passive port: %s", msg)
+	}
+	addr := net.JoinHostPort(c.u.Hostname(), strconv.Itoa(port))
+	conn, err := (&net.Dialer{}).DialContext(c.ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ftp data connection to %s: %w", addr, err)
+	}
+	if c.tls != nil {
+		conn = tls.Client(conn, c.tls)
+	}
+	return conn, nil
+}
+
+// upload 以 STOR 写入 p.part 后改名为 p。
+func (c *ftpConn) upload(p string, data []byte) error {
+	tmp := p + ".part"
+	conn, err := c.dataConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := c.cmd(1, "STOR %s", tmp); err != nil {
+		return err
+	}
+	if _, err := io.Copy(conn, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to send data: %w", err)
+	}
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("failed to send data: %w", err)
+	}
+	if _, err := c.expect(2); err != nil {
+		return fmt.Errorf("ftp STOR failed: %w", err)
+	}
+	if _, err := c.cmd(3, "RNFR %s", tmp); err != nil {
+		return err
+	}
+	_, err = c.cmd(2, "RNTO %s", p)
+	return err
+}
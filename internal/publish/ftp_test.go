@@ -0,0 +1,247 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ftpTestServer 是内存中的 FTP 服务器，按脚本应答 uploadFTP 用到的命令。
+type ftpTestServer struct {
+	epsv bool // 是否支持 EPSV，不支持时返回 500
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	dirs     map[string]bool
+	commands []string // 收到的命令，PASS 的参数被隐去
+}
+
+// start 在本地端口上启动服务器，只接受密码 secret，返回其地址。
+func (s *ftpTestServer) start(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// serve 处理一个控制连接，直到 QUIT 或连接关闭。
+func (s *ftpTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(code int, msg string) { text.PrintfLine("%d %s", code, msg) }
+	var data net.Listener // 被动模式下等待数据连接的监听器
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	var renameFrom string
+	reply(220, "test server ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		s.mu.Lock()
+		if verb == "PASS" {
+			s.commands = append(s.commands, "PASS ***")
+		} else {
+			s.commands = append(s.commands, line)
+		}
+		s.mu.Unlock()
+
+		// listen 为下一次传输打开被动模式的数据端口
+		listen := func() int {
+			if data != nil {
+				data.Close()
+			}
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				return 0
+			}
+			return data.Addr().(*net.TCPAddr).Port
+		}
+		switch verb {
+		case "USER":
+			reply(331, "password required")
+		case "PASS":
+			if arg != "secret" {
+				reply(530, "login incorrect")
+				continue
+			}
+			reply(230, "logged in")
+		case "TYPE":
+			reply(200, "type set")
+		case "MKD":
+			s.mu.Lock()
+			exists := s.dirs[arg]
+			s.dirs[arg] = true
+			s.mu.Unlock()
+			if exists {
+				reply(550, "directory exists")
+				continue
+			}
+			reply(257, fmt.Sprintf("%q created", arg))
+		case "EPSV":
+			if !s.epsv {
+				reply(500, "command not understood")
+				continue
+			}
+			reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", listen()))
+		case "PASV":
+			// 返回一个无法连接的地址，客户端应当忽略它而连接控制连接的主机
+			port := listen()
+			reply(227, fmt.Sprintf("Entering Passive Mode (10,255,255,1,%d,%d)", port>>8, port&0xff))
+		case "STOR":
+			if data == nil {
+				reply(425, "use PASV first")
+				continue
+			}
+			reply(150, "ok to send data")
+			dc, err := data.Accept()
+			if err != nil {
+				reply(425, "no data connection")
+				continue
+			}
+			body, err := io.ReadAll(dc)
+			dc.Close()
+			data.Close()
+			data = nil
+			if err != nil {
+				reply(426, "transfer aborted")
+				continue
+			}
+			s.mu.Lock()
+			s.files[arg] = body
+			s.mu.Unlock()
+			reply(226, "transfer complete")
+		case "RNFR":
+			s.mu.Lock()
+			_, ok := s.files[arg]
+			s.mu.Unlock()
+			if !ok {
+				reply(550, "no such file")
+				continue
+			}
+			renameFrom = arg
+			reply(350, "ready for RNTO")
+		case "RNTO":
+			if renameFrom == "" {
+				reply(503, "RNFR required first")
+				continue
+			}
+			s.mu.Lock()
+			s.files[arg] = s.files[renameFrom]
+			delete(s.files, renameFrom)
+			s.mu.Unlock()
+			renameFrom = ""
+			reply(250, "rename successful")
+		case "QUIT":
+			reply(221, "goodbye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+// 上传经 EPSV（不支持时改用 PASV 且不再尝试 EPSV）打开数据连接，STOR 写入 .part 文件后以 RNFR/RNTO 改名。
+func TestUploadFTP(t *testing.T) {
+	files := map[string][]byte{"output.txt": []byte("||ads.example.com^\n"), "categories/ads.txt": []byte("||tracker.example.net^\n")}
+	names := []string{"output.txt", "categories/ads.txt"}
+	tests := []struct {
+		name     string
+		epsv     bool
+		wantEPSV int
+		wantPASV int
+	}{
+		{name: "EPSV", epsv: true, wantEPSV: 2},
+		{name: "PASV fallback", epsv: false, wantEPSV: 1, wantPASV: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ftpTestServer{
+				epsv:  tt.epsv,
+				files: map[string][]byte{"/lists/output.txt": []byte("old list\n")},
+				dirs:  map[string]bool{"/lists": true},
+			}
+			addr := s.start(t)
+			u, err := url.Parse("ftp://publisher@" + addr + "/lists")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := uploadFTP(context.Background(), u, "secret", "/lists", names, files); err != nil {
+				t.Fatalf("uploadFTP() error = %v", err)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, name := range names {
+				if got := s.files["/lists/"+name]; string(got) != string(files[name]) {
+					t.Errorf("%s = %q, want %q", name, got, files[name])
+				}
+				if _, ok := s.files["/lists/"+name+".part"]; ok {
+					t.Errorf("%s.part was left behind", name)
+				}
+			}
+			count := func(verb string) int {
+				n := 0
+				for _, c := range s.commands {
+					if c == verb || strings.HasPrefix(c, verb+" ") {
+						n++
+					}
+				}
+				return n
+			}
+			if count("EPSV") != tt.wantEPSV || count("PASV") != tt.wantPASV {
+				t.Errorf("commands = %q, want %d EPSV and %d PASV", s.commands, tt.wantEPSV, tt.wantPASV)
+			}
+			// 每个文件依次经过 STOR、RNFR 与 RNTO
+			i := slices.Index(s.commands, "STOR /lists/output.txt.part")
+			if i < 0 || i+2 >= len(s.commands) ||
+				s.commands[i+1] != "RNFR /lists/output.txt.part" || s.commands[i+2] != "RNTO /lists/output.txt" {
+				t.Errorf("commands = %q, want STOR, RNFR and RNTO for output.txt", s.commands)
+			}
+			if !s.dirs["/lists/categories"] || s.commands[len(s.commands)-1] != "QUIT" {
+				t.Errorf("commands = %q, want the categories directory created and a final QUIT", s.commands)
+			}
+		})
+	}
+}
+
+// 密码错误时登录失败，不会上传任何文件。
+func TestUploadFTPLoginFailure(t *testing.T) {
+	s := &ftpTestServer{files: map[string][]byte{}, dirs: map[string]bool{}}
+	u, err := url.Parse("ftp://publisher@" + s.start(t) + "/lists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = uploadFTP(context.Background(), u, "wrong", "/lists", []string{"output.txt"}, map[string][]byte{"output.txt": []byte("x")})
+	if err == nil || !strings.Contains(err.Error(), "PASS") {
+		t.Errorf("uploadFTP() error = %v, want a failed PASS", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) != 0 {
+		t.Errorf("files = %v, want nothing uploaded", s.files)
+	}
+}
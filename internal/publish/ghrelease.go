@@ -0,0 +1,208 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// GitHubReleaseConfig 将发布文件作为 GitHub Release 的附件上传。Mode 为 version 时每次构建创建
+// TagPrefix 加版本号的新 Release，为 rolling 时始终更新同一个 RollingTag，附件被新文件替换。
+// token 从环境变量 TokenEnv 读取，Repository 为空时使用 GITHUB_REPOSITORY。
+// 附件名不能包含目录，子目录中的文件以 "_" 代替 "/"，例如 deltas_manifest.json。
+type GitHubReleaseConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Repository string `yaml:"repository"`
+	TokenEnv   string `yaml:"token_env"`
+	APIURL     string `yaml:"api_url"`
+	Mode       string `yaml:"mode"`
+	TagPrefix  string `yaml:"tag_prefix"`
+	RollingTag string `yaml:"rolling_tag"`
+	Target     string `yaml:"target"` // 新建标签指向的分支或提交，为空时使用仓库的默认分支
+	Body       string `yaml:"body"`
+}
+
+// Release 的发布方式。
+const (
+	releaseVersion = "version"
+	releaseRolling = "rolling"
+)
+
+// releaseBody 是 Release 说明的默认模板，可用的字段与通知模板相同。
+const releaseBody = `**Rules:** {{.Rules}}{{if .HasDiff}} (+{{.Added}} / -{{.Removed}} since the previous build){{end}}
+**Sources:** {{.Succeeded}}/{{.Sources}} downloaded{{if .Stale}}, {{.Stale}} served from cache{{end}}{{if .Quarantined}}, {{.Quarantined}} quarantined{{end}}
+**Generated:** {{.Started.UTC.Format "2006-01-02 15:04 UTC"}}
+{{- if .Failed}}
+
+**Failed sources:**
+{{range .Failed}}
+- {{.Name}}: {{.Error}}
+{{- end}}
+{{- end}}
+`
+
+// githubRelease 是 GitHub API 返回的 Release 中用到的字段。
+type githubRelease struct {
+	ID        int64  `json:"id"`
+	HTMLURL   string `json:"html_url"`
+	UploadURL string `json:"upload_url"`
+	Assets    []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+// errGitHubNotFound 表示 GitHub API 返回了 404。
+var errGitHubNotFound = errors.New("not found")
+
+// githubClient 是调用 GitHub REST API 的客户端。
+type githubClient struct {
+	api   string
+	token string
+}
+
+// do 发送请求，2xx 响应的 JSON 解码到 out（可以为 nil）。
+func (c *githubClient) do(ctx context.Context, method, endpoint string, body io.Reader, contentType string, out any) error {
+	if !strings.HasPrefix(endpoint, "http") {
+		endpoint = c.api + endpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errGitHubNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// publish 创建或更新本次构建的 Release 并上传 uploadFiles 中的全部文件。
+func (gc GitHubReleaseConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	repo := gc.Repository
+	if repo == "" {
+		repo = os.Getenv("GITHUB_REPOSITORY")
+	}
+	if repo == "" {
+		return fmt.Errorf("repository is not set and GITHUB_REPOSITORY is empty")
+	}
+	token := os.Getenv(gc.TokenEnv)
+	if token == "" {
+		return fmt.Errorf("$%s is not set", gc.TokenEnv)
+	}
+	c := &githubClient{api: strings.TrimSuffix(gc.APIURL, "/"), token: token}
+
+	version := res.BuildTime.Format("200601021504")
+	tag := gc.TagPrefix + version
+	if gc.Mode == releaseRolling {
+		tag = gc.RollingTag
+	}
+	body, err := res.RenderText("release body", gc.Body, releaseBody)
+	if err != nil {
+		return err
+	}
+	info := map[string]any{
+		"tag_name": tag,
+		"name":     fmt.Sprintf("%s %s", cfg.Header.Title, version),
+		"body":     body,
+	}
+	if gc.Target != "" {
+		info["target_commitish"] = gc.Target
+	}
+	payload, _ := json.Marshal(info)
+
+	var release githubRelease
+	base := "/repos/" + repo + "/releases"
+	err = c.do(ctx, http.MethodGet, base+"/tags/"+url.PathEscape(tag), nil, "", &release)
+	switch {
+	case errors.Is(err, errGitHubNotFound):
+		if err := c.do(ctx, http.MethodPost, base, bytes.NewReader(payload), "application/json", &release); err != nil {
+			return fmt.Errorf("failed to create release %s: %w", tag, err)
+		}
+		logging.Publisher.Info("🏷️ Created GitHub release", "tag", tag, "url", release.HTMLURL)
+	case err != nil:
+		return fmt.Errorf("failed to look up release %s: %w", tag, err)
+	default:
+		if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("%s/%d", base, release.ID), bytes.NewReader(payload), "application/json", nil); err != nil {
+			return fmt.Errorf("failed to update release %s: %w", tag, err)
+		}
+		logging.Publisher.Info("🏷️ Updated GitHub release", "tag", tag, "url", release.HTMLURL)
+	}
+
+	existing := make(map[string]int64, len(release.Assets))
+	for _, a := range release.Assets {
+		existing[a.Name] = a.ID
+	}
+	uploadURL, _, _ := strings.Cut(release.UploadURL, "{")
+	files := uploadFiles(cfg, res)
+	for _, name := range files {
+		asset := strings.ReplaceAll(name, "/", "_")
+		if id, ok := existing[asset]; ok {
+			if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/assets/%d", base, id), nil, "", nil); err != nil {
+				return fmt.Errorf("failed to delete old asset %s: %w", asset, err)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		endpoint := uploadURL + "?name=" + url.QueryEscape(asset)
+		if err := c.do(ctx, http.MethodPost, endpoint, bytes.NewReader(data), "application/octet-stream", nil); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", asset, err)
+		}
+		logging.Publisher.Debug("⬆️ Uploaded release asset", "asset", asset, "bytes", len(data))
+	}
+	logging.Publisher.Info("⬆️ Uploaded release assets", "tag", tag, "files", len(files))
+	return nil
+}
+
+// check 校验 github_release 配置。
+func (gc GitHubReleaseConfig) check() error {
+	if !gc.Enabled {
+		return nil
+	}
+	switch gc.Mode {
+	case releaseVersion:
+	case releaseRolling:
+		if gc.RollingTag == "" {
+			return fmt.Errorf("publishers.github_release.rolling_tag must not be empty in rolling mode")
+		}
+	default:
+		return fmt.Errorf("publishers.github_release.mode must be %q or %q, got %q", releaseVersion, releaseRolling, gc.Mode)
+	}
+	if gc.TokenEnv == "" || gc.APIURL == "" {
+		return fmt.Errorf("publishers.github_release requires token_env and api_url")
+	}
+	if gc.Repository != "" && strings.Count(gc.Repository, "/") != 1 {
+		return fmt.Errorf("publishers.github_release.repository must be owner/name, got %q", gc.Repository)
+	}
+	return nil
+}
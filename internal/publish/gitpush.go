@@ -0,0 +1,161 @@
+package publish
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// GitPushConfig 将发布文件提交到 git 仓库的一个分支（例如供 jsDelivr 读取的 release 分支）并推送。
+// 分支的内容被替换为本次发布的文件，与分支上已有的内容相同时不提交。
+// URL 为空时使用当前 GitHub 仓库，不在 GitHub Actions 中运行时跳过；
+// token 从环境变量 TokenEnv 读取并以 HTTP 头传给 git，不会出现在远程地址或日志中。
+// Squash 为 true 时每次提交都没有父提交并强制推送，分支始终只有一个提交，历史不会无限增长。
+type GitPushConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	URL         string `yaml:"url"`
+	Branch      string `yaml:"branch"`
+	TokenEnv    string `yaml:"token_env"`
+	Squash      bool   `yaml:"squash"`
+	AuthorName  string `yaml:"author_name"`
+	AuthorEmail string `yaml:"author_email"`
+	Message     string `yaml:"message"`
+}
+
+// gitCommitMessage 是提交说明的默认模板，可用的字段与通知模板相同。
+const gitCommitMessage = `🚀 Released on {{.Started.Format "2006-01-02 15:04:05"}}
+
+📊 Statistics:
+- Sources: {{.Succeeded}}/{{.Sources}}{{if .Stale}} ({{.Stale}} from cache){{end}}
+- Rules: {{.Rules}}{{if .HasDiff}} (+{{.Added}} / -{{.Removed}}){{end}}
+- Generated: {{.Started.Format "2006-01-02T15:04:05Z07:00"}}
+`
+
+// publish 在临时目录中检出目标分支，写入 uploadFiles 中的全部文件后提交并推送。
+func (gc GitPushConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	remote := os.ExpandEnv(gc.URL)
+	if remote == "" {
+		repo := os.Getenv("GITHUB_REPOSITORY")
+		if repo == "" {
+			// 在本地构建时没有可推送的仓库
+			logging.Publisher.Warn("⚠️ Skipping git push: url is not set and GITHUB_REPOSITORY is empty")
+			return nil
+		}
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		remote = server + "/" + repo + ".git"
+	}
+	message, err := res.RenderText("commit message", gc.Message, gitCommitMessage)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "adguardlist-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	git := func(args ...string) (string, error) {
+		out, err := download.RunGit(ctx, dir, args...)
+		return strings.TrimSpace(string(out)), err
+	}
+	setup := [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/" + gc.Branch},
+		{"config", "user.name", gc.AuthorName},
+		{"config", "user.email", gc.AuthorEmail},
+		{"remote", "add", "origin", remote},
+	}
+	if token := os.Getenv(gc.TokenEnv); token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		setup = append(setup, []string{"config", "http.extraHeader", "Authorization: Basic " + auth})
+	}
+	for _, args := range setup {
+		if _, err := git(args...); err != nil {
+			return err
+		}
+	}
+
+	heads, err := git("ls-remote", "--heads", "origin", "refs/heads/"+gc.Branch)
+	if err != nil {
+		return err
+	}
+	exists := heads != ""
+	if exists {
+		// 只取最新的提交，索引设为其内容，工作区中的文件随后整体替换
+		if _, err := git("fetch", "-q", "--depth", "1", "origin", "refs/heads/"+gc.Branch); err != nil {
+			return err
+		}
+		if _, err := git("reset", "-q", "FETCH_HEAD"); err != nil {
+			return err
+		}
+	}
+	files := uploadFiles(cfg, res)
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+	}
+	if _, err := git("add", "-A"); err != nil {
+		return err
+	}
+	if exists {
+		status, err := git("status", "--porcelain")
+		if err != nil {
+			return err
+		}
+		if status == "" {
+			logging.Publisher.Info("ℹ️ Git branch is already up to date, skipping commit", "branch", gc.Branch)
+			return nil
+		}
+		if gc.Squash {
+			if _, err := git("update-ref", "-d", "HEAD"); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := git("commit", "-q", "-m", strings.TrimSpace(message)); err != nil {
+		return err
+	}
+	push := []string{"push", "-q", "origin", "HEAD:refs/heads/" + gc.Branch}
+	if gc.Squash {
+		push = append(push, "--force")
+	}
+	if _, err := git(push...); err != nil {
+		return err
+	}
+	commit, _ := git("rev-parse", "--short", "HEAD")
+	logging.Publisher.Info("🌿 Pushed git branch", "branch", gc.Branch, "commit", commit, "files", len(files))
+	return nil
+}
+
+// check 校验 git 配置。
+func (gc GitPushConfig) check() error {
+	if !gc.Enabled {
+		return nil
+	}
+	if gc.Branch == "" || strings.HasPrefix(gc.Branch, "-") || strings.ContainsAny(gc.Branch, " ~^:?*[\\") {
+		return fmt.Errorf("publishers.git.branch must be a valid branch name, got %q", gc.Branch)
+	}
+	if gc.AuthorName == "" || gc.AuthorEmail == "" {
+		return fmt.Errorf("publishers.git requires author_name and author_email")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package publish
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/maputil"
+	"adguardlist/internal/output"
+)
+
+// IPFSConfig 将发布文件作为一个目录添加到 IPFS，用于抗审查的分发。APIURL 是 kubo 节点的 RPC 地址，
+// 可以是本机节点，也可以是兼容 kubo RPC 的托管服务（Authorization 头从 APIAuthEnv 读取）。
+// 设置 PinningURL 时，再通过 IPFS Pinning Service API 请求远程固定，token 从 PinningTokenEnv 读取。
+// 列表文件无法包含自身所在目录的 CID，因此 CID 记录在构建报告、GitHub Actions 输出与作业摘要中；
+// 设置 IPNSKey（kubo 的密钥名或 k51… 形式的 ID）时 CID 同时发布到该 IPNS 名称，列表头部写入固定的 IPNS 地址。
+type IPFSConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	APIURL          string `yaml:"api_url"`
+	APIAuthEnv      string `yaml:"api_auth_env"`
+	PinningURL      string `yaml:"pinning_url"`
+	PinningTokenEnv string `yaml:"pinning_token_env"`
+	IPNSKey         string `yaml:"ipns_key"`
+	Gateway         string `yaml:"gateway"` // 日志中链接使用的网关
+}
+
+// ipfsAddEntry 是 /api/v0/add 响应中的一行。
+type ipfsAddEntry struct {
+	Name string `json:"Name"`
+	Hash string `json:"Hash"`
+}
+
+// publish 添加发布目录并记录 CID，按配置请求远程固定与发布 IPNS。
+func (ic IPFSConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	cid, err := ic.add(ctx, cfg, res)
+	if err != nil {
+		return err
+	}
+	res.IPFSCID = cid
+	logging.Publisher.Info("🌐 Added to IPFS", "cid", cid, "url", ic.gatewayURL(cid))
+	if ic.PinningURL != "" {
+		if err := ic.pin(ctx, cfg, cid); err != nil {
+			return err
+		}
+		logging.Publisher.Info("📌 Requested remote pin", "cid", cid)
+	}
+	if ic.IPNSKey != "" {
+		var out struct{ Name string }
+		query := url.Values{"arg": {"/ipfs/" + cid}, "key": {ic.IPNSKey}}
+		if err := ic.rpc(ctx, "name/publish", query, nil, "", &out); err != nil {
+			return fmt.Errorf("failed to publish ipns name: %w", err)
+		}
+		logging.Publisher.Info("🌐 Published IPNS name", "name", "/ipns/"+out.Name)
+	}
+	return nil
+}
+
+// add 以 multipart 形式上传 uploadFiles 中的全部文件并返回包装目录的 CID。
+func (ic IPFSConfig) add(ctx context.Context, cfg *output.Config, res *output.Result) (string, error) {
+	files := uploadFiles(cfg, res)
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	// 子目录需要单独的目录条目，且必须出现在其中的文件之前
+	dirs := make(map[string]bool)
+	for _, name := range files {
+		for d := path.Dir(name); d != "."; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	sortedDirs := maputil.SortedKeys(dirs)
+	sort.SliceStable(sortedDirs, func(i, j int) bool { return strings.Count(sortedDirs[i], "/") < strings.Count(sortedDirs[j], "/") })
+	for _, d := range sortedDirs {
+		if _, err := w.CreatePart(ipfsPartHeader(d, "application/x-directory")); err != nil {
+			return "", err
+		}
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return "", fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		part, err := w.CreatePart(ipfsPartHeader(name, "application/octet-stream"))
+		if err != nil {
+			return "", err
+		}
+		part.Write(data)
+	}
+	w.Close()
+
+	query := url.Values{"pin": {"true"}, "cid-version": {"1"}, "wrap-with-directory": {"true"}}
+	var cid string
+	err := ic.rpcStream(ctx, "add", query, &body, w.FormDataContentType(), func(line []byte) error {
+		var e ipfsAddEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("unexpected ipfs add response: %s", line)
+		}
+		// 包装目录是最后一行，名称为空
+		if e.Name == "" {
+			cid = e.Hash
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add files to ipfs: %w", err)
+	}
+	if cid == "" {
+		return "", fmt.Errorf("ipfs add returned no directory cid")
+	}
+	return cid, nil
+}
+
+// ipfsPartHeader 返回 kubo 用来识别文件路径的 multipart 头。
+func ipfsPartHeader(name, contentType string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, url.PathEscape(name)))
+	h.Set("Content-Type", contentType)
+	return h
+}
+
+// rpc 调用 kubo RPC 接口，JSON 响应解码到 out。
+func (ic IPFSConfig) rpc(ctx context.Context, command string, query url.Values, body io.Reader, contentType string, out any) error {
+	return ic.rpcStream(ctx, command, query, body, contentType, func(line []byte) error {
+		return json.Unmarshal(line, out)
+	})
+}
+
+// rpcStream 调用 kubo RPC 接口，对响应中的每一行 JSON 调用 fn。
+func (ic IPFSConfig) rpcStream(ctx context.Context, command string, query url.Values, body io.Reader, contentType string, fn func([]byte) error) error {
+	endpoint := strings.TrimSuffix(ic.APIURL, "/") + "/api/v0/" + command + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if ic.APIAuthEnv != "" {
+		if auth := os.Getenv(ic.APIAuthEnv); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var e struct{ Message string }
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(raw, &e) == nil && e.Message != "" {
+			return fmt.Errorf("%s returned %s: %s", command, resp.Status, e.Message)
+		}
+		return fmt.Errorf("%s returned %s: %s", command, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// pin 通过 Pinning Service API 请求固定 cid。
+func (ic IPFSConfig) pin(ctx context.Context, cfg *output.Config, cid string) error {
+	token := os.Getenv(ic.PinningTokenEnv)
+	if token == "" {
+		return fmt.Errorf("$%s is not set", ic.PinningTokenEnv)
+	}
+	body, _ := json.Marshal(map[string]any{"cid": cid, "name": cfg.Header.Title})
+	header := http.Header{"Content-Type": {"application/json"}, "Authorization": {"Bearer " + token}}
+	err := PostBody(ctx, strings.TrimSuffix(ic.PinningURL, "/")+"/pins", body, header, "pinning service")
+	if err != nil {
+		return fmt.Errorf("failed to request remote pin: %w", err)
+	}
+	return nil
+}
+
+// gatewayURL 返回 cid 在网关上的地址。
+func (ic IPFSConfig) gatewayURL(cid string) string {
+	if ic.Gateway == "" {
+		return "ipfs://" + cid
+	}
+	return strings.TrimSuffix(ic.Gateway, "/") + "/ipfs/" + cid + "/"
+}
+
+// check 校验 ipfs 配置。
+func (ic IPFSConfig) check() error {
+	if !ic.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(ic.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("publishers.ipfs.api_url must be an http(s) URL, got %q", ic.APIURL)
+	}
+	if ic.PinningURL != "" && ic.PinningTokenEnv == "" {
+		return fmt.Errorf("publishers.ipfs.pinning_token_env must not be empty when pinning_url is set")
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"adguardlist/internal/download"
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/maputil"
+	"adguardlist/internal/output"
+)
+
+// NextDNSConfig 将合并列表中被整体屏蔽的域名同步到 NextDNS 配置（profile）的 denylist。
+// Mode 为 diff（默认）时只提交与上次同步相比的变化：添加 denylist 中还没有的域名，删除由本工具添加、
+// 已不在列表中的域名（记录在 StateFile 中），手动添加的条目不受影响；每次构建最多提交 BatchSize 个变更，
+// 其余在之后的构建中继续。Mode 为 replace 时以一个请求用列表替换整个 denylist。
+// 请求以 RequestsPerSecond 限速，遇到 429 时按 Retry-After 等待后重试。API key 从环境变量 APIKeyEnv 读取。
+type NextDNSConfig struct {
+	Enabled           bool    `yaml:"enabled"`
+	Profile           string  `yaml:"profile"`
+	APIKeyEnv         string  `yaml:"api_key_env"`
+	APIURL            string  `yaml:"api_url"`
+	Mode              string  `yaml:"mode"`
+	BatchSize         int     `yaml:"batch_size"`
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	StateFile         string  `yaml:"state_file"`
+}
+
+// NextDNS 的同步方式。
+const (
+	nextdnsDiff    = "diff"
+	nextdnsReplace = "replace"
+)
+
+// nextdnsMaxAttempts 是单个请求遇到 429 时的最多尝试次数。
+const nextdnsMaxAttempts = 5
+
+// nextdnsState 是保存在 state_file 中的同步记录：由本工具添加到 Profile 的域名。
+type nextdnsState struct {
+	Profile string   `json:"profile"`
+	Domains []string `json:"domains"`
+}
+
+// nextdnsEntry 是 denylist 中的一项。
+type nextdnsEntry struct {
+	ID     string `json:"id"`
+	Active bool   `json:"active"`
+}
+
+// nextdnsClient 调用 NextDNS API 并限制请求速度。
+type nextdnsClient struct {
+	base    string
+	key     string
+	limiter *download.TokenBucket
+}
+
+// publish 将域名同步到 denylist。
+func (nc NextDNSConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	key := os.Getenv(nc.APIKeyEnv)
+	if key == "" {
+		return fmt.Errorf("$%s is not set", nc.APIKeyEnv)
+	}
+	profile := os.ExpandEnv(nc.Profile)
+	c := &nextdnsClient{
+		base:    strings.TrimSuffix(nc.APIURL, "/") + "/profiles/" + url.PathEscape(profile) + "/denylist",
+		key:     key,
+		limiter: download.NewTokenBucket(nc.RequestsPerSecond, 1),
+	}
+	domains := output.BlockedDomainList(res.Content)
+
+	if nc.Mode == nextdnsReplace {
+		entries := make([]nextdnsEntry, len(domains))
+		for i, d := range domains {
+			entries[i] = nextdnsEntry{ID: d, Active: true}
+		}
+		if err := c.do(ctx, http.MethodPut, "", entries, nil); err != nil {
+			return fmt.Errorf("failed to replace denylist: %w", err)
+		}
+		sort.Strings(domains)
+		if err := saveNextDNSState(nc.StateFile, &nextdnsState{Profile: profile, Domains: domains}); err != nil {
+			return err
+		}
+		logging.Publisher.Info("🛡️ Replaced NextDNS denylist", "profile", profile, "domains", len(domains))
+		return nil
+	}
+
+	state, err := loadNextDNSState(nc.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read nextdns state '%s': %w", nc.StateFile, err)
+	}
+	if state.Profile != profile {
+		// 换了配置后，旧的记录不再代表这个 denylist 中由本工具添加的域名
+		state = &nextdnsState{Profile: profile}
+	}
+	remote, err := c.list(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read denylist: %w", err)
+	}
+	want := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		want[d] = true
+	}
+	owned := make(map[string]bool, len(state.Domains))
+	for _, d := range state.Domains {
+		// 已被手动删除的域名不再属于本工具，需要时重新添加
+		if remote[d] {
+			owned[d] = true
+		}
+	}
+	var add, remove []string
+	for d := range owned {
+		if !want[d] {
+			remove = append(remove, d)
+		}
+	}
+	for _, d := range domains {
+		if !remote[d] {
+			add = append(add, d)
+		}
+	}
+	sort.Strings(remove)
+	pending := len(add) + len(remove)
+
+	// 先删除再添加，超出 batch_size 的变更留给之后的构建
+	applied := 0
+	var syncErr error
+	for _, d := range remove {
+		if nc.BatchSize > 0 && applied >= nc.BatchSize {
+			break
+		}
+		if syncErr = c.do(ctx, http.MethodDelete, "/"+url.PathEscape(d), nil, nil); syncErr != nil {
+			syncErr = fmt.Errorf("failed to remove %s: %w", d, syncErr)
+			break
+		}
+		delete(owned, d)
+		applied++
+	}
+	for _, d := range add {
+		if syncErr != nil || (nc.BatchSize > 0 && applied >= nc.BatchSize) {
+			break
+		}
+		if syncErr = c.do(ctx, http.MethodPost, "", nextdnsEntry{ID: d, Active: true}, nil); syncErr != nil {
+			syncErr = fmt.Errorf("failed to add %s: %w", d, syncErr)
+			break
+		}
+		owned[d] = true
+		applied++
+	}
+	// 失败时也保存已完成的变更，下次构建不会重复提交
+	state.Domains = maputil.SortedKeys(owned)
+	if err := saveNextDNSState(nc.StateFile, state); err != nil {
+		return errors.Join(syncErr, err)
+	}
+	if syncErr != nil {
+		return syncErr
+	}
+	logging.Publisher.Info("🛡️ Synced NextDNS denylist", "profile", profile,
+		"added", len(add), "removed", len(remove), "applied", applied, "remaining", pending-applied)
+	return nil
+}
+
+// list 返回 denylist 中的全部域名，按分页游标读取。
+func (c *nextdnsClient) list(ctx context.Context) (map[string]bool, error) {
+	domains := make(map[string]bool)
+	cursor := ""
+	for {
+		var page struct {
+			Data []nextdnsEntry `json:"data"`
+			Meta struct {
+				Pagination struct {
+					Cursor string `json:"cursor"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		query := ""
+		if cursor != "" {
+			query = "?cursor=" + url.QueryEscape(cursor)
+		}
+		if err := c.do(ctx, http.MethodGet, query, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, e := range page.Data {
+			domains[strings.ToLower(e.ID)] = true
+		}
+		cursor = page.Meta.Pagination.Cursor
+		if cursor == "" {
+			return domains, nil
+		}
+	}
+}
+
+// do 向 denylist 地址加上 suffix 发送请求，payload 以 JSON 编码（可以为 nil），2xx 响应解码到 out（可以为 nil）。
+// 429 时按 Retry-After 暂停限速器后重试。
+func (c *nextdnsClient) do(ctx context.Context, method, suffix string, payload, out any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.base+suffix, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Api-Key", c.key)
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		raw, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < nextdnsMaxAttempts {
+			delay := download.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			if delay <= 0 {
+				delay = time.Duration(attempt) * time.Second
+			}
+			logging.Publisher.Debug("⏳ NextDNS rate limited, retrying", "delay", delay, "attempt", attempt)
+			c.limiter.Pause(time.Now().Add(delay))
+			continue
+		}
+		// NextDNS 在 2xx 响应中也可能以 errors 报告校验错误
+		var result struct {
+			Errors []struct {
+				Code   string `json:"code"`
+				Detail string `json:"detail"`
+			} `json:"errors"`
+		}
+		json.Unmarshal(raw, &result)
+		if resp.StatusCode/100 != 2 || len(result.Errors) > 0 {
+			var msgs []string
+			for _, e := range result.Errors {
+				msgs = append(msgs, strings.TrimSpace(e.Code+" "+e.Detail))
+			}
+			if len(msgs) == 0 {
+				msgs = append(msgs, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+			}
+			return fmt.Errorf("%s returned %s: %s", method, resp.Status, strings.Join(msgs, "; "))
+		}
+		if out == nil || len(raw) == 0 {
+			return nil
+		}
+		return json.Unmarshal(raw, out)
+	}
+}
+
+// loadNextDNSState 读取同步记录，文件不存在时返回空记录。
+func loadNextDNSState(path string) (*nextdnsState, error) {
+	state := &nextdnsState{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveNextDNSState 将同步记录写入 path。
+func saveNextDNSState(path string, state *nextdnsState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write nextdns state '%s': %w", path, err)
+	}
+	return nil
+}
+
+// check 校验 nextdns 配置。
+func (nc NextDNSConfig) check() error {
+	if !nc.Enabled {
+		return nil
+	}
+	if nc.Profile == "" {
+		return fmt.Errorf("publishers.nextdns.profile must not be empty")
+	}
+	if nc.APIKeyEnv == "" || nc.APIURL == "" || nc.StateFile == "" {
+		return fmt.Errorf("publishers.nextdns requires api_key_env, api_url and state_file")
+	}
+	if nc.Mode != nextdnsDiff && nc.Mode != nextdnsReplace {
+		return fmt.Errorf("publishers.nextdns.mode must be %q or %q, got %q", nextdnsDiff, nextdnsReplace, nc.Mode)
+	}
+	if nc.BatchSize < 0 {
+		return fmt.Errorf("publishers.nextdns.batch_size must not be negative")
+	}
+	if nc.RequestsPerSecond <= 0 {
+		return fmt.Errorf("publishers.nextdns.requests_per_second must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package publish
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// PiholeConfig 是构建成功后更新 gravity 的 Pi-hole 实例（v6 的 REST API）：确保 AdlistURL 已添加为
+// 屏蔽列表（不存在时以 Comment 为备注添加），然后运行 gravity，让 Pi-hole 立即下载新的列表。
+// AdlistURL 为空时使用 pihole 格式输出（没有时为合并列表）的发布地址。URL 可写 ${VAR}，
+// 密码（可以是 app password）从环境变量 PasswordEnv 读取，为空时不登录。
+// 实例通常在内网中，只有在能访问它的机器上运行构建时才适用。
+type PiholeConfig struct {
+	URL         string `yaml:"url"`
+	PasswordEnv string `yaml:"password_env"`
+	AdlistURL   string `yaml:"adlist_url"`
+	Comment     string `yaml:"comment"`
+}
+
+// piholeClient 调用 Pi-hole 的 REST API，sid 为空表示未登录。
+type piholeClient struct {
+	base string
+	sid  string
+}
+
+// request 发送请求并返回 2xx 的响应，其余状态码返回响应中的错误。payload 以 JSON 编码（可以为 nil）。
+func (c *piholeClient) request(ctx context.Context, method, endpoint string, payload any) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.sid != "" {
+		req.Header.Set("X-FTL-SID", c.sid)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Error struct {
+			Key     string `json:"key"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(raw, &result) == nil && result.Error.Message != "" {
+		return nil, fmt.Errorf("%s %s returned %s: %s", method, endpoint, resp.Status, result.Error.Message)
+	}
+	return nil, fmt.Errorf("%s %s returned %s: %s", method, endpoint, resp.Status, strings.TrimSpace(string(raw)))
+}
+
+// do 发送请求并将 JSON 响应解码到 out（可以为 nil）。
+func (c *piholeClient) do(ctx context.Context, method, endpoint string, payload, out any) error {
+	resp, err := c.request(ctx, method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// publish 添加屏蔽列表并运行 gravity。
+func (pc PiholeConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	c := &piholeClient{base: strings.TrimSuffix(os.ExpandEnv(pc.URL), "/")}
+	if password := os.Getenv(pc.PasswordEnv); password != "" {
+		var auth struct {
+			Session struct {
+				Valid   bool   `json:"valid"`
+				SID     string `json:"sid"`
+				Message string `json:"message"`
+			} `json:"session"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/api/auth", map[string]string{"password": password}, &auth); err != nil {
+			return fmt.Errorf("failed to log in: %w", err)
+		}
+		if !auth.Session.Valid {
+			return fmt.Errorf("failed to log in: %s", auth.Session.Message)
+		}
+		c.sid = auth.Session.SID
+		// Pi-hole 的会话数有限，用完立即退出；构建已被取消时也要退出
+		defer c.do(context.WithoutCancel(ctx), http.MethodDelete, "/api/auth", nil, nil)
+	}
+
+	adlist := os.ExpandEnv(pc.AdlistURL)
+	if adlist == "" {
+		adlist = pc.defaultAdlist(cfg)
+	}
+	if adlist != "" {
+		var lists struct {
+			Lists []struct {
+				Address string `json:"address"`
+			} `json:"lists"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/lists?type=block", nil, &lists); err != nil {
+			return fmt.Errorf("failed to read adlists: %w", err)
+		}
+		found := false
+		for _, l := range lists.Lists {
+			found = found || l.Address == adlist
+		}
+		if !found {
+			comment := pc.Comment
+			if comment == "" {
+				comment = cfg.Header.Title
+			}
+			add := map[string]any{"address": adlist, "comment": comment, "groups": []int{0}, "enabled": true}
+			if err := c.do(ctx, http.MethodPost, "/api/lists?type=block", add, nil); err != nil {
+				return fmt.Errorf("failed to add adlist %s: %w", adlist, err)
+			}
+			logging.Publisher.Info("🥧 Added adlist to Pi-hole", "server", c.base, "url", adlist)
+		}
+	}
+
+	// gravity 的输出以流的形式返回，读完即表示运行结束
+	resp, err := c.request(ctx, http.MethodPost, "/api/action/gravity", nil)
+	if err != nil {
+		return fmt.Errorf("failed to run gravity: %w", err)
+	}
+	defer resp.Body.Close()
+	var last string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		last = line
+		logging.Publisher.Debug("🥧 gravity", "output", line)
+		// gravity 以 [✗] 标记失败的步骤，例如无法下载某个列表
+		if strings.Contains(line, "[✗]") {
+			logging.Publisher.Warn("⚠️ Pi-hole gravity reported an error", "server", c.base, "output", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read gravity output: %w", err)
+	}
+	logging.Publisher.Info("🥧 Updated Pi-hole gravity", "server", c.base, "result", last)
+	return nil
+}
+
+// defaultAdlist 返回 pihole 格式输出（没有时为合并列表）的发布地址，不知道发布地址时返回空字符串。
+func (pc PiholeConfig) defaultAdlist(cfg *output.Config) string {
+	base := output.PublishBaseURL(cfg)
+	if base == "" {
+		return ""
+	}
+	for _, o := range cfg.Outputs {
+		if o.Format == "pihole" {
+			return base + o.File
+		}
+	}
+	return base + cfg.OutputFile
+}
+
+// checkPihole 校验 publishers.pihole 并填充默认值：password_env 默认为 PIHOLE_PASSWORD。
+func checkPihole(instances []PiholeConfig) error {
+	for i := range instances {
+		pc := &instances[i]
+		if pc.PasswordEnv == "" {
+			pc.PasswordEnv = "PIHOLE_PASSWORD"
+		}
+		if pc.URL == "" {
+			return fmt.Errorf("publishers.pihole[%d].url must not be empty", i)
+		}
+		if os.Expand(pc.URL, func(string) string { return "" }) == pc.URL {
+			if u, err := url.Parse(pc.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("publishers.pihole[%d].url must be an http(s) url", i)
+			}
+		}
+	}
+	return nil
+}
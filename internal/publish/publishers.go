@@ -0,0 +1,269 @@
+// Package publish 在构建成功后将发布目录中的文件推送到外部目标，例如 GitHub Release、对象存储与 DNS 服务器。
+package publish
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/maputil"
+	"adguardlist/internal/output"
+)
+
+// Config 是构建成功后把发布目录中的文件推送到的外部目标，每个目标单独启用。
+// 任一目标失败时构建以失败结束，本地的输出与发布目录已经写完，不会回滚。
+// Aliases 为发布文件建立副本（新文件名到原文件名），例如保留旧的订阅地址；副本由 WriteAliases
+// 在生成压缩副本之后、校验和之前写入发布目录，同样列入校验和与签名。
+type Config struct {
+	Aliases map[string]string `yaml:"aliases"`
+
+	GitHubRelease GitHubReleaseConfig `yaml:"github_release"`
+	S3            S3Config            `yaml:"s3"`
+	Remote        RemoteConfig        `yaml:"remote"`
+	Git           GitPushConfig       `yaml:"git"`
+	Cloudflare    CloudflareConfig    `yaml:"cloudflare"`
+	IPFS          IPFSConfig          `yaml:"ipfs"`
+	NextDNS       NextDNSConfig       `yaml:"nextdns"`
+	AdGuardHome   []AdGuardHomeConfig `yaml:"adguard_home"`
+	Technitium    []TechnitiumConfig  `yaml:"technitium"`
+	Pihole        []PiholeConfig      `yaml:"pihole"`
+}
+
+// DefaultConfig 返回发布目标的默认配置，所有目标默认都不启用。
+func DefaultConfig() Config {
+	return Config{
+		GitHubRelease: GitHubReleaseConfig{
+			TokenEnv:   "GITHUB_TOKEN",
+			APIURL:     "https://api.github.com",
+			Mode:       releaseVersion,
+			TagPrefix:  "v",
+			RollingTag: "latest",
+		},
+		S3: S3Config{
+			Region:          "us-east-1",
+			AccessKeyEnv:    "AWS_ACCESS_KEY_ID",
+			SecretKeyEnv:    "AWS_SECRET_ACCESS_KEY",
+			SessionTokenEnv: "AWS_SESSION_TOKEN",
+			CacheControl:    "public, max-age=300",
+		},
+		Remote: RemoteConfig{PasswordEnv: "REMOTE_PASSWORD", PrivateKeyEnv: "REMOTE_PRIVATE_KEY"},
+		Git: GitPushConfig{
+			Branch:      "release",
+			TokenEnv:    "GITHUB_TOKEN",
+			Squash:      true,
+			AuthorName:  "github-actions[bot]",
+			AuthorEmail: "121651775+github-actions[bot]@users.noreply.github.com",
+		},
+		Cloudflare: CloudflareConfig{TokenEnv: "CLOUDFLARE_API_TOKEN", APIURL: "https://api.cloudflare.com/client/v4"},
+		IPFS: IPFSConfig{
+			APIURL:          "http://127.0.0.1:5001",
+			PinningTokenEnv: "IPFS_PINNING_TOKEN",
+			Gateway:         "https://ipfs.io",
+		},
+		NextDNS: NextDNSConfig{
+			APIKeyEnv:         "NEXTDNS_API_KEY",
+			APIURL:            "https://api.nextdns.io",
+			Mode:              nextdnsDiff,
+			BatchSize:         500,
+			RequestsPerSecond: 2,
+			StateFile:         ".cache/nextdns.json",
+		},
+	}
+}
+
+// publisher 是一个发布目标。
+type publisher struct {
+	name    string
+	enabled bool
+	run     func(ctx context.Context, cfg *output.Config, res *output.Result) error
+}
+
+// publishers 返回 pc 中的全部发布目标。
+func publishers(pc *Config) []publisher {
+	list := []publisher{
+		{"github_release", pc.GitHubRelease.Enabled, pc.GitHubRelease.publish},
+		{"s3", pc.S3.Enabled, pc.S3.publish},
+		{"remote", pc.Remote.Enabled, pc.Remote.publish},
+		{"git", pc.Git.Enabled, pc.Git.publish},
+		{"cloudflare", pc.Cloudflare.Enabled, pc.Cloudflare.publish},
+		{"ipfs", pc.IPFS.Enabled, pc.IPFS.publish},
+		{"nextdns", pc.NextDNS.Enabled, pc.NextDNS.publish},
+	}
+	// 自托管的 DNS 服务器在其他目标之后更新，AdGuard Home 的 refresh 模式与 Pi-hole 的 gravity 读取的可能正是刚推送的文件
+	for i, ac := range pc.AdGuardHome {
+		list = append(list, publisher{fmt.Sprintf("adguard_home[%d]", i), true, ac.publish})
+	}
+	for i, tc := range pc.Technitium {
+		list = append(list, publisher{fmt.Sprintf("technitium[%d]", i), true, tc.publish})
+	}
+	for i, ph := range pc.Pihole {
+		list = append(list, publisher{fmt.Sprintf("pihole[%d]", i), true, ph.publish})
+	}
+	return list
+}
+
+// Run 依次执行 pc 中启用的发布目标，推送 cfg 的发布目录中的文件，耗时记为 upload 阶段。
+func Run(ctx context.Context, pc *Config, cfg *output.Config, res *output.Result) error {
+	stageStart := time.Now()
+	ran := false
+	for _, p := range publishers(pc) {
+		if !p.enabled {
+			continue
+		}
+		ran = true
+		start := time.Now()
+		if err := p.run(ctx, cfg, res); err != nil {
+			return fmt.Errorf("publisher %s: %w", p.name, err)
+		}
+		logging.Publisher.Info("🚚 Published", "target", p.name, "duration", time.Since(start).Round(time.Millisecond))
+	}
+	if ran {
+		res.TimeStage("upload", stageStart)
+	}
+	return nil
+}
+
+// WriteAliases 在发布目录中写入 pc.Aliases 中的副本并记入 res.Published，
+// 原文件须已写入发布目录，因此需在 WriteCompressed 之后、WriteChecksums 之前调用。
+func WriteAliases(pc *Config, cfg *output.Config, res *output.Result) error {
+	for _, alias := range maputil.SortedKeys(pc.Aliases) {
+		name := pc.Aliases[alias]
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to read '%s' for alias %s: %w", name, alias, err)
+		}
+		target := filepath.Join(cfg.PublishDir, filepath.FromSlash(alias))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := fileutil.WriteAtomic(target, data); err != nil {
+			return fmt.Errorf("failed to write alias '%s': %w", target, err)
+		}
+		if !slices.Contains(res.Published, alias) {
+			res.Published = append(res.Published, alias)
+		}
+		if a, ok := res.Artifacts[name]; ok {
+			res.Describe(alias, a.Format, a.Rules)
+		}
+	}
+	return nil
+}
+
+// uploadFiles 返回发布目录中需要推送的文件（相对路径，以 / 分隔）：res.Published 中的全部文件，
+// 以及 res.Extras 中索引页、趋势图与徽章这些不列入校验和的文件。
+func uploadFiles(cfg *output.Config, res *output.Result) []string {
+	files := append([]string(nil), res.Published...)
+	for _, name := range res.Extras {
+		if !slices.Contains(files, name) {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// publishContentType 返回发布文件 name 上传时使用的 Content-Type。
+// 各种规则格式与校验和文件都作为 UTF-8 纯文本，便于在浏览器中直接查看；无法识别的二进制格式为 octet-stream。
+func publishContentType(name string) string {
+	switch path.Ext(name) {
+	case ".txt", ".conf", ".zone", ".list", ".rsc", ".nft", ".yaml", ".minisig", ".asc", ".sig", "":
+		return "text/plain; charset=utf-8"
+	case ".json":
+		return "application/json"
+	case ".md":
+		return "text/markdown; charset=utf-8"
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".svg":
+		return "image/svg+xml"
+	case ".gz":
+		return "application/gzip"
+	case ".zst":
+		return "application/zstd"
+	case ".sqlite":
+		return "application/vnd.sqlite3"
+	}
+	return "application/octet-stream"
+}
+
+// Check 校验 publishers 配置。
+func Check(pc Config) error {
+	for alias, name := range pc.Aliases {
+		for _, p := range []string{alias, name} {
+			if p == "" || path.IsAbs(p) || path.Clean(p) != p || strings.HasPrefix(p, "../") {
+				return fmt.Errorf("publishers.aliases: %q must be a relative path inside the publish directory", p)
+			}
+		}
+		if alias == name {
+			return fmt.Errorf("publishers.aliases: %q is an alias of itself", alias)
+		}
+	}
+	if err := pc.GitHubRelease.check(); err != nil {
+		return err
+	}
+	if err := pc.S3.check(); err != nil {
+		return err
+	}
+	if err := pc.Remote.check(); err != nil {
+		return err
+	}
+	if err := pc.Git.check(); err != nil {
+		return err
+	}
+	if err := pc.Cloudflare.check(); err != nil {
+		return err
+	}
+	if err := pc.IPFS.check(); err != nil {
+		return err
+	}
+	if err := pc.NextDNS.check(); err != nil {
+		return err
+	}
+	if err := checkAdGuardHome(pc.AdGuardHome); err != nil {
+		return err
+	}
+	if err := checkTechnitium(pc.Technitium); err != nil {
+		return err
+	}
+	return checkPihole(pc.Pihole)
+}
+
+// PostBody 以 header POST body，非 2xx 响应视为失败。
+// 错误信息中不包含 endpoint，因为 webhook 地址与 bot token 本身就是凭据。
+func PostBody(ctx context.Context, endpoint string, body []byte, header http.Header, service string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid %s endpoint", service)
+	}
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", service, redactURLError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", service, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// redactURLError 去掉 *url.Error 中的请求地址，只保留底层错误。
+func redactURLError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// RemoteConfig 将发布文件上传到 SFTP 或 FTP 服务器，适合用普通 Web 服务器托管列表的情况。
+// URL 形如 sftp://user@host:22/var/www/lists、ftp://user@host/lists 或 ftps://…（先 AUTH TLS 再登录），
+// 可写 ${VAR} 引用环境变量。密码从环境变量 PasswordEnv 读取；SFTP 也可以使用 PrivateKeyEnv 中的私钥（PEM 内容），
+// 服务器的主机密钥必须通过 KnownHosts 文件或 HostKey 指纹（ssh-keygen -lf 输出的 SHA256:…）校验。
+// 每个文件先写为同目录下的 .part 文件再改名，Web 服务器不会读到写了一半的列表。
+type RemoteConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	URL           string `yaml:"url"`
+	PasswordEnv   string `yaml:"password_env"`
+	PrivateKeyEnv string `yaml:"private_key_env"`
+	KnownHosts    string `yaml:"known_hosts"`
+	HostKey       string `yaml:"host_key"`
+}
+
+// publish 连接服务器并上传 uploadFiles 中的全部文件。
+func (rc RemoteConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	u, err := url.Parse(os.ExpandEnv(rc.URL))
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	files := make(map[string][]byte)
+	names := uploadFiles(cfg, res)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		files[name] = data
+	}
+	password := os.Getenv(rc.PasswordEnv)
+	dir := path.Clean("/" + u.Path)
+	if u.Scheme == "sftp" {
+		err = rc.uploadSFTP(ctx, u, password, dir, names, files)
+	} else {
+		err = uploadFTP(ctx, u, password, dir, names, files)
+	}
+	if err != nil {
+		return err
+	}
+	logging.Publisher.Info("⬆️ Uploaded files", "server", u.Host, "dir", dir, "files", len(names))
+	return nil
+}
+
+// remoteDirs 返回 names 中的文件需要的全部目录（包含 dir 本身），父目录排在前面。
+func remoteDirs(dir string, names []string) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	var add func(p string)
+	add = func(p string) {
+		if p == "/" || p == "." || seen[p] {
+			return
+		}
+		add(path.Dir(p))
+		seen[p] = true
+		dirs = append(dirs, p)
+	}
+	add(dir)
+	for _, name := range names {
+		add(path.Dir(path.Join(dir, name)))
+	}
+	return dirs
+}
+
+// dialRemote 建立到 u 的 TCP 连接，默认端口为 port。ctx 结束时连接被关闭。
+func dialRemote(ctx context.Context, u *url.URL, port string) (net.Conn, func(), error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return conn, func() { stop(); conn.Close() }, nil
+}
+
+// check 校验 remote 配置。
+func (rc RemoteConfig) check() error {
+	if !rc.Enabled {
+		return nil
+	}
+	u, err := url.Parse(os.ExpandEnv(rc.URL))
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("publishers.remote.url must be an sftp://, ftp:// or ftps:// url, got %q", rc.URL)
+	}
+	switch u.Scheme {
+	case "sftp":
+		if rc.KnownHosts == "" && rc.HostKey == "" {
+			return fmt.Errorf("publishers.remote requires known_hosts or host_key for sftp")
+		}
+		if rc.HostKey != "" && !strings.HasPrefix(rc.HostKey, "SHA256:") {
+			return fmt.Errorf("publishers.remote.host_key must be a SHA256:… fingerprint, got %q", rc.HostKey)
+		}
+		if rc.PasswordEnv == "" && rc.PrivateKeyEnv == "" {
+			return fmt.Errorf("publishers.remote requires password_env or private_key_env for sftp")
+		}
+	case "ftp", "ftps":
+		if rc.PasswordEnv == "" {
+			return fmt.Errorf("publishers.remote.password_env must not be empty for %s", u.Scheme)
+		}
+	default:
+		return fmt.Errorf("publishers.remote.url must be an sftp://, ftp:// or ftps:// url, got %q", rc.URL)
+	}
+	if u.User.Username() == "" {
+		return fmt.Errorf("publishers.remote.url must include a user name")
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// S3Config 将发布文件上传到兼容 S3 API 的对象存储（AWS S3、Cloudflare R2、MinIO，以及使用 HMAC 密钥的 GCS）。
+// Endpoint 为空时使用 AWS 的 https://s3.<region>.amazonaws.com；R2 的 endpoint 是
+// https://<account>.r2.cloudflarestorage.com，region 为 auto；GCS 的 endpoint 是 https://storage.googleapis.com。
+// PathStyle 为 true 时桶名写在路径中（MinIO 通常需要），否则写在主机名中。
+// 凭据从环境变量 AccessKeyEnv、SecretKeyEnv 与可选的 SessionTokenEnv 读取。
+type S3Config struct {
+	Enabled         bool   `yaml:"enabled"`
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	Prefix          string `yaml:"prefix"` // 对象键的前缀，例如 lists/
+	PathStyle       bool   `yaml:"path_style"`
+	AccessKeyEnv    string `yaml:"access_key_env"`
+	SecretKeyEnv    string `yaml:"secret_key_env"`
+	SessionTokenEnv string `yaml:"session_token_env"`
+	CacheControl    string `yaml:"cache_control"`
+	ACL             string `yaml:"acl"` // 例如 public-read，为空时不设置（R2 不支持 ACL）
+}
+
+// s3Credentials 是签名请求使用的凭据。
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// publish 上传 uploadFiles 中的全部文件，已存在的对象被覆盖。
+func (sc S3Config) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	creds := s3Credentials{
+		accessKey: os.Getenv(sc.AccessKeyEnv),
+		secretKey: os.Getenv(sc.SecretKeyEnv),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return fmt.Errorf("$%s and $%s must be set", sc.AccessKeyEnv, sc.SecretKeyEnv)
+	}
+	if sc.SessionTokenEnv != "" {
+		creds.sessionToken = os.Getenv(sc.SessionTokenEnv)
+	}
+	files := uploadFiles(cfg, res)
+	var total int
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(cfg.PublishDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		key := path.Join(sc.Prefix, name)
+		if err := sc.putObject(ctx, creds, key, data); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		logging.Publisher.Debug("⬆️ Uploaded object", "key", key, "bytes", len(data))
+		total += len(data)
+	}
+	logging.Publisher.Info("⬆️ Uploaded objects", "bucket", sc.Bucket, "prefix", sc.Prefix, "files", len(files), "bytes", total)
+	return nil
+}
+
+// objectURL 返回 key 对应的对象地址。
+func (sc S3Config) objectURL(key string) (*url.URL, error) {
+	endpoint := sc.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + sc.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	base := u.Path
+	if sc.PathStyle {
+		base += "/" + sc.Bucket
+	} else {
+		u.Host = sc.Bucket + "." + u.Host
+	}
+	u.Path = base + "/" + key
+	u.RawPath = awsURIEncode(base) + "/" + awsURIEncode(key)
+	return u, nil
+}
+
+// putObject 以 PUT 上传一个对象。
+func (sc S3Config) putObject(ctx context.Context, creds s3Credentials, key string, data []byte) error {
+	u, err := sc.objectURL(key)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", publishContentType(key))
+	if sc.CacheControl != "" {
+		req.Header.Set("Cache-Control", sc.CacheControl)
+	}
+	if sc.ACL != "" {
+		req.Header.Set("X-Amz-Acl", sc.ACL)
+	}
+	signV4(req, creds, sc.Region, "s3", data, time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PUT returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// signV4 为没有查询参数的 req 添加 AWS Signature Version 4 的 Authorization 头，payload 是完整的请求体。
+func signV4(req *http.Request, creds s3Credentials, region, service string, payload []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := output.SHA256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // 上传对象的请求没有查询参数
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + output.SHA256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + creds.secretKey)
+	for _, part := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKey, scope, signedHeaders, signature))
+}
+
+// awsURIEncode 按签名规范编码 s：除字母、数字与 -_.~ 外全部转义，/ 保留。
+func awsURIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 返回以 key 计算的 data 的 HMAC-SHA256。
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// check 校验 s3 配置。
+func (sc S3Config) check() error {
+	if !sc.Enabled {
+		return nil
+	}
+	if sc.Bucket == "" || sc.Region == "" {
+		return fmt.Errorf("publishers.s3 requires bucket and region")
+	}
+	if sc.AccessKeyEnv == "" || sc.SecretKeyEnv == "" {
+		return fmt.Errorf("publishers.s3 requires access_key_env and secret_key_env")
+	}
+	if sc.Endpoint != "" {
+		if u, err := url.Parse(sc.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("publishers.s3.endpoint must be an http(s) URL, got %q", sc.Endpoint)
+		}
+	}
+	if strings.HasPrefix(sc.Prefix, "/") {
+		return fmt.Errorf("publishers.s3.prefix must not start with /")
+	}
+	return nil
+}
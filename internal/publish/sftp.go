@@ -0,0 +1,372 @@
+package publish
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"adguardlist/internal/logging"
+)
+
+// SFTP 协议第 3 版（draft-ietf-secsh-filexfer-02）中用到的报文类型。
+// 只实现了上传需要的部分，不值得为此引入完整的 SFTP 库。
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpWrite    = 6
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpStat     = 17
+	sftpRename   = 18
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpExtended = 200
+)
+
+const (
+	sftpFlagWrite    = 0x02
+	sftpFlagCreate   = 0x08
+	sftpFlagTruncate = 0x10
+	sftpAttrPerms    = 0x04
+
+	sftpStatusOK     = 0
+	sftpStatusNoFile = 2
+
+	// sftpChunk 是单个 WRITE 请求的数据量，sftpInflight 是同时未确认的 WRITE 请求数
+	sftpChunk    = 32 * 1024
+	sftpInflight = 16
+)
+
+// sftpClient 是一个 SFTP 会话，请求依次发送，只有 WRITE 请求会并行。
+type sftpClient struct {
+	w         io.WriteCloser
+	r         io.Reader
+	id        uint32
+	posixMove bool // 服务器支持 posix-rename@openssh.com，可以直接覆盖目标文件
+}
+
+// errSFTPNoFile 表示服务器返回了 SSH_FX_NO_SUCH_FILE。
+var errSFTPNoFile = errors.New("no such file")
+
+// uploadSFTP 通过 SFTP 将 files 上传到 dir。
+func (rc RemoteConfig) uploadSFTP(ctx context.Context, u *url.URL, password, dir string, names []string, files map[string][]byte) error {
+	hostKey, err := rc.hostKeyCallback()
+	if err != nil {
+		return err
+	}
+	config := &ssh.ClientConfig{User: u.User.Username(), HostKeyCallback: hostKey}
+	if rc.PrivateKeyEnv != "" {
+		if pem := os.Getenv(rc.PrivateKeyEnv); pem != "" {
+			signer, err := ssh.ParsePrivateKey([]byte(pem))
+			if err != nil {
+				return fmt.Errorf("invalid private key in $%s: %w", rc.PrivateKeyEnv, err)
+			}
+			config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+		}
+	}
+	if password != "" {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	if len(config.Auth) == 0 {
+		return fmt.Errorf("no credentials: set $%s or $%s", rc.PasswordEnv, rc.PrivateKeyEnv)
+	}
+
+	conn, closeConn, err := dialRemote(ctx, u, "22")
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	sc, chans, reqs, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if err != nil {
+		return fmt.Errorf("ssh handshake with %s failed: %w", u.Host, err)
+	}
+	client := ssh.NewClient(sc, chans, reqs)
+	defer client.Close()
+	c, err := newSFTPClient(client)
+	if err != nil {
+		return err
+	}
+	defer c.w.Close()
+
+	for _, d := range remoteDirs(dir, names) {
+		if err := c.mkdir(d); err != nil {
+			return fmt.Errorf("failed to create %s: %w", d, err)
+		}
+	}
+	for _, name := range names {
+		target := path.Join(dir, name)
+		if err := c.upload(target, files[name]); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", target, err)
+		}
+		logging.Publisher.Debug("⬆️ Uploaded file", "path", target, "bytes", len(files[name]))
+	}
+	return nil
+}
+
+// hostKeyCallback 返回校验服务器主机密钥的函数。
+func (rc RemoteConfig) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if rc.KnownHosts != "" {
+		cb, err := knownhosts.New(rc.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+		}
+		return cb, nil
+	}
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != rc.HostKey {
+			return fmt.Errorf("host key mismatch for %s: got %s, want %s", hostname, got, rc.HostKey)
+		}
+		return nil
+	}, nil
+}
+
+// newSFTPClient 在 client 上启动 sftp 子系统并完成版本协商。
+func newSFTPClient(client *ssh.Client) (*sftpClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, fmt.Errorf("server does not support sftp: %w", err)
+	}
+	c := &sftpClient{w: w, r: r}
+	if err := c.send(sftpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, err
+	}
+	typ, data, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if typ != sftpVersion || len(data) < 4 {
+		return nil, fmt.Errorf("unexpected sftp packet %d during handshake", typ)
+	}
+	// 版本号之后是扩展名与扩展数据组成的字符串对
+	for rest := data[4:]; len(rest) > 0; {
+		var name, value []byte
+		if name, rest, err = sftpString(rest); err != nil {
+			break
+		}
+		if value, rest, err = sftpString(rest); err != nil {
+			break
+		}
+		if string(name) == "posix-rename@openssh.com" && string(value) == "1" {
+			c.posixMove = true
+		}
+	}
+	return c, nil
+}
+
+// send 发送一个报文，payload 不包含长度与类型。
+func (c *sftpClient) send(typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(make([]byte, 0, 5+len(payload)), uint32(1+len(payload)))
+	packet = append(packet, typ)
+	_, err := c.w.Write(append(packet, payload...))
+	return err
+}
+
+// recv 读取一个报文，返回类型与其余内容。
+func (c *sftpClient) recv() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("failed to read sftp response: %w", err)
+	}
+	n := binary.BigEndian.Uint32(header[:4])
+	if n < 1 || n > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", n)
+	}
+	data := make([]byte, n-1)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return 0, nil, fmt.Errorf("failed to read sftp response: %w", err)
+	}
+	return header[4], data, nil
+}
+
+// request 发送一个带请求 id 的报文，fields 依次是 string（[]byte 或 string）、uint32 或 uint64 字段。
+func (c *sftpClient) request(typ byte, fields ...any) (uint32, error) {
+	c.id++
+	payload := binary.BigEndian.AppendUint32(nil, c.id)
+	for _, f := range fields {
+		switch v := f.(type) {
+		case string:
+			payload = appendSFTPString(payload, []byte(v))
+		case []byte:
+			payload = appendSFTPString(payload, v)
+		case uint32:
+			payload = binary.BigEndian.AppendUint32(payload, v)
+		case uint64:
+			payload = binary.BigEndian.AppendUint64(payload, v)
+		}
+	}
+	return c.id, c.send(typ, payload)
+}
+
+// response 读取下一个响应，返回其请求 id、类型与 id 之后的内容。
+func (c *sftpClient) response() (uint32, byte, []byte, error) {
+	typ, data, err := c.recv()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(data) < 4 {
+		return 0, 0, nil, fmt.Errorf("short sftp response")
+	}
+	return binary.BigEndian.Uint32(data), typ, data[4:], nil
+}
+
+// reply 读取 id 的响应，返回类型与 id 之后的内容；STATUS 响应转换为错误（OK 时为 nil）。
+func (c *sftpClient) reply(id uint32) (byte, []byte, error) {
+	got, typ, data, err := c.response()
+	if err != nil {
+		return 0, nil, err
+	}
+	if got != id {
+		return 0, nil, fmt.Errorf("unexpected sftp response for request %d", id)
+	}
+	return sftpResult(typ, data)
+}
+
+// sftpResult 将 STATUS 响应转换为错误（OK 时为 nil），其他响应原样返回。
+func sftpResult(typ byte, data []byte) (byte, []byte, error) {
+	if typ != sftpStatus {
+		return typ, data, nil
+	}
+	if len(data) < 4 {
+		return 0, nil, fmt.Errorf("short sftp status")
+	}
+	switch code := binary.BigEndian.Uint32(data); code {
+	case sftpStatusOK:
+		return typ, nil, nil
+	case sftpStatusNoFile:
+		return typ, nil, errSFTPNoFile
+	default:
+		msg, _, _ := sftpString(data[4:])
+		return typ, nil, fmt.Errorf("sftp error %d: %s", code, msg)
+	}
+}
+
+// call 发送请求并等待其响应。
+func (c *sftpClient) call(typ byte, fields ...any) (byte, []byte, error) {
+	id, err := c.request(typ, fields...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return c.reply(id)
+}
+
+// mkdir 在 p 不存在时创建目录。
+func (c *sftpClient) mkdir(p string) error {
+	_, _, err := c.call(sftpStat, p)
+	if !errors.Is(err, errSFTPNoFile) {
+		return err
+	}
+	_, _, err = c.call(sftpMkdir, p, uint32(sftpAttrPerms), uint32(0o755))
+	return err
+}
+
+// upload 将 data 写入 p.part 后改名为 p。
+func (c *sftpClient) upload(p string, data []byte) error {
+	tmp := p + ".part"
+	typ, handle, err := c.call(sftpOpen, tmp, uint32(sftpFlagWrite|sftpFlagCreate|sftpFlagTruncate), uint32(sftpAttrPerms), uint32(0o644))
+	if err != nil {
+		return err
+	}
+	if typ != sftpHandle {
+		return fmt.Errorf("unexpected sftp response %d to open", typ)
+	}
+	if handle, _, err = sftpString(handle); err != nil {
+		return err
+	}
+	if err := c.write(handle, data); err != nil {
+		c.call(sftpClose, handle)
+		return err
+	}
+	if _, _, err := c.call(sftpClose, handle); err != nil {
+		return err
+	}
+	if c.posixMove {
+		_, _, err = c.call(sftpExtended, "posix-rename@openssh.com", tmp, p)
+		return err
+	}
+	// 第 3 版的 RENAME 不覆盖已存在的文件
+	if _, _, err := c.call(sftpRemove, p); err != nil && !errors.Is(err, errSFTPNoFile) {
+		return err
+	}
+	_, _, err = c.call(sftpRename, tmp, p)
+	return err
+}
+
+// write 分块写入 data，最多 sftpInflight 个 WRITE 请求同时等待确认。
+// 服务器不一定按请求的顺序确认，响应按请求 id 匹配。
+func (c *sftpClient) write(handle, data []byte) error {
+	pending := make(map[uint32]bool, sftpInflight)
+	var firstErr error
+	// wait 读取任一未确认请求的响应，WRITE 失败记入 firstErr，连接出错时返回错误
+	wait := func() error {
+		id, typ, resp, err := c.response()
+		if err != nil {
+			return err
+		}
+		if !pending[id] {
+			return fmt.Errorf("unexpected sftp response for request %d", id)
+		}
+		delete(pending, id)
+		if _, _, err := sftpResult(typ, resp); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	}
+	for off := 0; off < len(data) && firstErr == nil; off += sftpChunk {
+		chunk := data[off:min(off+sftpChunk, len(data))]
+		id, err := c.request(sftpWrite, handle, uint64(off), chunk)
+		if err != nil {
+			return err
+		}
+		pending[id] = true
+		if len(pending) == sftpInflight {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+	}
+	for len(pending) > 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	return firstErr
+}
+
+// appendSFTPString 追加一个带 uint32 长度前缀的字符串。
+func appendSFTPString(b, s []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(b, uint32(len(s))), s...)
+}
+
+// sftpString 读取一个带长度前缀的字符串，返回其内容与剩余部分。
+func sftpString(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, fmt.Errorf("short sftp packet")
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, fmt.Errorf("short sftp packet")
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
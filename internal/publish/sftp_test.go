@@ -0,0 +1,327 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 测试服务器额外用到的报文类型与状态码
+const (
+	sftpAttrs = 105
+
+	sftpStatusFailure     = 4
+	sftpStatusUnsupported = 8
+)
+
+// sftpTestServer 是内存中的 SFTP 服务器，只实现 uploadSFTP 用到的请求。
+// WRITE 的确认被暂存，攒满 sftpInflight 个或客户端暂停发送后按相反的顺序返回。
+type sftpTestServer struct {
+	posixRename bool
+
+	mu          sync.Mutex
+	files       map[string][]byte
+	dirs        map[string]bool
+	ops         []string // 除 WRITE 外收到的请求，如 "mkdir /srv/lists"
+	maxInflight int      // 同时未确认的 WRITE 请求数的最大值
+	reordered   bool     // 是否有 WRITE 的确认晚于其后的请求
+}
+
+// start 在本地端口上启动 SSH 服务器，只接受密码 secret，返回其地址与主机密钥指纹。
+func (s *sftpTestServer) start(t *testing.T) (string, string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		if string(password) != "secret" {
+			return nil, fmt.Errorf("wrong password")
+		}
+		return nil, nil
+	}}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, config)
+		}
+	}()
+	return ln.Addr().String(), ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+// serveConn 完成 SSH 握手，在会话请求 sftp 子系统时开始处理 SFTP 请求。
+func (s *sftpTestServer) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				ok := req.Type == "subsystem" && bytes.Equal(req.Payload, appendSFTPString(nil, []byte("sftp")))
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						defer ch.Close()
+						s.serveSFTP(ch)
+					}()
+				}
+			}
+		}()
+	}
+}
+
+// serveSFTP 处理一个 sftp 子系统会话，直到客户端关闭。
+func (s *sftpTestServer) serveSFTP(rw io.ReadWriter) {
+	packets := make(chan []byte)
+	go func() {
+		defer close(packets)
+		for {
+			var header [4]byte
+			if _, err := io.ReadFull(rw, header[:]); err != nil {
+				return
+			}
+			packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+			if _, err := io.ReadFull(rw, packet); err != nil {
+				return
+			}
+			packets <- packet
+		}
+	}()
+	send := func(typ byte, payload []byte) {
+		packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)))
+		rw.Write(append(append(packet, typ), payload...))
+	}
+	status := func(id, code uint32) {
+		send(sftpStatus, binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, id), code))
+	}
+	// held 是暂存的 WRITE 确认的请求 id，flush 按相反的顺序发送
+	var held []uint32
+	flush := func() {
+		if len(held) > 1 {
+			s.mu.Lock()
+			s.reordered = true
+			s.mu.Unlock()
+		}
+		for i := len(held) - 1; i >= 0; i-- {
+			status(held[i], sftpStatusOK)
+		}
+		held = nil
+	}
+	handles := make(map[string]string)
+	for {
+		var packet []byte
+		var ok bool
+		if len(held) > 0 {
+			select {
+			case packet, ok = <-packets:
+			case <-time.After(20 * time.Millisecond):
+				flush()
+				continue
+			}
+		} else {
+			packet, ok = <-packets
+		}
+		if !ok {
+			return
+		}
+		typ, data := packet[0], packet[1:]
+		if typ == sftpInit {
+			version := binary.BigEndian.AppendUint32(nil, 3)
+			if s.posixRename {
+				version = appendSFTPString(appendSFTPString(version, []byte("posix-rename@openssh.com")), []byte("1"))
+			}
+			send(sftpVersion, version)
+			continue
+		}
+		id, rest := binary.BigEndian.Uint32(data), data[4:]
+		if typ == sftpWrite {
+			// WRITE 的字段依次是句柄、uint64 偏移量与数据
+			handle, rest, _ := sftpString(rest)
+			off := binary.BigEndian.Uint64(rest)
+			chunk, _, _ := sftpString(rest[8:])
+			s.mu.Lock()
+			path := handles[string(handle)]
+			file := s.files[path]
+			if need := int(off) + len(chunk); len(file) < need {
+				file = append(file, make([]byte, need-len(file))...)
+			}
+			copy(file[off:], chunk)
+			s.files[path] = file
+			held = append(held, id)
+			s.maxInflight = max(s.maxInflight, len(held))
+			s.mu.Unlock()
+			if len(held) == sftpInflight {
+				flush()
+			}
+			continue
+		}
+		flush()
+
+		// 其余请求只用到开头的字符串字段，之后的 uint32 字段被忽略
+		var args []string
+		for len(rest) >= 4 {
+			arg, next, err := sftpString(rest)
+			if err != nil {
+				break
+			}
+			args = append(args, string(arg))
+			rest = next
+		}
+		s.mu.Lock()
+		code := uint32(sftpStatusOK)
+		switch typ {
+		case sftpStat:
+			s.ops = append(s.ops, "stat "+args[0])
+			if s.dirs[args[0]] || s.files[args[0]] != nil {
+				s.mu.Unlock()
+				send(sftpAttrs, binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, id), 0))
+				continue
+			}
+			code = sftpStatusNoFile
+		case sftpMkdir:
+			s.ops = append(s.ops, "mkdir "+args[0])
+			s.dirs[args[0]] = true
+		case sftpOpen:
+			s.ops = append(s.ops, "open "+args[0])
+			s.files[args[0]] = []byte{}
+			handle := fmt.Sprintf("h%d", id)
+			handles[handle] = args[0]
+			s.mu.Unlock()
+			send(sftpHandle, appendSFTPString(binary.BigEndian.AppendUint32(nil, id), []byte(handle)))
+			continue
+		case sftpClose:
+			s.ops = append(s.ops, "close "+handles[args[0]])
+			delete(handles, args[0])
+		case sftpRemove:
+			s.ops = append(s.ops, "remove "+args[0])
+			if s.files[args[0]] == nil {
+				code = sftpStatusNoFile
+			}
+			delete(s.files, args[0])
+		case sftpRename:
+			s.ops = append(s.ops, "rename "+args[0]+" "+args[1])
+			// 第 3 版的 RENAME 不覆盖已存在的文件
+			if s.files[args[1]] != nil {
+				code = sftpStatusFailure
+			} else {
+				s.files[args[1]] = s.files[args[0]]
+				delete(s.files, args[0])
+			}
+		case sftpExtended:
+			s.ops = append(s.ops, args[0]+" "+args[1]+" "+args[2])
+			if args[0] != "posix-rename@openssh.com" || !s.posixRename {
+				code = sftpStatusUnsupported
+			} else {
+				s.files[args[2]] = s.files[args[1]]
+				delete(s.files, args[1])
+			}
+		default:
+			code = sftpStatusUnsupported
+		}
+		s.mu.Unlock()
+		status(id, code)
+	}
+}
+
+// 上传时先创建缺少的目录，WRITE 请求并行发送且确认乱序返回，最后以 posix-rename 或 REMOVE 加 RENAME 覆盖旧文件。
+func TestUploadSFTP(t *testing.T) {
+	big := bytes.Repeat([]byte("||ads.example.com^\n"), (20*sftpChunk+100)/19)
+	files := map[string][]byte{"output.txt": big, "categories/ads.txt": []byte("||ads.example.com^\n")}
+	names := []string{"output.txt", "categories/ads.txt"}
+	tests := []struct {
+		name        string
+		posixRename bool
+		wantRename  string
+	}{
+		{name: "posix-rename", posixRename: true, wantRename: "posix-rename@openssh.com /srv/lists/output.txt.part /srv/lists/output.txt"},
+		{name: "remove and rename", wantRename: "rename /srv/lists/output.txt.part /srv/lists/output.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sftpTestServer{
+				posixRename: tt.posixRename,
+				files:       map[string][]byte{"/srv/lists/output.txt": []byte("old list\n")},
+				dirs:        map[string]bool{"/srv": true, "/srv/lists": true},
+			}
+			addr, fingerprint := s.start(t)
+			u, err := url.Parse("sftp://publisher@" + addr + "/srv/lists")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc := RemoteConfig{HostKey: fingerprint}
+			if err := rc.uploadSFTP(context.Background(), u, "secret", "/srv/lists", names, files); err != nil {
+				t.Fatalf("uploadSFTP() error = %v", err)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, name := range names {
+				if got := s.files["/srv/lists/"+name]; !bytes.Equal(got, files[name]) {
+					t.Errorf("%s has %d bytes, want %d", name, len(got), len(files[name]))
+				}
+				if _, ok := s.files["/srv/lists/"+name+".part"]; ok {
+					t.Errorf("%s.part was left behind", name)
+				}
+			}
+			if !s.dirs["/srv/lists/categories"] || slices.Contains(s.ops, "mkdir /srv/lists") {
+				t.Errorf("ops = %q, want only the missing directory to be created", s.ops)
+			}
+			if !slices.Contains(s.ops, tt.wantRename) {
+				t.Errorf("ops = %q, want %q", s.ops, tt.wantRename)
+			}
+			if s.maxInflight != sftpInflight || !s.reordered {
+				t.Errorf("max in-flight writes = %d, reordered = %v, want %d pipelined writes acknowledged out of order", s.maxInflight, s.reordered, sftpInflight)
+			}
+		})
+	}
+}
+
+// 主机密钥与配置的指纹不符时不发送密码。
+func TestUploadSFTPHostKeyMismatch(t *testing.T) {
+	s := &sftpTestServer{files: map[string][]byte{}, dirs: map[string]bool{}}
+	addr, _ := s.start(t)
+	u, err := url.Parse("sftp://publisher@" + addr + "/srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := RemoteConfig{HostKey: "SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}
+	if err := rc.uploadSFTP(context.Background(), u, "secret", "/srv", nil, nil); err == nil {
+		t.Error("uploadSFTP() succeeded with a mismatching host key")
+	}
+}
@@ -0,0 +1,119 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// TechnitiumConfig 是构建成功后导入合并列表的 Technitium DNS Server 实例：列表中被整体屏蔽的域名
+// 通过 HTTP API 导入到服务器的 Blocked 区域。Flush 为 true 时导入前先清空 Blocked 区域，
+// 使已从列表中移除的域名同时被移除（手动添加的条目也会被清空）。
+// URL 可写 ${VAR}，API token 从环境变量 TokenEnv 读取（在 Administration 页面创建）。
+// 实例通常在内网中，只有在能访问它的机器上运行构建时才适用。
+type TechnitiumConfig struct {
+	URL      string `yaml:"url"`
+	TokenEnv string `yaml:"token_env"`
+	Flush    *bool  `yaml:"flush"`
+}
+
+// technitiumImportBatch 是单次导入请求中的最多域名数，避免请求体过大。
+const technitiumImportBatch = 10000
+
+// technitiumClient 调用 Technitium DNS Server 的 HTTP API。
+type technitiumClient struct {
+	base  string
+	token string
+}
+
+// call 以表单 POST 调用 endpoint，返回 status 不为 ok 时的错误。
+func (c *technitiumClient) call(ctx context.Context, endpoint string, form url.Values) error {
+	form.Set("token", c.token)
+	resp, err := postForm(ctx, c.base+endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(raw, &result); err != nil || resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(raw[:min(len(raw), 512)])))
+	}
+	if result.Status != "ok" {
+		msg := result.ErrorMessage
+		if msg == "" {
+			msg = result.Status
+		}
+		return fmt.Errorf("%s failed: %s", endpoint, msg)
+	}
+	return nil
+}
+
+// postForm 以 application/x-www-form-urlencoded 发送 form。
+func postForm(ctx context.Context, endpoint string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return http.DefaultClient.Do(req)
+}
+
+// publish 将域名导入到实例的 Blocked 区域。
+func (tc TechnitiumConfig) publish(ctx context.Context, cfg *output.Config, res *output.Result) error {
+	token := os.Getenv(tc.TokenEnv)
+	if token == "" {
+		return fmt.Errorf("$%s is not set", tc.TokenEnv)
+	}
+	c := &technitiumClient{base: strings.TrimSuffix(os.ExpandEnv(tc.URL), "/"), token: token}
+	domains := output.BlockedDomainList(res.Content)
+	if tc.flush() {
+		if err := c.call(ctx, "/api/blocked/flush", url.Values{}); err != nil {
+			return fmt.Errorf("failed to flush blocked zones: %w", err)
+		}
+	}
+	for start := 0; start < len(domains); start += technitiumImportBatch {
+		batch := domains[start:min(start+technitiumImportBatch, len(domains))]
+		form := url.Values{"blockedZones": {strings.Join(batch, ",")}}
+		if err := c.call(ctx, "/api/blocked/import", form); err != nil {
+			return fmt.Errorf("failed to import blocked zones: %w", err)
+		}
+	}
+	logging.Publisher.Info("🧱 Imported blocked zones to Technitium", "server", c.base, "domains", len(domains))
+	return nil
+}
+
+// flush 返回导入前是否清空 Blocked 区域，未配置时为 true。
+func (tc TechnitiumConfig) flush() bool {
+	return tc.Flush == nil || *tc.Flush
+}
+
+// checkTechnitium 校验 publishers.technitium 并填充默认值：token_env 默认为 TECHNITIUM_TOKEN。
+func checkTechnitium(instances []TechnitiumConfig) error {
+	for i := range instances {
+		tc := &instances[i]
+		if tc.TokenEnv == "" {
+			tc.TokenEnv = "TECHNITIUM_TOKEN"
+		}
+		if tc.URL == "" {
+			return fmt.Errorf("publishers.technitium[%d].url must not be empty", i)
+		}
+		if os.Expand(tc.URL, func(string) string { return "" }) == tc.URL {
+			if u, err := url.Parse(tc.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("publishers.technitium[%d].url must be an http(s) url", i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package source
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxyDirect 用于在单个源上关闭全局代理。
+const proxyDirect = "direct"
+
+// ProxyFunc 将配置中的代理地址转换为 http.Transport 使用的 Proxy 函数。
+// 空字符串表示沿用 HTTP_PROXY/HTTPS_PROXY/NO_PROXY 环境变量，"direct" 表示不使用代理。
+// 支持 http、https、socks5 与 socks5h 代理。
+func ProxyFunc(raw string) (func(*http.Request) (*url.URL, error), error) {
+	switch raw = strings.TrimSpace(raw); raw {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case proxyDirect:
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", raw)
+	}
+	return http.ProxyURL(u), nil
+}
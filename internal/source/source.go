@@ -0,0 +1,257 @@
+// Package source 读取并校验规则源列表，描述每个源的地址、格式与下载选项。
+package source
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"adguardlist/internal/transform"
+)
+
+// 内容哈希校验失败时的处理方式。
+const (
+	pinEnforce = "enforce"
+	PinWarn    = "warn"
+)
+
+// Source 描述一个规则源及其处理方式。
+type Source struct {
+	Name            string            `yaml:"name"`
+	URL             string            `yaml:"url"`
+	Format          string            `yaml:"format"`
+	Enabled         *bool             `yaml:"enabled"`
+	Transformations []string          `yaml:"transformations"`
+	Proxy           string            `yaml:"proxy"`
+	Timeout         time.Duration     `yaml:"timeout"`
+	Retries         *int              `yaml:"retries"`
+	MaxSize         ByteSize          `yaml:"max_size"`
+	Headers         map[string]string `yaml:"headers"`
+	Query           map[string]string `yaml:"query"`
+	SHA256          string            `yaml:"sha256"`
+	Pin             string            `yaml:"pin"`
+	Git             string            `yaml:"git"`
+	Ref             string            `yaml:"ref"`
+	Path            string            `yaml:"path"`
+	TLS             TLSOptions        `yaml:"tls"`
+	Priority        int               `yaml:"priority"`
+	Categories      []string          `yaml:"categories"`
+}
+
+// sourceList 是结构化规则源文件的顶层结构。
+type sourceList struct {
+	Sources []Source `yaml:"sources"`
+}
+
+// IsEnabled 报告该源是否参与构建，未设置 enabled 时默认启用。
+func (s Source) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// ReadLines 将整个文件读入内存，并返回一个字符串切片。
+func ReadLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// IsGit 报告该源是否从 Git 仓库读取。
+func (s Source) IsGit() bool {
+	return s.Git != ""
+}
+
+// LocalPath 在源指向本地文件（file:// URL 或不带协议的路径）时返回文件路径。
+// 相对路径以当前工作目录为基准。
+func (s Source) LocalPath() (string, bool) {
+	if s.IsGit() {
+		return "", false
+	}
+	if strings.HasPrefix(s.URL, "file:") {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return "", false
+		}
+		// file://relative/path 中的第一段会被解析为 Host
+		return filepath.FromSlash(u.Host + u.Path + u.Opaque), true
+	}
+	if !strings.Contains(s.URL, "://") {
+		return s.URL, true
+	}
+	return "", false
+}
+
+// Load 读取规则源文件。.yaml/.yml 文件按结构化格式解析，
+// 其他文件按每行一个 URL 的旧格式解析。
+func Load(path string) ([]Source, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".yaml" && ext != ".yml" {
+		urls, err := ReadLines(path)
+		if err != nil {
+			return nil, err
+		}
+		sources := make([]Source, 0, len(urls))
+		for _, url := range urls {
+			sources = append(sources, Source{URL: url})
+		}
+		return Normalize(sources)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list sourceList
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse sources: %w", err)
+	}
+	return Normalize(list.Sources)
+}
+
+// Normalize 填充默认值并校验每个源的字段。
+func Normalize(sources []Source) ([]Source, error) {
+	for i := range sources {
+		src := &sources[i]
+		src.URL = strings.TrimSpace(src.URL)
+		if src.Git = strings.TrimSpace(src.Git); src.Git != "" {
+			if src.URL != "" {
+				return nil, fmt.Errorf("source #%d sets both url and git", i+1)
+			}
+			if src.Path == "" {
+				return nil, fmt.Errorf("git source #%d has no path", i+1)
+			}
+			// 以 "-" 开头的值会被 git 当作选项
+			for _, v := range []string{src.Git, src.Ref, src.Path} {
+				if strings.HasPrefix(v, "-") {
+					return nil, fmt.Errorf("git source #%d: git, ref and path must not start with '-', got %q", i+1, v)
+				}
+			}
+			src.URL = gitIdentity(src.Git, src.Ref, src.Path)
+		}
+		if src.URL == "" {
+			return nil, fmt.Errorf("source #%d has no url", i+1)
+		}
+		if src.Name == "" {
+			src.Name = src.URL
+		}
+		src.Format = strings.ToLower(strings.TrimSpace(src.Format))
+		switch src.Format {
+		case "":
+			src.Format = transform.FormatAuto
+		case transform.FormatAuto, transform.FormatAdblock, transform.FormatHosts, transform.FormatDomains, transform.FormatDnsmasq:
+		default:
+			return nil, fmt.Errorf("source %q has unknown format %q", src.Name, src.Format)
+		}
+		if src.Timeout < 0 || src.MaxSize < 0 || src.Retries != nil && *src.Retries < 0 {
+			return nil, fmt.Errorf("source %q: timeout, retries and max_size must not be negative", src.Name)
+		}
+		src.SHA256 = strings.ToLower(strings.TrimSpace(src.SHA256))
+		if src.SHA256 != "" {
+			if _, err := hex.DecodeString(src.SHA256); err != nil || len(src.SHA256) != 64 {
+				return nil, fmt.Errorf("source %q has invalid sha256 %q", src.Name, src.SHA256)
+			}
+		}
+		switch src.Pin {
+		case "":
+			src.Pin = pinEnforce
+		case pinEnforce, PinWarn:
+		default:
+			return nil, fmt.Errorf("source %q has unknown pin mode %q", src.Name, src.Pin)
+		}
+		if _, err := ProxyFunc(src.Proxy); err != nil {
+			return nil, fmt.Errorf("source %q: %w", src.Name, err)
+		}
+		if err := src.TLS.check(); err != nil {
+			return nil, fmt.Errorf("source %q: %w", src.Name, err)
+		}
+		for _, t := range src.Transformations {
+			if !transform.Known[t] {
+				return nil, fmt.Errorf("source %q has unknown transformation %q", src.Name, t)
+			}
+		}
+		categories, err := NormalizeCategories(src.Categories)
+		if err != nil {
+			return nil, fmt.Errorf("source %q: %w", src.Name, err)
+		}
+		src.Categories = categories
+	}
+	if err := checkCategoryCount(sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// Enabled 过滤掉被禁用的源。
+func Enabled(sources []Source) []Source {
+	var enabled []Source
+	for _, src := range sources {
+		if src.IsEnabled() {
+			enabled = append(enabled, src)
+		}
+	}
+	return enabled
+}
+
+// gitIdentity 返回 Git 源在日志、文件头和缓存中使用的标识。
+func gitIdentity(repo, ref, path string) string {
+	id := "git+" + repo
+	if ref != "" {
+		id += "@" + ref
+	}
+	return id + "#" + path
+}
+
+// maxCategories 是所有源的分类总数上限，每条规则的分类以 64 位掩码记录。
+const maxCategories = 64
+
+// CategoryPattern 是合法的分类名称，分类名称会出现在文件名中。
+var CategoryPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// NormalizeCategories 将 categories 转换为小写并去重，校验名称是否合法。
+func NormalizeCategories(categories []string) ([]string, error) {
+	var out []string
+	for _, c := range categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !CategoryPattern.MatchString(c) {
+			return nil, fmt.Errorf("invalid category %q", c)
+		}
+		if !slices.Contains(out, c) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// checkCategoryCount 校验所有源的分类总数不超过 maxCategories。
+func checkCategoryCount(sources []Source) error {
+	all := make(map[string]bool)
+	for _, src := range sources {
+		for _, c := range src.Categories {
+			all[c] = true
+		}
+	}
+	if len(all) > maxCategories {
+		return fmt.Errorf("sources use %d categories, at most %d are supported", len(all), maxCategories)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	retries := -1
+	tests := []struct {
+		name    string
+		src     Source
+		want    Source
+		wantErr string
+	}{
+		{
+			name: "defaults are filled in",
+			src:  Source{URL: " https://example.com/list.txt ", Format: " Hosts ", SHA256: strings.Repeat("AB", 32), Categories: []string{"Ads", "ads", " malware"}},
+			want: Source{Name: "https://example.com/list.txt", URL: "https://example.com/list.txt", Format: "hosts", SHA256: strings.Repeat("ab", 32), Pin: pinEnforce, Categories: []string{"ads", "malware"}},
+		},
+		{
+			name: "git source gets an identity url",
+			src:  Source{Name: "repo", Git: "https://example.com/repo.git", Ref: "main", Path: "list.txt", Pin: PinWarn},
+			want: Source{Name: "repo", URL: "git+https://example.com/repo.git@main#list.txt", Format: "auto", Git: "https://example.com/repo.git", Ref: "main", Path: "list.txt", Pin: PinWarn},
+		},
+		{name: "missing url", src: Source{Name: "empty"}, wantErr: "has no url"},
+		{name: "url and git", src: Source{URL: "https://example.com", Git: "https://example.com/repo.git", Path: "a"}, wantErr: "both url and git"},
+		{name: "git without path", src: Source{Git: "https://example.com/repo.git"}, wantErr: "has no path"},
+		{name: "git option injection", src: Source{Git: "--upload-pack=touch /tmp/x", Path: "a"}, wantErr: "must not start with '-'"},
+		{name: "ref option injection", src: Source{Git: "https://example.com/repo.git", Ref: "--output=/tmp/x", Path: "a"}, wantErr: "must not start with '-'"},
+		{name: "unknown format", src: Source{URL: "https://example.com", Format: "csv"}, wantErr: "unknown format"},
+		{name: "negative retries", src: Source{URL: "https://example.com", Retries: &retries}, wantErr: "must not be negative"},
+		{name: "short sha256", src: Source{URL: "https://example.com", SHA256: "abcd"}, wantErr: "invalid sha256"},
+		{name: "unknown pin", src: Source{URL: "https://example.com", Pin: "maybe"}, wantErr: "unknown pin mode"},
+		{name: "unknown transformation", src: Source{URL: "https://example.com", Transformations: []string{"Shuffle"}}, wantErr: "unknown transformation"},
+		{name: "invalid category", src: Source{URL: "https://example.com", Categories: []string{"ads/extra"}}, wantErr: "invalid category"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize([]Source{tt.src})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Normalize() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if g := got[0]; fmt.Sprintf("%+v", g) != fmt.Sprintf("%+v", tt.want) {
+				t.Errorf("Normalize() = %+v, want %+v", g, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCategoryLimit(t *testing.T) {
+	sources := make([]Source, maxCategories+1)
+	for i := range sources {
+		sources[i] = Source{URL: fmt.Sprintf("https://example.com/%d", i), Categories: []string{fmt.Sprintf("c%d", i)}}
+	}
+	if _, err := Normalize(sources[:maxCategories]); err != nil {
+		t.Errorf("Normalize() with %d categories error = %v", maxCategories, err)
+	}
+	if _, err := Normalize(sources); err == nil {
+		t.Errorf("Normalize() with %d categories succeeded, want an error", len(sources))
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"512KB", 512 << 10, false},
+		{"50 mb", 50 << 20, false},
+		{"1GiB", 1 << 30, false},
+		{"10B", 10, false},
+		{"lots", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+	for b, want := range map[ByteSize]string{50 << 20: "50MB", 1536: "1536B", 2 << 10: "2KB", 1 << 30: "1GB"} {
+		if got := b.String(); got != want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(b), got, want)
+		}
+	}
+}
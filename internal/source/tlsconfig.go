@@ -0,0 +1,77 @@
+package source
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSOptions 是单个源的 TLS 设置，用于自签名 CA 或需要客户端证书的内部服务器。
+type TLSOptions struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	MinVersion         string `yaml:"min_version"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// tlsVersions 是 min_version 支持的取值。
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// IsZero 判断是否未配置任何 TLS 选项。
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// check 检查不需要读取文件的选项是否合法。
+func (o TLSOptions) check() error {
+	if o.MinVersion != "" {
+		if _, ok := tlsVersions[strings.TrimSpace(o.MinVersion)]; !ok {
+			return fmt.Errorf("unsupported tls min_version %q (use 1.0, 1.1, 1.2 or 1.3)", o.MinVersion)
+		}
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// Config 根据选项创建 tls.Config；CA 证书会追加到系统根证书之后。
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.MinVersion != "" {
+		cfg.MinVersion = tlsVersions[strings.TrimSpace(o.MinVersion)]
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls ca_file '%s'", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,228 @@
+package transform
+
+import (
+	"net"
+	"strings"
+
+	"adguardlist/internal/logging"
+)
+
+// 支持的规则源格式。
+const (
+	FormatAuto    = "auto"
+	FormatAdblock = "adblock"
+	FormatHosts   = "hosts"
+	FormatDomains = "domains"
+	FormatDnsmasq = "dnsmasq"
+)
+
+// detectSampleLines 是自动识别源格式时检查的规则行数。
+const detectSampleLines = 1000
+
+// localhostNames 是 hosts 文件中常见的本机/回环条目，它们不是屏蔽规则。
+var localhostNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// ConvertSource 将 format 格式的源内容转换为 adblock 语法的行，format 为 auto 时先自动识别格式。
+// 返回实际使用的格式。
+func ConvertSource(format string, content []byte, stripLocalhost bool) ([]string, string) {
+	lines := SplitLines(content)
+	if format == FormatAuto {
+		format = detectFormat(lines)
+	}
+	switch format {
+	case FormatHosts:
+		lines = convertHosts(lines, stripLocalhost)
+	case FormatDnsmasq:
+		lines = convertDnsmasq(lines)
+	case FormatDomains:
+		lines = convertDomains(lines)
+	}
+	return lines, format
+}
+
+// detectFormat 根据前 detectSampleLines 个规则行判断内容的格式，
+// 超过一半的行为 hosts、dnsmasq 或纯域名格式时视为该格式，否则视为 adblock。
+func detectFormat(lines []string) string {
+	var total, hosts, dnsmasq, domains int
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			continue
+		}
+		total++
+		if _, ok := ParseHostsLine(trimmed); ok {
+			hosts++
+		} else if _, _, ok := parseDnsmasqLine(trimmed); ok {
+			dnsmasq++
+		} else if _, ok := parseDomainLine(trimmed); ok {
+			domains++
+		}
+		if total >= detectSampleLines {
+			break
+		}
+	}
+	switch {
+	case total > 0 && hosts*2 > total:
+		return FormatHosts
+	case total > 0 && dnsmasq*2 > total:
+		return FormatDnsmasq
+	case total > 0 && domains*2 > total:
+		return FormatDomains
+	}
+	return FormatAdblock
+}
+
+// convertHosts 将指向黑洞地址（0.0.0.0、127.0.0.1、::、::1 等）的 hosts 行转换为 "||domain^"。
+// 指向其他地址的行是重定向而非屏蔽，保留 hosts 语法交给 AdGuard Home 处理；
+// stripLocalhost 为 true 时去掉 localhost 等本机条目。
+func convertHosts(lines []string, stripLocalhost bool) []string {
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			out = append(out, line)
+			continue
+		}
+		hosts, ok := ParseHostsLine(trimmed)
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		addr := strings.Fields(trimmed)[0]
+		var names []string
+		for _, h := range hosts {
+			h = strings.ToLower(strings.TrimSuffix(h, "."))
+			if stripLocalhost && localhostNames[h] {
+				continue
+			}
+			names = append(names, h)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		if !isSinkholeIP(net.ParseIP(addr)) {
+			out = append(out, addr+" "+strings.Join(names, " "))
+			continue
+		}
+		for _, h := range names {
+			out = append(out, "||"+h+"^")
+		}
+	}
+	return out
+}
+
+// isSinkholeIP 报告 ip 是否为 hosts 屏蔽列表常用的黑洞地址。
+func isSinkholeIP(ip net.IP) bool {
+	return ip.IsUnspecified() || ip.IsLoopback()
+}
+
+// dnsmasqDirectives 是 dnsmasq 配置中按域名生效的指令。
+var dnsmasqDirectives = []string{"address=", "server=", "local="}
+
+// parseDnsmasqLine 解析 "address=/a.com/b.com/0.0.0.0" 形式的指令，返回其中的域名和目标值。
+func parseDnsmasqLine(line string) (domains []string, target string, ok bool) {
+	var directive string
+	for _, d := range dnsmasqDirectives {
+		if strings.HasPrefix(line, d+"/") {
+			directive = d
+			break
+		}
+	}
+	if directive == "" {
+		return nil, "", false
+	}
+	parts := strings.Split(line[len(directive)+1:], "/")
+	if len(parts) < 2 {
+		return nil, "", false
+	}
+	for _, p := range parts[:len(parts)-1] {
+		if p = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(p), ".")); p != "" {
+			domains = append(domains, p)
+		}
+	}
+	if len(domains) == 0 {
+		return nil, "", false
+	}
+	return domains, strings.TrimSpace(parts[len(parts)-1]), true
+}
+
+// convertDnsmasq 将 dnsmasq 指令转换为 adblock 语法：
+// 未指定目标（address/server/local 均表示不解析）以及 address 指向黑洞地址或 "#" 时转换为 "||domain^"；
+// address 指向其他地址时转换为 "$dnsrewrite" 规则；server 指定了上游（包括表示使用默认上游的 "#"）的
+// 转发规则不是拦截，无法表达，直接丢弃。
+func convertDnsmasq(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			out = append(out, line)
+			continue
+		}
+		domains, target, ok := parseDnsmasqLine(trimmed)
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		isAddress := strings.HasPrefix(trimmed, "address=")
+		switch {
+		case target == "" || isAddress && (target == "#" || isSinkholeIP(net.ParseIP(target))):
+			for _, d := range domains {
+				out = append(out, "||"+d+"^")
+			}
+		case isAddress && net.ParseIP(target) != nil:
+			for _, d := range domains {
+				out = append(out, "||"+d+"^$dnsrewrite="+target)
+			}
+		default:
+			logging.Merger.Debug("⚠️ Dropping unsupported dnsmasq directive", "line", trimmed)
+		}
+	}
+	return out
+}
+
+// parseDomainLine 解析纯域名列表中的一行，支持 "*.example.com" 与 ".example.com" 形式的通配符及行尾 # 注释。
+func parseDomainLine(line string) (string, bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	d := strings.TrimSpace(line)
+	d = strings.TrimPrefix(d, "*.")
+	d = strings.TrimPrefix(d, ".")
+	d = strings.ToLower(strings.TrimSuffix(d, "."))
+	if !IsValidHostname(d) || IsIPAddress(d) || !strings.Contains(d, ".") {
+		return "", false
+	}
+	return d, true
+}
+
+// convertDomains 将每行一个域名的列表转换为 "||domain^"，
+// 通配符条目同样转换为 "||domain^"（它本身就覆盖所有子域名），无法识别的行原样保留。
+func convertDomains(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			out = append(out, line)
+			continue
+		}
+		if d, ok := parseDomainLine(trimmed); ok {
+			out = append(out, "||"+d+"^")
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
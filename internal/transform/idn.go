@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// splitDomainPattern 将 "||example.com^" 这类模式拆分为前缀、主机名和后缀。
+// 主机名部分可以包含非 ASCII 字符，不是这种形式时返回 ok=false。
+func splitDomainPattern(pattern string) (prefix, host, suffix string, ok bool) {
+	host = pattern
+	for _, p := range []string{"||", "|"} {
+		if strings.HasPrefix(host, p) {
+			prefix, host = p, host[len(p):]
+			break
+		}
+	}
+	for _, s := range []string{"^|", "^", "|"} {
+		if strings.HasSuffix(host, s) {
+			host, suffix = host[:len(host)-len(s)], s
+			break
+		}
+	}
+	if host == "" || strings.ContainsAny(host, "/*:?&=$|^ ") {
+		return "", "", "", false
+	}
+	return prefix, host, suffix, true
+}
+
+// NormalizeHost 将主机名转换为小写 punycode 并去掉末尾的点，无法转换时返回 ok=false。
+func NormalizeHost(host string) (string, bool) {
+	host = strings.TrimSuffix(host, ".")
+	if isASCII(host) {
+		// 纯 ASCII 的主机名只需小写，也避免 idna 拒绝下划线等 DNS 中实际存在的字符
+		host = strings.ToLower(host)
+		return host, IsValidHostname(host)
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || !IsValidHostname(ascii) {
+		return "", false
+	}
+	return ascii, true
+}
+
+// NormalizeRule 规范化域名规则中的主机名（小写、punycode、去掉末尾的点），
+// 使不同编码的同一规则能够去重。unicode 为该规则的 Unicode 形式，
+// 仅在主机名包含 punycode 标签时非空。非域名规则原样返回。
+func NormalizeRule(line string) (normalized, unicode string) {
+	if IsComment(line) || isCosmetic(line) {
+		return line, ""
+	}
+	r := ParseAdblockRule(line)
+	if IsRegexRule(r.Pattern) {
+		return line, ""
+	}
+	prefix, host, suffix, ok := splitDomainPattern(r.Pattern)
+	if !ok {
+		return line, ""
+	}
+	ascii, ok := NormalizeHost(host)
+	if !ok {
+		return line, ""
+	}
+	r.Pattern = prefix + ascii + suffix
+	normalized = r.String()
+	if strings.Contains(ascii, "xn--") {
+		if u, err := idna.ToUnicode(ascii); err == nil && u != ascii {
+			r.Pattern = prefix + u + suffix
+			unicode = r.String()
+		}
+	}
+	return normalized, unicode
+}
+
+// isASCII 报告 s 是否只包含 ASCII 字符。
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
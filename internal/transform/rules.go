@@ -0,0 +1,212 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cosmeticMarkers 是浏览器专用规则（元素隐藏、CSS、脚本注入、HTML 过滤）的分隔符。
+var cosmeticMarkers = []string{"##", "#@#", "#?#", "#@?#", "#$#", "#@$#", "#%#", "#@%#", "$$", "$@$"}
+
+// IsComment 报告 line 是否为注释行。以 "#" 开头的元素隐藏规则（如 "##.ad"）不算注释。
+func IsComment(line string) bool {
+	if strings.HasPrefix(line, "!") {
+		return true
+	}
+	if !strings.HasPrefix(line, "#") {
+		return false
+	}
+	if strings.HasPrefix(line, "# ") || strings.HasPrefix(line, "####") {
+		return true
+	}
+	return !isCosmetic(line)
+}
+
+// isCosmetic 报告 line 是否为 AdGuard Home 不支持的浏览器专用规则。
+func isCosmetic(line string) bool {
+	for _, marker := range cosmeticMarkers {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRegexRule 报告 pattern 是否为 /regex/ 形式的规则。
+func IsRegexRule(pattern string) bool {
+	return len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// adblockRule 是拆分后的 adblock 语法规则。
+type adblockRule struct {
+	Allow     bool
+	Pattern   string
+	Modifiers []string
+}
+
+// ParseAdblockRule 将规则拆分为例外标记、匹配模式和修饰符。
+func ParseAdblockRule(line string) adblockRule {
+	var r adblockRule
+	if strings.HasPrefix(line, "@@") {
+		r.Allow = true
+		line = line[2:]
+	}
+	r.Pattern = line
+	if IsRegexRule(line) {
+		return r
+	}
+	// 正则规则同样可以带修饰符，如 "/ads[0-9]+/$important"
+	if i := strings.LastIndex(line, "$"); i >= 0 {
+		r.Pattern = line[:i]
+		if mods := line[i+1:]; mods != "" {
+			r.Modifiers = strings.Split(mods, ",")
+		}
+	}
+	return r
+}
+
+// String 将规则重新组装为文本形式。
+func (r adblockRule) String() string {
+	var b strings.Builder
+	if r.Allow {
+		b.WriteString("@@")
+	}
+	b.WriteString(r.Pattern)
+	if len(r.Modifiers) > 0 {
+		b.WriteString("$")
+		b.WriteString(strings.Join(r.Modifiers, ","))
+	}
+	return b.String()
+}
+
+// Domain 在模式为 "||example.com^"、"|example.com^" 或 "example.com" 形式时返回其中的域名。
+func (r adblockRule) Domain() (string, bool) {
+	p := strings.TrimPrefix(r.Pattern, "||")
+	p = strings.TrimPrefix(p, "|")
+	p = strings.TrimSuffix(p, "|")
+	p = strings.TrimSuffix(p, "^")
+	if p == "" || !IsValidHostname(p) {
+		return "", false
+	}
+	return p, true
+}
+
+// DedupeKey 返回用于去重的规则键：修饰符名称不区分大小写、与顺序无关，重复的修饰符只算一次，
+// 因此 "||a.com^$important,client=x" 与 "||a.com^$client=x,important" 视为同一规则，
+// 而 "||a.com^" 与 "||a.com^$important" 仍是不同的规则。
+func DedupeKey(line string) string {
+	r := ParseAdblockRule(line)
+	if len(r.Modifiers) == 0 || isCosmetic(line) {
+		return line
+	}
+	mods := make([]string, 0, len(r.Modifiers))
+	seen := make(map[string]bool, len(r.Modifiers))
+	for _, m := range r.Modifiers {
+		m = strings.TrimSpace(m)
+		if name, value, ok := strings.Cut(m, "="); ok {
+			m = strings.ToLower(name) + "=" + value
+		} else {
+			m = strings.ToLower(m)
+		}
+		if !seen[m] {
+			seen[m] = true
+			mods = append(mods, m)
+		}
+	}
+	sort.Strings(mods)
+	r.Modifiers = mods
+	return r.String()
+}
+
+// ParseHostsLine 解析 /etc/hosts 格式的行，返回 IP 之后的主机名列表。
+func ParseHostsLine(line string) ([]string, bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return nil, false
+	}
+	return fields[1:], true
+}
+
+// IsValidHostname 报告 s 是否为语法合法的主机名。
+func IsValidHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsIPAddress 报告 s 是否为 IPv4/IPv6 地址。
+func IsIPAddress(s string) bool {
+	return net.ParseIP(strings.Trim(s, "[]")) != nil
+}
+
+// IsIPRule 报告 line 是否为只针对 IP 地址或 CIDR 网段的规则，如 "||1.2.3.4^"、"10.0.0.0/8"。
+// DNS 过滤按域名匹配，这类规则不会起作用。
+func IsIPRule(line string) bool {
+	_, ok := IPRuleTarget(line)
+	return ok
+}
+
+// IPRuleTarget 返回 IP 规则针对的地址或网段（规范形式，如 "10.0.0.0/8"），不是 IP 规则时返回 ok=false。
+func IPRuleTarget(line string) (string, bool) {
+	if _, ok := ParseHostsLine(line); ok {
+		return "", false
+	}
+	p := ParseAdblockRule(line).Pattern
+	p = strings.TrimPrefix(p, "||")
+	p = strings.TrimPrefix(p, "|")
+	p = strings.TrimSuffix(p, "|")
+	p = strings.TrimSuffix(p, "^")
+	if addr, err := netip.ParseAddr(strings.Trim(p, "[]")); err == nil {
+		return addr.Unmap().String(), true
+	}
+	if prefix, err := netip.ParsePrefix(p); err == nil {
+		return prefix.Masked().String(), true
+	}
+	return "", false
+}
+
+// isPublicSuffix 报告 domain 本身是否为公共后缀（如 "com"、"co.uk"），
+// 屏蔽这样的域名会误伤整个顶级域。
+func isPublicSuffix(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+// IsRuleLine 报告去除首尾空白后的 line 是否为有效规则（非注释、非空行）。
+func IsRuleLine(line string) bool {
+	return line != "" && !strings.HasPrefix(line, "!") && !strings.HasPrefix(line, "#")
+}
+
+// CountRules 计算文件中的有效规则数量，跳过注释和空行。
+func CountRules(content []byte) int {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	count := 0
+	for scanner.Scan() {
+		if IsRuleLine(strings.TrimSpace(scanner.Text())) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,64 @@
+package transform
+
+import "strings"
+
+// TLDFilterConfig 配置 FilterTlds 转换：exclude 中的顶级域（或 co.uk 这样的多级后缀）的规则会被删除，
+// include 非空时只保留这些顶级域的规则。
+type TLDFilterConfig struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// normalizeTLDs 去掉前导点并转为小写。
+func normalizeTLDs(tlds []string) []string {
+	out := make([]string, 0, len(tlds))
+	for _, t := range tlds {
+		if t = strings.ToLower(strings.Trim(strings.TrimSpace(t), ".")); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// hasTLD 报告 domain 是否属于 tlds 中的任一后缀。
+func hasTLD(domain string, tlds []string) bool {
+	for _, t := range tlds {
+		if domain == t || strings.HasSuffix(domain, "."+t) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTLDs 按顶级域过滤域名规则与 hosts 行；无法确定域名的规则（如正则、通配规则）原样保留。
+func filterTLDs(lines []string, cfg TLDFilterConfig) []string {
+	include, exclude := normalizeTLDs(cfg.Include), normalizeTLDs(cfg.Exclude)
+	if len(include) == 0 && len(exclude) == 0 {
+		return lines
+	}
+	keep := func(domain string) bool {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+		if hasTLD(domain, exclude) {
+			return false
+		}
+		return len(include) == 0 || hasTLD(domain, include)
+	}
+	return FilterLines(lines, func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			return true
+		}
+		if hosts, ok := ParseHostsLine(trimmed); ok {
+			for _, h := range hosts {
+				if !keep(h) {
+					return false
+				}
+			}
+			return true
+		}
+		if d, ok := ParseAdblockRule(trimmed).Domain(); ok {
+			return keep(d)
+		}
+		return true
+	})
+}
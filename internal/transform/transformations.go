@@ -0,0 +1,515 @@
+// Package transform 解析 adblock、hosts、dnsmasq 等格式的规则，并实现可配置的规则转换。
+package transform
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+
+	"adguardlist/internal/logging"
+)
+
+// 转换名称沿用 hostlist-compiler 的命名，已有配置无需修改即可使用。
+const (
+	trRemoveComments     = "RemoveComments"
+	trCompress           = "Compress"
+	TrRemoveModifiers    = "RemoveModifiers"
+	TrValidate           = "Validate"
+	TrValidateAllowIP    = "ValidateAllowIp"
+	trDeduplicate        = "Deduplicate"
+	trInvertAllow        = "InvertAllow"
+	trRemoveEmptyLines   = "RemoveEmptyLines"
+	trTrimLines          = "TrimLines"
+	TrInsertFinalNewLine = "InsertFinalNewLine"
+	trConvertToASCII     = "ConvertToAscii"
+	trDNSOnly            = "DnsOnly"
+	trFilterTLDs         = "FilterTlds"
+	TrRemoveIPRules      = "RemoveIpRules"
+	TrRemoveRegexRules   = "RemoveRegexRules"
+)
+
+// defaultTransformations 是对合并结果统一应用的转换，
+// 与 `hostlist-compiler -i` 快捷模式下的默认行为保持一致。
+var defaultTransformations = []string{
+	trRemoveComments,
+	trDeduplicate,
+	trCompress,
+	TrValidate,
+	trTrimLines,
+	TrInsertFinalNewLine,
+}
+
+// transformationOrder 是转换的固定执行顺序，与配置中列出的顺序无关。
+var transformationOrder = []string{
+	trTrimLines,
+	trRemoveEmptyLines,
+	trRemoveComments,
+	trDNSOnly,
+	TrRemoveIPRules,
+	TrRemoveRegexRules,
+	trFilterTLDs,
+	trConvertToASCII,
+	TrRemoveModifiers,
+	TrValidate,
+	TrValidateAllowIP,
+	trCompress,
+	trDeduplicate,
+	trInvertAllow,
+	TrInsertFinalNewLine,
+}
+
+// transformationFuncs 将转换名称映射到实现。InsertFinalNewLine 在拼接输出时处理，
+// RemoveIpRules 与 RemoveRegexRules 在合并时处理，以便按源统计删除的规则数。
+var transformationFuncs = map[string]func([]string) []string{
+	trTrimLines:        trimLines,
+	trRemoveEmptyLines: removeEmptyLines,
+	trRemoveComments:   removeComments,
+	trDNSOnly:          dnsOnly,
+	trConvertToASCII:   convertToASCII,
+	TrRemoveModifiers:  RemoveModifiers,
+	TrValidate:         func(lines []string) []string { return validateRules(lines, false) },
+	TrValidateAllowIP:  func(lines []string) []string { return validateRules(lines, true) },
+	trCompress:         compressRules,
+	trDeduplicate:      deduplicate,
+	trInvertAllow:      invertAllow,
+}
+
+// configurableTransformations 是需要读取配置的转换。
+var configurableTransformations = map[string]func([]string, *Config) []string{
+	trFilterTLDs: func(lines []string, cfg *Config) []string { return filterTLDs(lines, cfg.TLDFilter) },
+}
+
+// Known 是全部支持的转换名称。
+var Known = func() map[string]bool {
+	known := make(map[string]bool, len(transformationOrder))
+	for _, name := range transformationOrder {
+		known[name] = true
+	}
+	return known
+}()
+
+// supportedModifiers 是 AdGuard Home DNS 过滤支持的规则修饰符。
+var supportedModifiers = map[string]bool{
+	"important":  true,
+	"badfilter":  true,
+	"ctag":       true,
+	"dnstype":    true,
+	"dnsrewrite": true,
+	"denyallow":  true,
+	"client":     true,
+}
+
+// removableModifiers 是 RemoveModifiers 会去掉的浏览器专用修饰符。
+var removableModifiers = map[string]bool{
+	"third-party": true,
+	"3p":          true,
+	"document":    true,
+	"doc":         true,
+	"all":         true,
+	"popup":       true,
+	"network":     true,
+}
+
+// JoinLines 将各行拼接为文件内容，finalNewline 为 true 时在非空内容末尾追加换行符。
+func JoinLines(lines []string, finalNewline bool) []byte {
+	out := strings.Join(lines, "\n")
+	if out != "" && finalNewline {
+		out += "\n"
+	}
+	return []byte(out)
+}
+
+// Config 控制规则源的格式转换与对规则应用的转换。Transformations 对合并结果统一应用，
+// 源上配置的 transformations 在合并前只对该源应用。
+type Config struct {
+	StripLocalhost  bool            `yaml:"strip_localhost"`
+	Transformations []string        `yaml:"transformations"`
+	TLDFilter       TLDFilterConfig `yaml:"tld_filter"`
+}
+
+// DefaultConfig 返回转换的默认配置。
+func DefaultConfig() Config {
+	return Config{StripLocalhost: true, Transformations: defaultTransformations}
+}
+
+// Check 检查转换名称是否都受支持。
+func (c *Config) Check() error {
+	for _, t := range c.Transformations {
+		if !Known[t] {
+			return fmt.Errorf("unknown transformation %q", t)
+		}
+	}
+	return nil
+}
+
+// Apply 按 transformationOrder 的顺序应用 names 中启用的转换。
+func Apply(lines []string, names []string, cfg *Config) []string {
+	for _, name := range transformationOrder {
+		if !slices.Contains(names, name) {
+			continue
+		}
+		if fn := transformationFuncs[name]; fn != nil {
+			lines = fn(lines)
+		} else if fn := configurableTransformations[name]; fn != nil {
+			lines = fn(lines, cfg)
+		}
+	}
+	return lines
+}
+
+// SplitLines 将内容按行拆分，兼容 CRLF 换行，忽略末尾换行符产生的空行。
+func SplitLines(content []byte) []string {
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// RemoveStrings 返回去掉 remove 中各项后的新列表。
+func RemoveStrings(list []string, remove ...string) []string {
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if !slices.Contains(remove, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// FilterLines 返回 keep 判定为 true 的行。
+func FilterLines(lines []string, keep func(string) bool) []string {
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if keep(line) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func trimLines(lines []string) []string {
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return lines
+}
+
+func removeEmptyLines(lines []string) []string {
+	return FilterLines(lines, func(line string) bool {
+		return strings.TrimSpace(line) != ""
+	})
+}
+
+func removeComments(lines []string) []string {
+	return FilterLines(lines, func(line string) bool {
+		return !IsComment(strings.TrimSpace(line))
+	})
+}
+
+// convertToASCII 将规则中的国际化域名转换为 punycode。
+func convertToASCII(lines []string) []string {
+	for i, line := range lines {
+		lines[i] = ToASCIIRule(line)
+	}
+	return lines
+}
+
+// ToASCIIRule 对规则中每段包含非 ASCII 字符的主机名执行 punycode 转换，
+// 分隔符（如 "||"、"^"、"$"）保持不变。
+func ToASCIIRule(line string) string {
+	ascii := true
+	for _, c := range line {
+		if c > unicode.MaxASCII {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return line
+	}
+
+	isSeparator := func(c rune) bool {
+		return unicode.IsSpace(c) || strings.ContainsRune("|^$,/=@*:", c)
+	}
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		token := line[start:end]
+		if converted, err := idna.ToASCII(token); err == nil {
+			token = converted
+		}
+		b.WriteString(token)
+		start = -1
+	}
+	for i, c := range line {
+		if isSeparator(c) {
+			flush(i)
+			b.WriteRune(c)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	flush(len(line))
+	return b.String()
+}
+
+// dnsOnly 只保留 DNS 过滤可用的规则，去掉元素隐藏、脚本注入等浏览器专用规则，
+// 带有 AdGuard Home 不支持的修饰符的规则，以及匹配 URL 路径的规则。注释与空行原样保留。
+func dnsOnly(lines []string) []string {
+	return FilterLines(lines, func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			return true
+		}
+		if isCosmetic(trimmed) {
+			return false
+		}
+		if _, ok := ParseHostsLine(trimmed); ok {
+			return true
+		}
+		r := ParseAdblockRule(trimmed)
+		for _, m := range r.Modifiers {
+			name, _, _ := strings.Cut(strings.ToLower(strings.TrimPrefix(m, "~")), "=")
+			if !supportedModifiers[name] && !removableModifiers[name] {
+				return false
+			}
+		}
+		if IsRegexRule(r.Pattern) {
+			return true
+		}
+		// DNS 查询中没有路径，带路径的规则永远不会匹配
+		pattern := r.Pattern
+		if i := strings.Index(pattern, "://"); i >= 0 {
+			pattern = pattern[i+3:]
+		}
+		return !strings.Contains(pattern, "/")
+	})
+}
+
+// RemoveModifiers 去掉 AdGuard Home 不需要的浏览器专用修饰符。
+func RemoveModifiers(lines []string) []string {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			continue
+		}
+		if _, ok := ParseHostsLine(trimmed); ok {
+			continue
+		}
+		r := ParseAdblockRule(trimmed)
+		if len(r.Modifiers) == 0 {
+			continue
+		}
+		kept := r.Modifiers[:0]
+		for _, m := range r.Modifiers {
+			if !removableModifiers[strings.ToLower(strings.TrimPrefix(m, "~"))] {
+				kept = append(kept, m)
+			}
+		}
+		r.Modifiers = kept
+		lines[i] = r.String()
+	}
+	return lines
+}
+
+// validateRules 去掉 AdGuard Home 无法处理或过于宽泛的规则，注释与空行原样保留。
+func validateRules(lines []string, allowIP bool) []string {
+	return FilterLines(lines, func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		return trimmed == "" || IsComment(trimmed) || IsValidRule(trimmed, allowIP)
+	})
+}
+
+// IsValidRule 报告 line 是否为 AdGuard Home 可用的 DNS 过滤规则。
+func IsValidRule(line string, allowIP bool) bool {
+	return RuleRejection(line, allowIP) == ""
+}
+
+// RuleRejection 返回 line 不是 AdGuard Home 可用的 DNS 过滤规则的原因，规则有效时返回空字符串。
+func RuleRejection(line string, allowIP bool) string {
+	if isCosmetic(line) {
+		return "cosmetic rule is not supported by DNS filtering"
+	}
+	if hosts, ok := ParseHostsLine(line); ok {
+		for _, h := range hosts {
+			if !IsValidHostname(h) {
+				return fmt.Sprintf("invalid hostname %q in hosts rule", h)
+			}
+			if isPublicSuffix(h) {
+				return fmt.Sprintf("hosts rule blocks public suffix %q", h)
+			}
+		}
+		return ""
+	}
+
+	r := ParseAdblockRule(line)
+	for _, m := range r.Modifiers {
+		name, _, _ := strings.Cut(strings.TrimPrefix(m, "~"), "=")
+		if !supportedModifiers[strings.ToLower(name)] {
+			return fmt.Sprintf("unsupported modifier $%s", name)
+		}
+	}
+	if IsRegexRule(r.Pattern) {
+		return ""
+	}
+	for _, c := range r.Pattern {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune(".-_*|^:/", c)) {
+			return fmt.Sprintf("invalid character %q in pattern", c)
+		}
+	}
+	// 只由通配符和分隔符组成的模式会匹配所有域名
+	if strings.Trim(r.Pattern, "|^*.:/") == "" {
+		return "pattern matches every domain"
+	}
+	if d, ok := r.Domain(); ok {
+		if IsIPAddress(d) && !allowIP {
+			return "IP address rule (enable ValidateAllowIp to keep)"
+		}
+		if !IsIPAddress(d) && isPublicSuffix(d) {
+			return fmt.Sprintf("rule blocks public suffix %q", d)
+		}
+	}
+	return ""
+}
+
+// compressRules 将 hosts 与纯域名规则转换为 "||domain^"，
+// 并去掉已被父域名规则覆盖的子域名规则。
+func compressRules(lines []string) []string {
+	converted := make([]string, 0, len(lines))
+	blocked := make(map[string]bool)
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			converted = append(converted, line)
+			continue
+		}
+		domains := compressedDomains(trimmed)
+		if domains == nil {
+			converted = append(converted, line)
+			continue
+		}
+		for _, d := range domains {
+			converted = append(converted, "||"+d+"^")
+			blocked[d] = true
+		}
+	}
+
+	out := make([]string, 0, len(converted))
+	for _, line := range converted {
+		if d, ok := SimpleBlockedDomain(line); ok && HasBlockedParent(d, blocked) {
+			continue
+		}
+		out = append(out, line)
+	}
+	logging.Compiler.Debug("🗜️ Compress removed subdomain rules covered by parent domain rules", "count", len(converted)-len(out))
+	return out
+}
+
+// compressedDomains 返回 Compress 将 line 转换为 "||domain^" 时的域名：hosts 行中的全部主机名、
+// 纯域名或不带修饰符的 "||domain^" 规则中的域名。其他规则返回 nil，由 Compress 原样保留。
+func compressedDomains(line string) []string {
+	if hosts, ok := ParseHostsLine(line); ok {
+		domains := make([]string, len(hosts))
+		for i, h := range hosts {
+			domains[i] = strings.ToLower(strings.TrimSuffix(h, "."))
+		}
+		return domains
+	}
+	d, ok := SimpleBlockedDomain(line)
+	if !ok && IsValidHostname(line) && !IsIPAddress(line) {
+		d, ok = strings.ToLower(strings.TrimSuffix(line, ".")), true
+	}
+	if !ok {
+		return nil
+	}
+	return []string{d}
+}
+
+// GlobalForms 返回规则 line 经过全局转换 names 中逐行改写规则的 RemoveModifiers 与 Compress 后
+// 在输出中的形式，一行 hosts 规则可能对应多条规则。编译时按这些形式记录规则的来源与分类，
+// 使输出中的规则能够查到；Compress 删除被上级域名覆盖的规则等整体的处理不在此体现。
+func GlobalForms(line string, names []string) []string {
+	if slices.Contains(names, TrRemoveModifiers) {
+		line = RemoveModifiers([]string{line})[0]
+	}
+	if !slices.Contains(names, trCompress) {
+		return []string{line}
+	}
+	domains := compressedDomains(line)
+	if domains == nil {
+		return []string{line}
+	}
+	forms := make([]string, len(domains))
+	for i, d := range domains {
+		forms[i] = "||" + d + "^"
+	}
+	return forms
+}
+
+// SimpleBlockedDomain 在 line 为不带修饰符的 "||domain^" 规则时返回小写域名。
+func SimpleBlockedDomain(line string) (string, bool) {
+	if !strings.HasPrefix(line, "||") || !strings.HasSuffix(line, "^") {
+		return "", false
+	}
+	d := line[2 : len(line)-1]
+	if !IsValidHostname(d) {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimSuffix(d, ".")), true
+}
+
+// HasBlockedParent 报告 domain 的任一上级域名是否已在 blocked 中。
+// 根据公共后缀列表只检查到可注册域名（如 example.co.uk）为止，公共后缀本身不算上级域名。
+func HasBlockedParent(domain string, blocked map[string]bool) bool {
+	full := domain
+	for i := strings.Index(domain, "."); i >= 0; i = strings.Index(domain, ".") {
+		domain = domain[i+1:]
+		if blocked[domain] {
+			// 只在命中时查询公共后缀列表，大部分规则没有被屏蔽的上级域名
+			suffix, _ := publicsuffix.PublicSuffix(full)
+			return len(domain) > len(suffix)
+		}
+	}
+	return false
+}
+
+// deduplicate 去掉重复的规则，保留首次出现的位置，注释与空行不参与去重。
+// 只是修饰符顺序或大小写不同的规则视为重复，见 DedupeKey。
+func deduplicate(lines []string) []string {
+	seen := make(map[string]bool, len(lines))
+	return FilterLines(lines, func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) {
+			return true
+		}
+		key := DedupeKey(trimmed)
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	})
+}
+
+// invertAllow 将屏蔽规则转换为例外规则。
+func invertAllow(lines []string) []string {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || IsComment(trimmed) || strings.HasPrefix(trimmed, "@@") {
+			continue
+		}
+		if _, ok := ParseHostsLine(trimmed); ok {
+			continue
+		}
+		lines[i] = "@@" + trimmed
+	}
+	return lines
+}
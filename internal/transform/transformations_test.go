@@ -0,0 +1,219 @@
+package transform
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompressRules(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{
+			name: "hosts and plain domains become domain rules",
+			in:   []string{"0.0.0.0 ads.example.com", "127.0.0.1 a.example.org b.example.org", "Tracker.Example.NET."},
+			want: []string{"||ads.example.com^", "||a.example.org^", "||b.example.org^", "||tracker.example.net^"},
+		},
+		{
+			name: "subdomains covered by a parent rule are folded",
+			in:   []string{"||ads.example.com^", "||example.com^", "sub.ads.example.com", "0.0.0.0 cdn.example.com"},
+			want: []string{"||example.com^"},
+		},
+		{
+			name: "public suffix is not a parent",
+			in:   []string{"||co.uk^", "||example.co.uk^"},
+			want: []string{"||co.uk^", "||example.co.uk^"},
+		},
+		{
+			name: "rules with modifiers and exceptions are kept",
+			in:   []string{"||example.com^", "||ads.example.com^$important", "@@||cdn.example.com^", "||example.org^$important", "||ads.example.org^"},
+			want: []string{"||example.com^", "||ads.example.com^$important", "@@||cdn.example.com^", "||example.org^$important", "||ads.example.org^"},
+		},
+		{
+			name: "comments, regex and IP addresses are untouched",
+			in:   []string{"! comment", "", "/ads[0-9]+\\.example\\.com/", "1.2.3.4"},
+			want: []string{"! comment", "", "/ads[0-9]+\\.example\\.com/", "1.2.3.4"},
+		},
+		{
+			name: "domain rules are lowercased",
+			in:   []string{"||EXAMPLE.com^", "||Ads.Example.COM.^"},
+			want: []string{"||example.com^"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compressRules(slices.Clone(tt.in)); !slices.Equal(got, tt.want) {
+				t.Errorf("compressRules(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleRejection(t *testing.T) {
+	tests := []struct {
+		line    string
+		allowIP bool
+		want    string
+	}{
+		{"||example.com^", false, ""},
+		{"@@||example.com^$client=192.168.1.2", false, ""},
+		{"||example.com^$important,dnstype=AAAA", false, ""},
+		{"||ads*.example.com^", false, ""},
+		{"/ads[0-9]+\\.example\\.com/", false, ""},
+		{"0.0.0.0 ads.example.com", false, ""},
+		{"example.com##.banner", false, "cosmetic rule is not supported by DNS filtering"},
+		{"||example.com^$third-party", false, "unsupported modifier $third-party"},
+		{"||example.com^$~Script", false, "unsupported modifier $Script"},
+		{"||exa mple.com^", false, "invalid character ' ' in pattern"},
+		{"||*^", false, "pattern matches every domain"},
+		{"||com^", false, `rule blocks public suffix "com"`},
+		{"||1.2.3.4^", false, "IP address rule (enable ValidateAllowIp to keep)"},
+		{"||1.2.3.4^", true, ""},
+		{"0.0.0.0 co.uk", false, `hosts rule blocks public suffix "co.uk"`},
+		{"0.0.0.0 bad!host", false, `invalid hostname "bad!host" in hosts rule`},
+	}
+	for _, tt := range tests {
+		if got := RuleRejection(tt.line, tt.allowIP); got != tt.want {
+			t.Errorf("RuleRejection(%q, %v) = %q, want %q", tt.line, tt.allowIP, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	in := []string{"! comment", "", "||example.com^", "example.com##.banner", "||com^", "||1.2.3.4^", "||example.org^$dnsrewrite=1.2.3.4"}
+	tests := []struct {
+		allowIP bool
+		want    []string
+	}{
+		{false, []string{"! comment", "", "||example.com^", "||example.org^$dnsrewrite=1.2.3.4"}},
+		{true, []string{"! comment", "", "||example.com^", "||1.2.3.4^", "||example.org^$dnsrewrite=1.2.3.4"}},
+	}
+	for _, tt := range tests {
+		if got := validateRules(slices.Clone(in), tt.allowIP); !slices.Equal(got, tt.want) {
+			t.Errorf("validateRules(allowIP=%v) = %q, want %q", tt.allowIP, got, tt.want)
+		}
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	in := []string{
+		"||a.com^$important,client=x",
+		"||a.com^",
+		"! comment",
+		"||a.com^$client=x,important",
+		"||a.com^$CLIENT=x,Important,important",
+		"! comment",
+		"",
+		"",
+		"||a.com^",
+		"||a.com^$client=X,important",
+	}
+	want := []string{
+		"||a.com^$important,client=x",
+		"||a.com^",
+		"! comment",
+		"! comment",
+		"",
+		"",
+		"||a.com^$client=X,important",
+	}
+	if got := deduplicate(in); !slices.Equal(got, want) {
+		t.Errorf("deduplicate() = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveComments(t *testing.T) {
+	in := []string{"! comment", "# comment", "#comment", "#### header", "  ! indented", "||a.com^", "##.banner", "example.com#@#.ad", ""}
+	want := []string{"||a.com^", "##.banner", "example.com#@#.ad", ""}
+	if got := removeComments(in); !slices.Equal(got, want) {
+		t.Errorf("removeComments() = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveModifiers(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"||a.com^$third-party", "||a.com^"},
+		{"||a.com^$third-party,important", "||a.com^$important"},
+		{"||a.com^$~3p,doc,all", "||a.com^"},
+		{"@@||a.com^$document", "@@||a.com^"},
+		{"||a.com^$Popup,dnstype=A", "||a.com^$dnstype=A"},
+		{"||a.com^$script", "||a.com^$script"},
+		{"/ads[0-9]+/$network", "/ads[0-9]+/"},
+		{"0.0.0.0 a.com", "0.0.0.0 a.com"},
+		{"! comment $third-party", "! comment $third-party"},
+	}
+	for _, tt := range tests {
+		if got := RemoveModifiers([]string{tt.in})[0]; got != tt.want {
+			t.Errorf("RemoveModifiers(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConvertDnsmasq(t *testing.T) {
+	in := []string{
+		"address=/ads.example.com/0.0.0.0",
+		"address=/hash.example.com/#",
+		"address=/rewrite.example.com/192.168.1.10",
+		"server=/local.example.com/",
+		"local=/lan.example.com/",
+		"server=/default.example.com/#",
+		"server=/upstream.example.com/1.1.1.1",
+		"server=/zero.example.com/0.0.0.0",
+	}
+	want := []string{
+		"||ads.example.com^",
+		"||hash.example.com^",
+		"||rewrite.example.com^$dnsrewrite=192.168.1.10",
+		"||local.example.com^",
+		"||lan.example.com^",
+	}
+	if got := convertDnsmasq(in); !slices.Equal(got, want) {
+		t.Errorf("convertDnsmasq() = %q, want %q", got, want)
+	}
+}
+
+func TestGlobalForms(t *testing.T) {
+	withBoth := []string{trRemoveComments, TrRemoveModifiers, trCompress}
+	tests := []struct {
+		line  string
+		names []string
+		want  []string
+	}{
+		{"Plain.Example.com", withBoth, []string{"||plain.example.com^"}},
+		{"0.0.0.0 a.example.com b.example.com", withBoth, []string{"||a.example.com^", "||b.example.com^"}},
+		{"||a.example.com^$third-party", withBoth, []string{"||a.example.com^"}},
+		{"||a.example.com^$important", withBoth, []string{"||a.example.com^$important"}},
+		{"@@||a.example.com^", withBoth, []string{"@@||a.example.com^"}},
+		{"plain.example.com", []string{trRemoveComments}, []string{"plain.example.com"}},
+		{"||a.example.com^$third-party", []string{trCompress}, []string{"||a.example.com^$third-party"}},
+	}
+	for _, tt := range tests {
+		if got := GlobalForms(tt.line, tt.names); !slices.Equal(got, tt.want) {
+			t.Errorf("GlobalForms(%q, %q) = %q, want %q", tt.line, tt.names, got, tt.want)
+		}
+	}
+}
+
+// 默认的转换组合：删除注释，hosts 规则压缩后与已有规则去重，子域名规则被折叠，无效规则被删除。
+func TestApplyDefaultTransformations(t *testing.T) {
+	in := []string{
+		"! Title: test",
+		"  ||example.com^  ",
+		"||ads.example.com^",
+		"0.0.0.0 tracker.example.org",
+		"||tracker.example.org^",
+		"example.com##.banner",
+		"||example.net^$third-party",
+		"||example.net^$important",
+		"",
+	}
+	want := []string{"||example.com^", "||tracker.example.org^", "||example.net^$important", ""}
+	cfg := DefaultConfig()
+	if got := Apply(in, cfg.Transformations, &cfg); !slices.Equal(got, want) {
+		t.Errorf("Apply(default) = %q, want %q", got, want)
+	}
+}
@@ -1,260 +1,163 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"flag"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
-	"sync"
-	"time"
-)
+	"os/signal"
+	"syscall"
 
-const (
-	rulesFile         = "setting/rules.txt"
-	outputDir         = "rules"
-	publishDir        = "publish"
-	outputFile        = "output.txt"
-	tempMergedFile    = "merged_rules.txt"
-	tempCompiledFile  = "compiled_rules.txt"
-	maxConcurrentJobs = 8
-	downloadTimeout   = 45 * time.Second
+	"adguardlist/internal/download"
+	"adguardlist/internal/logging"
 )
 
-// downloadResult 保存了下载任务的内容和可能发生的错误。
-type downloadResult struct {
-	url     string
-	content []byte
-	err     error
+// command 描述一个子命令。
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, cfg *Config, args []string) error
 }
 
-// readLines 将整个文件读入内存，并返回一个字符串切片。
-func readLines(path string) ([]string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			lines = append(lines, line)
-		}
-	}
-	return lines, scanner.Err()
+// commands 是所有可用的子命令，未指定子命令时默认执行 build。
+var commands = []command{
+	{"build", "download, compile and publish the rules list", cmdBuild},
+	{"validate", "check the config and source list without building", cmdValidate},
+	{"diff", "compare two rules lists (files or urls)", cmdDiff},
+	{"stats", "print statistics of a rules list file", cmdStats},
+	{"serve", "serve the publish directory over HTTP, optionally rebuilding periodically", cmdServe},
+	{"quarantine", "list or release sources quarantined after repeated failures", cmdQuarantine},
+	{"sources", "show the download health of each source (sources status)", cmdSources},
 }
 
-// downloadWorker 是一个工作协程，它从 jobs 通道接收 URL，
-// 下载后将结果发送到 results 通道。
-func downloadWorker(id int, jobs <-chan string, results chan<- downloadResult, wg *sync.WaitGroup) {
-	defer wg.Done()
-	client := &http.Client{
-		Timeout: downloadTimeout,
+// quiet 为 true 时只输出错误日志与构建结束时的摘要，由 -quiet 设置。
+var quiet bool
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [global flags] <command> [command flags]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
 	}
-	for url := range jobs {
-		log.Printf("[Worker %d] Downloading %s\n", id, url)
-		var result downloadResult
-		result.url = url
+	fmt.Fprintln(out, "\nGlobal flags:")
+	flag.PrintDefaults()
+}
 
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			result.err = fmt.Errorf("failed to create request: %w", err)
-			results <- result
-			continue
+func main() {
+	configPath := flag.String("config", defaultConfigFile, "path to the YAML config file")
+	outputDir := flag.String("output", "", "override output_dir from the config file")
+	jobs := flag.Int("jobs", 0, "override max_concurrent_jobs from the config file")
+	offline := flag.Bool("offline", false, "build only from the download cache without network access")
+	logFormat := flag.String("log-format", "", "override logging.format from the config file (text or json)")
+	logLevel := flag.String("log-level", "", "override logging.level from the config file (debug, info, warn or error)")
+	verbose := flag.Bool("v", false, "enable verbose logging, same as -log-level debug")
+	flag.BoolVar(&quiet, "quiet", false, "only log errors and print a summary when the build finishes")
+	flag.Usage = usage
+	flag.Parse()
+
+	// 加载配置前先按命令行参数设置日志，配置文件的错误也能以指定的格式输出
+	logSettings := func(lc logging.Config) logging.Config {
+		if *logFormat != "" {
+			lc.Format = *logFormat
 		}
-		req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; AdRulesBot-Go/1.0)")
-
-		resp, err := client.Do(req)
-		if err != nil {
-			result.err = fmt.Errorf("http request failed: %w", err)
-			results <- result
-			continue
+		if *logLevel != "" {
+			lc.Level = *logLevel
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			result.err = fmt.Errorf("bad status: %s", resp.Status)
-			results <- result
-			resp.Body.Close()
-			continue
+		if *verbose {
+			lc.Level = "debug"
 		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			result.err = fmt.Errorf("failed to read body: %w", err)
-			results <- result
-			continue
-		}
-
-		if len(body) == 0 {
-			result.err = fmt.Errorf("downloaded file is empty")
-			results <- result
-			continue
+		if quiet {
+			lc.Level = "error"
 		}
-
-		result.content = body
-		results <- result
+		return lc
 	}
-}
-
-// countRules 计算文件中的有效规则数量，跳过注释和空行。
-func countRules(content []byte) int {
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	count := 0
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "!") && !strings.HasPrefix(line, "#") {
-			count++
+	// 在终端中运行时显示下载进度，日志经由进度显示输出以免与进度行交错
+	var logOutput io.Writer = os.Stderr
+	if !quiet {
+		if download.Progress = download.NewProgress(os.Stderr); download.Progress != nil {
+			logOutput = download.Progress
 		}
 	}
-	return count
-}
-
-func main() {
-	log.Println("🚀 Starting AdGuard rules processing with Go...")
-
-	// 1. 从规则文件中读取 URL
-	urls, err := readLines(rulesFile)
-	if err != nil {
-		log.Fatalf("❌ Failed to read rules file '%s': %v", rulesFile, err)
+	if err := logging.Setup(logOutput, logSettings(defaultConfig().Logging)); err != nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "%v\n\n", err)
+		usage()
+		os.Exit(2)
 	}
-	totalSources := len(urls)
-	log.Printf("ℹ️ Found %d rule sources in '%s'.", totalSources, rulesFile)
-
-	// 2. 并发下载所有规则
-	jobs := make(chan string, totalSources)
-	results := make(chan downloadResult, totalSources)
-	var wg sync.WaitGroup
 
-	for i := 1; i <= maxConcurrentJobs; i++ {
-		wg.Add(1)
-		go downloadWorker(i, jobs, results, &wg)
+	name, args := "build", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
 	}
-
-	for _, url := range urls {
-		jobs <- url
-	}
-	close(jobs)
-
-	var successfulDownloads [][]byte
-	var failedDownloads []string
-	for i := 0; i < totalSources; i++ {
-		res := <-results
-		if res.err != nil {
-			log.Printf("❌ Download failed for %s: %v", res.url, res.err)
-			failedDownloads = append(failedDownloads, res.url)
-		} else {
-			log.Printf("✅ Downloaded %s (%d bytes)", res.url, len(res.content))
-			successfulDownloads = append(successfulDownloads, res.content)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
 		}
 	}
-	wg.Wait() // 等待所有 worker 完成
-
-	successCount := len(successfulDownloads)
-	failedCount := len(failedDownloads)
-	log.Printf("📊 Download summary: %d successful, %d failed.", successCount, failedCount)
-
-	if successCount == 0 {
-		log.Fatal("❌ No rules were downloaded successfully. Aborting.")
+	if cmd == nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
 	}
 
-	// 3. 合并已下载的规则
-	log.Println("🔄 Merging downloaded rules...")
-	mergedContent := bytes.Join(successfulDownloads, []byte("\n"))
-	if err := os.WriteFile(tempMergedFile, mergedContent, 0644); err != nil {
-		log.Fatalf("❌ Failed to write merged rules to '%s': %v", tempMergedFile, err)
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatal("❌ Failed to load config", "path", *configPath, "error", err)
 	}
-	defer os.Remove(tempMergedFile)
-
-	// 4. 运行 hostlist-compiler
-	log.Println("⚙️ Compiling rules with hostlist-compiler...")
-	cmd := exec.Command("hostlist-compiler", "-i", tempMergedFile, "-o", tempCompiledFile)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("❌ hostlist-compiler failed: %v", err)
+	if err := logging.Setup(logOutput, logSettings(cfg.Logging)); err != nil {
+		fatal("❌ Invalid logging settings", "error", err)
 	}
-	defer os.Remove(tempCompiledFile)
-
-	compiledContent, err := os.ReadFile(tempCompiledFile)
-	if err != nil {
-		log.Fatalf("❌ Failed to read compiled file '%s': %v", tempCompiledFile, err)
+	if *outputDir != "" {
+		cfg.Output.OutputDir = *outputDir
 	}
-
-	// 5. 生成最终的输出文件
-	log.Println("📝 Generating final output file...")
-	ruleCount := countRules(compiledContent)
-	buildTime := time.Now().Format(time.RFC3339)
-
-	var header bytes.Buffer
-	header.WriteString("# Title: 5whys Adguard Home Rules List (Use with a lot of false rejects)\n")
-	header.WriteString(fmt.Sprintf("# Version: %s\n", time.Now().Format("200601021504")))
-	header.WriteString(fmt.Sprintf("# Generated: %s\n", buildTime))
-	header.WriteString("# Expires: 12 hours\n")
-	header.WriteString(fmt.Sprintf("# Total sources: %d (Success: %d, Failed: %d)\n", totalSources, successCount, failedCount))
-	header.WriteString(fmt.Sprintf("# Total rules: %d\n", ruleCount))
-	header.WriteString(fmt.Sprintf("# Homepage: https://github.com/%s\n", os.Getenv("GITHUB_REPOSITORY")))
-	header.WriteString("#\n")
-	header.WriteString("# Source URLs:\n")
-	for _, url := range urls {
-		header.WriteString(fmt.Sprintf("# - %s\n", url))
+	if *jobs < 0 {
+		fatal("❌ -jobs must be positive", "jobs", *jobs)
 	}
-	header.WriteString("#\n")
-	header.WriteString("####################################################################################\n\n")
-
-	finalContent := append(header.Bytes(), compiledContent...)
-
-	// 6. 创建目录并写入文件
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Fatalf("❌ Failed to create output directory '%s': %v", outputDir, err)
+	if *jobs > 0 {
+		cfg.Download.MaxConcurrentJobs = *jobs
 	}
-	if err := os.MkdirAll(publishDir, 0755); err != nil {
-		log.Fatalf("❌ Failed to create publish directory '%s': %v", publishDir, err)
+	if *offline {
+		cfg.Download.Offline = true
+		if err := cfg.validate(); err != nil {
+			fatal("❌ Invalid config", "error", err)
+		}
 	}
 
-	outputFilePath := filepath.Join(outputDir, outputFile)
-	publishFilePath := filepath.Join(publishDir, outputFile)
+	// Ctrl-C 或 SIGTERM 会取消正在进行的下载和 Git 操作
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err := os.WriteFile(outputFilePath, finalContent, 0644); err != nil {
-		log.Fatalf("❌ Failed to write final output to '%s': %v", outputFilePath, err)
+	if err := cmd.run(ctx, cfg, args); err != nil {
+		stop()
+		fatal("❌ Command failed", "command", cmd.name, "error", err)
 	}
-	log.Printf("✅ Wrote output to %s", outputFilePath)
+}
 
-	// 拷贝到 publish 目录
-	if err := os.WriteFile(publishFilePath, finalContent, 0644); err != nil {
-		log.Fatalf("❌ Failed to copy output to '%s': %v", publishFilePath, err)
+// newFlagSet 创建子命令使用的 FlagSet，并生成统一格式的帮助信息。
+func newFlagSet(name, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [global flags] %s [flags] %s\n", os.Args[0], name, argsUsage)
+		fs.PrintDefaults()
 	}
-	log.Printf("✅ Copied output to %s", publishFilePath)
+	return fs
+}
 
-	// 为后续步骤设置 GITHUB_ENV
-	githubEnvFile := os.Getenv("GITHUB_ENV")
-	if githubEnvFile != "" {
-		f, err := os.OpenFile(githubEnvFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("⚠️ Could not open GITHUB_ENV file: %v", err)
-		} else {
-			defer f.Close()
-			envVars := map[string]int{
-				"RULES_COUNT":   ruleCount,
-				"SUCCESS_COUNT": successCount,
-				"FAILED_COUNT":  failedCount,
-				"TOTAL_COUNT":   totalSources,
-			}
-			for key, val := range envVars {
-				if _, err := f.WriteString(fmt.Sprintf("%s=%d\n", key, val)); err != nil {
-					log.Printf("⚠️ Failed to write %s to GITHUB_ENV: %v", key, err)
-				}
-			}
-		}
+func cmdBuild(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("build", "")
+	force := fs.Bool("force", false, "publish even if the list shrank by more than max_shrink_percent")
+	fs.Parse(args)
+	if *force {
+		cfg.MaxShrinkPercent = 0
 	}
+	return runBuild(ctx, cfg)
+}
 
-	log.Println("✅ All tasks completed successfully.")
+// fatal 记录错误级别的日志后以状态码 1 退出。
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
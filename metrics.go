@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// MetricsConfig 控制 Prometheus 指标：serve 命令在 Path 上提供最近一次构建的指标，
+// 设置 PushgatewayURL 时每次构建结束后推送到 Pushgateway。
+type MetricsConfig struct {
+	Path           string `yaml:"path"`
+	PushgatewayURL string `yaml:"pushgateway_url"`
+	Job            string `yaml:"job"`
+}
+
+// metricsPushTimeout 是推送到 Pushgateway 的超时时间。
+const metricsPushTimeout = 30 * time.Second
+
+// buildMetrics 保存最近一次构建的结果与进程内累计的计数，serve 的定时构建与 HTTP 请求会并发访问。
+type buildMetrics struct {
+	mu             sync.Mutex
+	builds         map[string]int // 以 success/failure 为键的构建次数
+	sourceFailures map[string]int // 以源名称为键的下载失败次数（回退到缓存的也计入）
+	last           *metricsSnapshot
+}
+
+// metricsSnapshot 是一次构建中用于生成指标的数据，不保留列表内容。
+type metricsSnapshot struct {
+	success  bool
+	finished time.Time
+	duration time.Duration
+	rules    int
+	sources  []reportSource
+	timings  []output.StageTiming
+}
+
+// metrics 是进程内的构建指标。
+var metrics = &buildMetrics{builds: map[string]int{}, sourceFailures: map[string]int{}}
+
+// record 记录一次构建的结果。
+func (m *buildMetrics) record(res *output.Result, started time.Time, buildErr error) {
+	snap := &metricsSnapshot{
+		success:  buildErr == nil,
+		finished: time.Now(),
+		duration: time.Since(started),
+		rules:    res.RuleCount,
+		sources:  reportSources(res),
+		timings:  append([]output.StageTiming(nil), res.Timings...),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if snap.success {
+		m.builds["success"]++
+	} else {
+		m.builds["failure"]++
+	}
+	for _, s := range snap.sources {
+		// 没有失败过的源也输出 0，便于用 increase() 告警
+		n := m.sourceFailures[s.Name]
+		if s.Status != "ok" && s.Error != "" {
+			n++
+		}
+		m.sourceFailures[s.Name] = n
+	}
+	m.last = snap
+}
+
+// render 以 Prometheus 文本格式输出指标，还没有完成过构建时只输出计数。
+func (m *buildMetrics) render() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var w metricsWriter
+	w.family("adguardlist_builds_total", "counter", "Number of builds since the process started.")
+	for _, result := range []string{"success", "failure"} {
+		w.sample("adguardlist_builds_total", labels("result", result), float64(m.builds[result]))
+	}
+	w.family("adguardlist_source_download_failures_total", "counter", "Number of failed downloads per source since the process started.")
+	names := make([]string, 0, len(m.sourceFailures))
+	for name := range m.sourceFailures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.sample("adguardlist_source_download_failures_total", labels("source", name), float64(m.sourceFailures[name]))
+	}
+
+	last := m.last
+	if last == nil {
+		return w.Bytes()
+	}
+	success := 0.0
+	if last.success {
+		success = 1
+	}
+	w.gauge("adguardlist_build_success", "Whether the last build succeeded.", success)
+	w.gauge("adguardlist_build_timestamp_seconds", "Unix time when the last build finished.", float64(last.finished.Unix()))
+	w.gauge("adguardlist_build_duration_seconds", "Duration of the last build.", last.duration.Seconds())
+	w.gauge("adguardlist_rules", "Number of rules in the last published list.", float64(last.rules))
+
+	w.family("adguardlist_build_stage_duration_seconds", "gauge", "Duration of each stage of the last build.")
+	for _, t := range last.timings {
+		w.sample("adguardlist_build_stage_duration_seconds", labels("stage", t.Name), t.Duration.Seconds())
+	}
+	counts := map[string]int{}
+	for _, s := range last.sources {
+		counts[s.Status]++
+	}
+	w.family("adguardlist_sources", "gauge", "Number of sources in the last build by download status.")
+	for _, status := range []string{"ok", "stale", "failed", "quarantined"} {
+		w.sample("adguardlist_sources", labels("status", status), float64(counts[status]))
+	}
+	w.family("adguardlist_source_up", "gauge", "Whether the source was downloaded in the last build (stale copies count as down).")
+	for _, s := range last.sources {
+		up := 0.0
+		if s.Status == "ok" {
+			up = 1
+		}
+		w.sample("adguardlist_source_up", labels("source", s.Name), up)
+	}
+	w.family("adguardlist_source_download_duration_seconds", "gauge", "Download duration of each source in the last build, including retries.")
+	for _, s := range last.sources {
+		w.sample("adguardlist_source_download_duration_seconds", labels("source", s.Name), s.Duration)
+	}
+	w.family("adguardlist_source_bytes", "gauge", "Downloaded size of each source in the last build.")
+	for _, s := range last.sources {
+		w.sample("adguardlist_source_bytes", labels("source", s.Name), float64(s.Bytes))
+	}
+	w.family("adguardlist_source_rules", "gauge", "Rules kept from each source after deduplication in the last build.")
+	for _, s := range last.sources {
+		w.sample("adguardlist_source_rules", labels("source", s.Name), float64(s.Kept))
+	}
+	w.family("adguardlist_source_unique_rules", "gauge", "Rules found only in this source in the last build.")
+	for _, s := range last.sources {
+		w.sample("adguardlist_source_unique_rules", labels("source", s.Name), float64(s.Unique))
+	}
+	return w.Bytes()
+}
+
+// ServeHTTP 实现 http.Handler，输出 Prometheus 文本格式的指标。
+func (m *buildMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.render())
+}
+
+// push 将当前指标推送到 Pushgateway，替换同一 job 下的全部指标。URL 中的 ${VAR} 会替换为环境变量。
+func (m *buildMetrics) push(mc MetricsConfig) error {
+	endpoint := strings.TrimSuffix(os.ExpandEnv(mc.PushgatewayURL), "/") + "/metrics/job/" + url.PathEscape(mc.Job)
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(m.render()))
+	if err != nil {
+		return fmt.Errorf("invalid pushgateway_url: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	client := &http.Client{Timeout: metricsPushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// recordMetrics 记录构建结果，配置了 Pushgateway 时推送指标，推送失败只给出警告。
+func recordMetrics(cfg *Config, res *output.Result, started time.Time, buildErr error) {
+	metrics.record(res, started, buildErr)
+	if cfg.Metrics.PushgatewayURL == "" {
+		return
+	}
+	if err := metrics.push(cfg.Metrics); err != nil {
+		logging.Publisher.Warn("⚠️ Failed to push metrics to Pushgateway", "error", err)
+		return
+	}
+	logging.Publisher.Debug("📈 Pushed metrics to Pushgateway", "job", cfg.Metrics.Job)
+}
+
+// checkMetrics 校验 metrics 配置。
+func checkMetrics(mc MetricsConfig) error {
+	if mc.Path != "" && !strings.HasPrefix(mc.Path, "/") {
+		return fmt.Errorf("metrics.path must start with /, got %q", mc.Path)
+	}
+	if mc.PushgatewayURL != "" && mc.Job == "" {
+		return fmt.Errorf("metrics.job must not be empty when pushgateway_url is set")
+	}
+	return nil
+}
+
+// metricsWriter 生成 Prometheus 文本格式。
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+// family 输出一个指标的 HELP 与 TYPE 行。
+func (w *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample 输出一个样本，labels 为已格式化的 {k="v"} 或空串。
+func (w *metricsWriter) sample(name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %g\n", name, labels, value)
+}
+
+// gauge 输出只有一个无标签样本的 gauge。
+func (w *metricsWriter) gauge(name, help string, value float64) {
+	w.family(name, "gauge", help)
+	w.sample(name, "", value)
+}
+
+// labelEscaper 转义标签值中的反斜杠、双引号与换行。
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels 将成对的标签名与值格式化为 {k="v",...}。
+func labels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", kv[i], labelEscaper.Replace(kv[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// NotifyConfig 是构建完成或失败后发送的通知。
+type NotifyConfig struct {
+	Email    EmailConfig       `yaml:"email"`
+	Telegram TelegramConfig    `yaml:"telegram"`
+	Slack    ChatWebhookConfig `yaml:"slack"`
+	Discord  ChatWebhookConfig `yaml:"discord"`
+	Webhooks []WebhookConfig   `yaml:"webhooks"`
+}
+
+// 通知的发送时机。
+const (
+	notifyNever   = "never"
+	notifyFailure = "failure" // 构建失败或有源下载失败时
+	notifyAlways  = "always"
+)
+
+// notifyTimeout 是发送全部通知的最长时间，避免通知服务不可用时拖住构建。
+const notifyTimeout = time.Minute
+
+// notificationData 是通知模板可以使用的字段。
+type notificationData struct {
+	Title       string
+	Success     bool
+	Status      string // succeeded、succeeded with failures 或 failed
+	Error       string
+	Started     time.Time
+	Duration    time.Duration
+	Rules       int
+	Sources     int
+	Succeeded   int
+	Stale       int
+	Quarantined int
+	Failed      []failedSourceInfo
+	Homepage    string
+	ListURL     string // 合并列表的订阅地址，无法确定时为空
+	IndexURL    string // 索引页的地址，无法确定或不生成时为空
+
+	// HasDiff 表示有上一次发布的列表可以比较，Added 与 Removed 是与其相比新增与删除的规则数
+	HasDiff bool
+	Added   int
+	Removed int
+
+	// report 是发送给 webhook 的构建报告，模板中不可用
+	report buildReport
+}
+
+// failedSourceInfo 是一个下载失败（或回退到缓存）的源。
+type failedSourceInfo struct {
+	Name  string
+	URL   string
+	Error string
+}
+
+// notificationSubject 是通知标题的默认模板。
+const notificationSubject = `{{.Title}}: build {{.Status}}`
+
+// notificationBody 是通知正文的默认模板。
+const notificationBody = `Build {{.Status}} at {{.Started.Format "2006-01-02 15:04:05 MST"}} in {{.Duration}}.
+{{if .Error}}
+Error: {{.Error}}
+{{end}}
+Rules:   {{.Rules}}{{if .HasDiff}} (+{{.Added}} / -{{.Removed}} since the previous build){{end}}
+Sources: {{.Succeeded}}/{{.Sources}} downloaded{{if .Stale}}, {{.Stale}} served from cache{{end}}{{if .Quarantined}}, {{.Quarantined}} quarantined{{end}}
+{{- if .Failed}}
+
+Failed sources:
+{{- range .Failed}}
+- {{.Name}} ({{.URL}}): {{.Error}}
+{{- end}}
+{{- end}}
+{{if .ListURL}}
+List:  {{.ListURL}}
+{{- end}}
+{{- if .IndexURL}}
+Index: {{.IndexURL}}
+{{- end}}
+{{.Homepage}}
+`
+
+// newNotificationData 汇总一次构建的结果，buildErr 为 nil 表示构建成功。
+func newNotificationData(cfg *Config, res *output.Result, started time.Time, buildErr error) notificationData {
+	data := notificationData{
+		Title:       cfg.Output.Header.Title,
+		Success:     buildErr == nil,
+		Status:      "succeeded",
+		Started:     started,
+		Duration:    time.Since(started).Round(time.Millisecond),
+		Rules:       res.RuleCount,
+		Sources:     len(res.Sources),
+		Succeeded:   len(res.Downloads) - res.StaleCount(),
+		Stale:       res.StaleCount(),
+		Quarantined: len(res.Quarantined),
+		Homepage:    cfg.Output.Header.HomepageURL(),
+		report:      newBuildReport(cfg, res, started, buildErr),
+	}
+	if base := output.PublishBaseURL(&cfg.Output); base != "" {
+		data.ListURL = base + cfg.Output.OutputFile
+		if cfg.Output.Index.HTML != "" {
+			data.IndexURL = base + cfg.Output.Index.HTML
+		}
+	}
+	if res.Previous != nil && res.Content != nil {
+		oldRules, newRules := ruleSet(res.Previous), ruleSet(res.Content)
+		data.HasDiff = true
+		data.Added, data.Removed = len(missingFrom(newRules, oldRules)), len(missingFrom(oldRules, newRules))
+	}
+	for _, s := range reportSources(res) {
+		if s.Status == "failed" || s.Status == "stale" {
+			data.Failed = append(data.Failed, failedSourceInfo{Name: s.Name, URL: s.URL, Error: s.Error})
+		}
+	}
+	switch {
+	case buildErr != nil:
+		data.Status = "failed"
+		data.Error = buildErr.Error()
+	case len(data.Failed) > 0:
+		data.Status = "succeeded with failures"
+	}
+	return data
+}
+
+// shouldNotify 报告时机为 on 的通知是否应为本次构建发送。
+func (d notificationData) shouldNotify(on string) bool {
+	switch on {
+	case notifyAlways:
+		return true
+	case notifyFailure:
+		return !d.Success || len(d.Failed) > 0
+	}
+	return false
+}
+
+// renderNotification 用 text 模板渲染通知，text 为空时使用 fallback。
+// 以 @ 开头的 text 表示从该路径的文件读取模板。
+func renderNotification(name, text, fallback string, data notificationData) (string, error) {
+	if strings.HasPrefix(text, "@") {
+		content, err := os.ReadFile(text[1:])
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s template: %w", name, err)
+		}
+		text = string(content)
+	}
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// notifier 是一种通知渠道。
+type notifier struct {
+	name string
+	on   string
+	send func(ctx context.Context, data notificationData) error
+}
+
+// notifiers 返回 cfg 中的全部通知渠道。
+func notifiers(cfg *Config) []notifier {
+	nc := cfg.Notify
+	list := []notifier{
+		{"email", nc.Email.On, nc.Email.send},
+		{"telegram", nc.Telegram.On, nc.Telegram.send},
+		{"slack", nc.Slack.On, nc.Slack.sender("slack")},
+		{"discord", nc.Discord.On, nc.Discord.sender("discord")},
+	}
+	for i, wc := range nc.Webhooks {
+		list = append(list, notifier{fmt.Sprintf("webhook #%d", i+1), wc.On, wc.send})
+	}
+	return list
+}
+
+// sendNotifications 发送配置的通知。通知失败只记录警告，不影响构建结果。
+func sendNotifications(ctx context.Context, cfg *Config, res *output.Result, started time.Time, buildErr error) {
+	var enabled []notifier
+	for _, n := range notifiers(cfg) {
+		if n.on != notifyNever {
+			enabled = append(enabled, n)
+		}
+	}
+	if len(enabled) == 0 {
+		return
+	}
+	data := newNotificationData(cfg, res, started, buildErr)
+	// 构建超时或被取消时仍然发送失败通知
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+	for _, n := range enabled {
+		if !data.shouldNotify(n.on) {
+			continue
+		}
+		if err := n.send(ctx, data); err != nil {
+			logging.Publisher.Warn("⚠️ Failed to send notification", "channel", n.name, "error", err)
+			continue
+		}
+		logging.Publisher.Info("📣 Sent notification", "channel", n.name, "status", data.Status)
+	}
+}
+
+// checkNotifyOn 校验通知的发送时机。
+func checkNotifyOn(name, on string) error {
+	switch on {
+	case notifyNever, notifyFailure, notifyAlways:
+		return nil
+	}
+	return fmt.Errorf("notify.%s.on must be %q, %q or %q, got %q", name, notifyNever, notifyFailure, notifyAlways, on)
+}
+
+// checkNotify 校验 notify 配置。
+func checkNotify(nc NotifyConfig) error {
+	if err := checkEmail(nc.Email); err != nil {
+		return err
+	}
+	if err := checkTelegram(nc.Telegram); err != nil {
+		return err
+	}
+	if err := checkChatWebhook("slack", nc.Slack); err != nil {
+		return err
+	}
+	if err := checkChatWebhook("discord", nc.Discord); err != nil {
+		return err
+	}
+	return checkWebhooks(nc.Webhooks)
+}
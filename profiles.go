@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"adguardlist/internal/output"
+	"adguardlist/internal/source"
+	"adguardlist/internal/transform"
+)
+
+// ProfileConfig 是一个额外的构建配置：从全部源中选出一部分、使用自己的转换列表，
+// 与合并列表在同一次运行中生成，复用已下载的内容。
+type ProfileConfig struct {
+	Name            string   `yaml:"name"`
+	OutputFile      string   `yaml:"output_file"`     // 默认 <name>.txt
+	Title           string   `yaml:"title"`           // 默认在 header.title 后加上 (<name>)
+	Sources         []string `yaml:"sources"`         // 只使用这些名称的源，为空表示全部源
+	Categories      []string `yaml:"categories"`      // 只使用带有这些分类之一的源
+	ExcludeSources  []string `yaml:"exclude_sources"` // 排除这些名称的源
+	Transformations []string `yaml:"transformations"` // 代替全局 transformations，未设置时沿用
+}
+
+// checkProfiles 校验 cfg.Profiles 并填充默认值，名称与输出文件不能重复。
+func checkProfiles(cfg *Config) error {
+	names := make(map[string]bool)
+	files := map[string]bool{cfg.Output.OutputFile: true}
+	for _, o := range cfg.Output.Outputs {
+		files[o.File] = true
+	}
+	for i := range cfg.Profiles {
+		p := &cfg.Profiles[i]
+		if !source.CategoryPattern.MatchString(p.Name) {
+			return fmt.Errorf("profile #%d has invalid name %q", i+1, p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		names[p.Name] = true
+		if p.OutputFile == "" {
+			p.OutputFile = p.Name + ".txt"
+		}
+		if filepath.Base(p.OutputFile) != p.OutputFile {
+			return fmt.Errorf("profile %s: output_file must be a plain file name, got %q", p.Name, p.OutputFile)
+		}
+		if files[p.OutputFile] {
+			return fmt.Errorf("profile %s: output_file %q is already used by another output", p.Name, p.OutputFile)
+		}
+		files[p.OutputFile] = true
+		if p.Title == "" {
+			p.Title = fmt.Sprintf("%s (%s)", cfg.Output.Header.Title, p.Name)
+		}
+		categories, err := source.NormalizeCategories(p.Categories)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		p.Categories = categories
+		for _, t := range p.Transformations {
+			if !transform.Known[t] {
+				return fmt.Errorf("profile %s: unknown transformation %q", p.Name, t)
+			}
+		}
+	}
+	return nil
+}
+
+// includes 报告 src 是否属于该 profile。
+func (p ProfileConfig) includes(src source.Source) bool {
+	if len(p.Sources) > 0 && !slices.Contains(p.Sources, src.Name) {
+		return false
+	}
+	if slices.Contains(p.ExcludeSources, src.Name) {
+		return false
+	}
+	if len(p.Categories) == 0 {
+		return true
+	}
+	for _, c := range src.Categories {
+		if slices.Contains(p.Categories, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// config 返回该 profile 使用的配置副本。额外输出格式、分类列表与各种报告只为合并列表生成；
+// 失效域名检查也只针对合并列表，避免同一次构建中重复累计 NXDOMAIN 次数。
+func (p ProfileConfig) config(cfg *Config) *Config {
+	c := *cfg
+	c.Output.OutputFile = p.OutputFile
+	c.Output.Header.Title = p.Title
+	if p.Transformations != nil {
+		c.Compile.Transformations = p.Transformations
+	}
+	c.Output.Outputs = nil
+	c.Output.CategoryFile = ""
+	c.Output.RejectedReport = ""
+	c.Output.ConflictReport = ""
+	c.Output.SourceReport = ""
+	c.Compile.DeadDomains.Enabled = false
+	c.Output.Deltas.Dir = path.Join(cfg.Output.Deltas.Dir, p.Name)
+	return &c
+}
+
+// buildProfile 用 main 中已下载的源生成 profile 的列表，写入的发布文件追加到 main.Published。
+func buildProfile(ctx context.Context, cfg *Config, p ProfileConfig, main *output.Result) error {
+	res := &output.Result{}
+	for _, src := range main.Sources {
+		if p.includes(src) {
+			res.Sources = append(res.Sources, src)
+		}
+	}
+	for _, d := range main.Downloads {
+		if p.includes(d.Source) {
+			res.Downloads = append(res.Downloads, d)
+		}
+	}
+	for _, src := range main.Failed {
+		if p.includes(src) {
+			res.Failed = append(res.Failed, src)
+		}
+	}
+	for _, name := range append(append([]string(nil), p.Sources...), p.ExcludeSources...) {
+		if !containsSource(main.Sources, name) && !containsSource(main.Quarantined, name) {
+			slog.Warn("⚠️ Profile refers to unknown or disabled source", "profile", p.Name, "source", name)
+		}
+	}
+	if len(res.Downloads) == 0 {
+		return fmt.Errorf("profile %s: none of its %d sources were downloaded successfully", p.Name, len(res.Sources))
+	}
+
+	slog.Info("🧭 Building profile...", "profile", p.Name, "sources", len(res.Sources), "total", len(main.Sources))
+	if err := newBuilder(p.config(cfg)).Compile(ctx, res); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	main.Published = append(main.Published, res.Published...)
+	for name, a := range res.Artifacts {
+		main.Describe(name, a.Format, a.Rules)
+	}
+	return nil
+}
+
+// containsSource 报告 sources 中是否有名为 name 的源。
+func containsSource(sources []source.Source, name string) bool {
+	for _, src := range sources {
+		if src.Name == name {
+			return true
+		}
+	}
+	return false
+}
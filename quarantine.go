@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+	"adguardlist/internal/source"
+)
+
+// QuarantineConfig 控制失效源的自动隔离：连续 Failures 次构建下载失败（含回退到缓存）的源会被隔离，
+// 之后的构建不再下载它，直到用 quarantine release 命令解除或修改了源的 URL。
+type QuarantineConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Failures  int    `yaml:"failures"`
+	StateFile string `yaml:"state_file"`
+	Report    string `yaml:"report"`
+}
+
+// quarantineState 以源的 URL 为键，记录连续下载失败的源。
+type quarantineState struct {
+	Sources map[string]*quarantineEntry `json:"sources"`
+}
+
+// quarantineEntry 是一个源的连续失败记录，Since 不为零表示已被隔离。
+type quarantineEntry struct {
+	Name        string    `json:"name"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"last_error"`
+	LastFailure time.Time `json:"last_failure"`
+	Since       time.Time `json:"quarantined_since,omitempty"`
+}
+
+// quarantined 报告该源是否已被隔离。
+func (e *quarantineEntry) quarantined() bool {
+	return !e.Since.IsZero()
+}
+
+// applyQuarantine 从 res.Sources 中移出已被隔离的源，移出的源记录在 res.Quarantined 中。
+func applyQuarantine(cfg *Config, res *output.Result) error {
+	qc := cfg.Quarantine
+	if !qc.Enabled {
+		return nil
+	}
+	state, err := loadQuarantineState(qc.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read quarantine state '%s': %w", qc.StateFile, err)
+	}
+	var active []source.Source
+	for _, src := range res.Sources {
+		if e := state.Sources[src.URL]; e != nil && e.quarantined() {
+			res.Quarantined = append(res.Quarantined, src)
+			continue
+		}
+		active = append(active, src)
+	}
+	res.Sources = active
+	if len(res.Quarantined) > 0 {
+		logging.Downloader.Warn("⏸️ Skipping quarantined sources", "count", len(res.Quarantined), "report", filepath.Join(cfg.Output.OutputDir, qc.Report))
+	}
+	return nil
+}
+
+// updateQuarantine 按本次的下载结果更新连续失败次数，达到 Failures 次的源被隔离，
+// 并重新生成隔离报告。下载成功的源清除失败记录。
+func updateQuarantine(cfg *Config, res *output.Result) error {
+	qc := cfg.Quarantine
+	if !qc.Enabled {
+		return nil
+	}
+	state, err := loadQuarantineState(qc.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read quarantine state '%s': %w", qc.StateFile, err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, src := range res.Sources {
+		o, ok := res.Outcomes[src.URL]
+		if !ok {
+			continue
+		}
+		if o.Err == nil {
+			delete(state.Sources, src.URL)
+			continue
+		}
+		e := state.Sources[src.URL]
+		if e == nil {
+			e = &quarantineEntry{}
+			state.Sources[src.URL] = e
+		}
+		e.Name = src.Name
+		e.Failures++
+		e.LastError = o.Err.Error()
+		e.LastFailure = now
+		if e.Failures >= qc.Failures && !e.quarantined() {
+			e.Since = now
+			logging.Downloader.Warn("⏸️ Quarantined source after consecutive failures", "source", src.Name, "failures", e.Failures,
+				"error", e.LastError)
+		}
+	}
+	// 删除已不在源列表中的源
+	current := make(map[string]bool, len(res.Sources)+len(res.Quarantined))
+	for _, src := range append(append([]source.Source(nil), res.Sources...), res.Quarantined...) {
+		current[src.URL] = true
+	}
+	for url := range state.Sources {
+		if !current[url] {
+			delete(state.Sources, url)
+		}
+	}
+	if err := state.save(qc.StateFile); err != nil {
+		return fmt.Errorf("failed to write quarantine state '%s': %w", qc.StateFile, err)
+	}
+	return writeQuarantineReport(cfg, state)
+}
+
+// writeQuarantineReport 将被隔离的源写入输出目录下的 cfg.Quarantine.Report，没有被隔离的源时删除旧报告。
+func writeQuarantineReport(cfg *Config, state *quarantineState) error {
+	if cfg.Quarantine.Report == "" {
+		return nil
+	}
+	path := filepath.Join(cfg.Output.OutputDir, cfg.Quarantine.Report)
+	urls := state.quarantinedURLs()
+	if len(urls) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove quarantine report '%s': %w", path, err)
+		}
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %d quarantined sources, release with: %s quarantine release <name or url>\n", len(urls), os.Args[0])
+	b.WriteString("# name\turl\tfailures\tquarantined_since\tlast_error\n")
+	for _, url := range urls {
+		e := state.Sources[url]
+		fmt.Fprintf(&b, "%s\t%s\t%d\t%s\t%s\n", e.Name, url, e.Failures, e.Since.Format(time.RFC3339), strings.ReplaceAll(e.LastError, "\n", " "))
+	}
+	if err := os.MkdirAll(cfg.Output.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", cfg.Output.OutputDir, err)
+	}
+	if err := fileutil.WriteAtomic(path, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write quarantine report '%s': %w", path, err)
+	}
+	return nil
+}
+
+// quarantinedURLs 返回被隔离的源的 URL，按名称排序。
+func (s *quarantineState) quarantinedURLs() []string {
+	var urls []string
+	for url, e := range s.Sources {
+		if e.quarantined() {
+			urls = append(urls, url)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		a, b := s.Sources[urls[i]], s.Sources[urls[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return urls[i] < urls[j]
+	})
+	return urls
+}
+
+// loadQuarantineState 读取隔离记录，文件不存在时返回空记录。
+func loadQuarantineState(path string) (*quarantineState, error) {
+	state := &quarantineState{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, err
+		}
+	}
+	if state.Sources == nil {
+		state.Sources = make(map[string]*quarantineEntry)
+	}
+	return state, nil
+}
+
+// save 将隔离记录写入 path。
+func (s *quarantineState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(path, append(data, '\n'))
+}
+
+// checkQuarantine 校验 quarantine 配置。
+func checkQuarantine(qc QuarantineConfig) error {
+	if !qc.Enabled {
+		return nil
+	}
+	if qc.Failures < 1 {
+		return fmt.Errorf("quarantine.failures must be at least 1, got %d", qc.Failures)
+	}
+	if qc.StateFile == "" {
+		return fmt.Errorf("quarantine.state_file must not be empty")
+	}
+	if filepath.Base(qc.Report) != qc.Report {
+		return fmt.Errorf("quarantine.report must be a plain file name, got %q", qc.Report)
+	}
+	return nil
+}
+
+// cmdQuarantine 列出被隔离的源，或解除指定源的隔离。
+func cmdQuarantine(ctx context.Context, cfg *Config, args []string) error {
+	fs := newFlagSet("quarantine", "[list | release [-all] <name or url>...]")
+	fs.Parse(args)
+	state, err := loadQuarantineState(cfg.Quarantine.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read quarantine state '%s': %w", cfg.Quarantine.StateFile, err)
+	}
+
+	action, rest := "list", fs.Args()
+	if len(rest) > 0 {
+		action, rest = rest[0], rest[1:]
+	}
+	switch action {
+	case "list":
+		urls := state.quarantinedURLs()
+		if len(urls) == 0 {
+			fmt.Println("No sources are quarantined.")
+			return nil
+		}
+		for _, url := range urls {
+			e := state.Sources[url]
+			fmt.Printf("%s (%s)\n  quarantined since %s after %d failures\n  last error: %s\n",
+				e.Name, url, e.Since.Format(time.RFC3339), e.Failures, e.LastError)
+		}
+		return nil
+	case "release":
+		rfs := newFlagSet("quarantine release", "<name or url>...")
+		all := rfs.Bool("all", false, "release all quarantined sources")
+		rfs.Parse(rest)
+		if !*all && rfs.NArg() == 0 {
+			rfs.Usage()
+			return fmt.Errorf("expected source names or urls, or -all")
+		}
+		released := 0
+		for url, e := range state.Sources {
+			if *all || slices.Contains(rfs.Args(), url) || slices.Contains(rfs.Args(), e.Name) {
+				delete(state.Sources, url)
+				if e.quarantined() {
+					fmt.Printf("Released %s (%s)\n", e.Name, url)
+					released++
+				}
+			}
+		}
+		if released == 0 {
+			return fmt.Errorf("no matching quarantined sources")
+		}
+		if err := state.save(cfg.Quarantine.StateFile); err != nil {
+			return fmt.Errorf("failed to write quarantine state '%s': %w", cfg.Quarantine.StateFile, err)
+		}
+		return writeQuarantineReport(cfg, state)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown quarantine action %q", action)
+	}
+}
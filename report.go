@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"adguardlist/internal/fileutil"
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// buildReport 是 report.json 的顶层结构，供 CI 读取构建结果而无需解析日志。
+type buildReport struct {
+	Version   string             `json:"version"`
+	Started   time.Time          `json:"started"`
+	Success   bool               `json:"success"`
+	Error     string             `json:"error,omitempty"`
+	Duration  float64            `json:"duration_seconds"`
+	Timings   map[string]float64 `json:"timings_seconds"`
+	Counts    output.JSONCounts  `json:"counts"`
+	Sources   []reportSource     `json:"sources"`
+	Published []reportFile       `json:"published"`
+	IPFSCID   string             `json:"ipfs_cid,omitempty"`
+}
+
+// reportSource 是单个源的下载结果与统计。
+type reportSource struct {
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Status     string  `json:"status"` // ok、stale、failed 或 quarantined
+	Error      string  `json:"error,omitempty"`
+	Duration   float64 `json:"duration_seconds"`
+	Format     string  `json:"format,omitempty"`
+	Bytes      int     `json:"bytes"`
+	Fetched    int     `json:"fetched"`
+	Kept       int     `json:"kept"`
+	Duplicates int     `json:"duplicates"`
+	Repeated   int     `json:"repeated"`
+	Rejected   int     `json:"rejected"`
+	Unique     int     `json:"unique"`
+}
+
+// reportFile 是一个发布文件的大小与 SHA-256。
+type reportFile struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// newBuildReport 汇总构建结果，构建失败时 buildErr 记录在 error 字段中。
+func newBuildReport(cfg *Config, res *output.Result, started time.Time, buildErr error) buildReport {
+	report := buildReport{
+		Version:  started.Format("200601021504"),
+		Started:  started.UTC().Truncate(time.Second),
+		Success:  buildErr == nil,
+		Duration: time.Since(started).Seconds(),
+		Timings:  make(map[string]float64, len(res.Timings)),
+		Counts: output.JSONCounts{
+			Rules:     res.RuleCount,
+			Sources:   len(res.Sources),
+			Succeeded: len(res.Downloads),
+			Failed:    len(res.Failed),
+			Stale:     res.StaleCount(),
+			Excluded:  res.Excluded,
+			Dead:      res.Dead,
+			Truncated: res.Truncated,
+		},
+		Sources:   reportSources(res),
+		Published: make([]reportFile, 0, len(res.Published)),
+		IPFSCID:   res.IPFSCID,
+	}
+	if buildErr != nil {
+		report.Error = buildErr.Error()
+	}
+	for _, t := range res.Timings {
+		report.Timings[t.Name] = t.Duration.Seconds()
+	}
+
+	for _, name := range res.Published {
+		path := filepath.Join(cfg.Output.PublishDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		sum, ok := res.Checksums[name]
+		if !ok {
+			if sum, err = output.FileSHA256(path); err != nil {
+				continue
+			}
+		}
+		report.Published = append(report.Published, reportFile{File: name, Size: info.Size(), SHA256: sum})
+	}
+	return report
+}
+
+// writeBuildReport 将构建结果写入输出目录下的 cfg.ReportFile，配置为空时不生成。构建失败时同样写入。
+func writeBuildReport(cfg *Config, res *output.Result, started time.Time, buildErr error) error {
+	if cfg.ReportFile == "" {
+		return nil
+	}
+	report := newBuildReport(cfg, res, started, buildErr)
+	if err := os.MkdirAll(cfg.Output.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", cfg.Output.OutputDir, err)
+	}
+	path := filepath.Join(cfg.Output.OutputDir, cfg.ReportFile)
+	// buildReport 只包含字符串、数字与时间，编码不会失败
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if err := fileutil.WriteAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write build report to '%s': %w", path, err)
+	}
+	logging.Publisher.Debug("📋 Wrote build report", "path", path)
+	return nil
+}
+
+// reportSources 返回每个启用的源的下载结果与统计，顺序与源列表一致，被隔离的源排在最后。
+func reportSources(res *output.Result) []reportSource {
+	downloaded := make(map[string]int, len(res.Downloads))
+	for i, d := range res.Downloads {
+		downloaded[d.Source.URL] = i
+	}
+	sources := make([]reportSource, 0, len(res.Sources))
+	for _, src := range res.Sources {
+		s := reportSource{Name: src.Name, URL: src.URL, Status: "failed"}
+		if o, ok := res.Outcomes[src.URL]; ok {
+			s.Duration = o.Duration.Seconds()
+			if o.Err != nil {
+				s.Error = o.Err.Error()
+			}
+		}
+		if i, ok := downloaded[src.URL]; ok {
+			s.Status = "ok"
+			if res.Downloads[i].Stale {
+				s.Status = "stale"
+			}
+			if i < len(res.Stats) {
+				st := res.Stats[i]
+				s.Format, s.Bytes, s.Fetched, s.Kept = st.Format, st.Bytes, st.Rules, st.Kept()
+				s.Duplicates, s.Repeated, s.Rejected, s.Unique = st.Duplicates, st.Repeated, st.Rejected, st.Unique
+			}
+		}
+		sources = append(sources, s)
+	}
+	for _, src := range res.Quarantined {
+		sources = append(sources, reportSource{Name: src.Name, URL: src.URL, Status: "quarantined"})
+	}
+	return sources
+}
+
+// logTimings 输出各阶段的耗时及其占整个构建的比例。
+func logTimings(res *output.Result, started time.Time) {
+	total := time.Since(started)
+	args := []any{"total", total.Round(time.Millisecond)}
+	for _, t := range res.Timings {
+		args = append(args, t.Name, fmt.Sprintf("%s (%.0f%%)", t.Duration.Round(time.Millisecond), 100*t.Duration.Seconds()/total.Seconds()))
+	}
+	slog.Info("⏱️ Stage timings", args...)
+}
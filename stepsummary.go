@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"adguardlist/internal/logging"
+	"adguardlist/internal/output"
+)
+
+// stepSummaryDiffLines 是作业摘要中列出的新增、删除规则的最大条数。
+const stepSummaryDiffLines = 20
+
+// writeStepSummary 在 GitHub Actions 中运行时，将 Markdown 格式的构建摘要追加到 GITHUB_STEP_SUMMARY，
+// 包括构建结果、各源的下载状态与统计、失败原因以及与上一次发布的列表的差异。构建失败时同样写入。
+func writeStepSummary(res *output.Result, started time.Time, buildErr error) {
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return
+	}
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logging.Publisher.Warn("⚠️ Could not open GITHUB_STEP_SUMMARY file", "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(renderStepSummary(res, started, buildErr)); err != nil {
+		logging.Publisher.Warn("⚠️ Failed to write GITHUB_STEP_SUMMARY", "error", err)
+	}
+}
+
+// renderStepSummary 生成作业摘要的 Markdown 内容。
+func renderStepSummary(res *output.Result, started time.Time, buildErr error) string {
+	var b strings.Builder
+	if buildErr == nil {
+		b.WriteString("## ✅ Rules list build succeeded\n\n")
+	} else {
+		fmt.Fprintf(&b, "## ❌ Rules list build failed\n\n> %s\n\n", output.MarkdownCell(buildErr.Error()))
+	}
+
+	sources := reportSources(res)
+	counts := map[string]int{}
+	for _, s := range sources {
+		counts[s.Status]++
+	}
+	var stages []string
+	for _, t := range res.Timings {
+		stages = append(stages, fmt.Sprintf("%s %s", t.Name, t.Duration.Round(time.Millisecond)))
+	}
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Rules | %d |\n", res.RuleCount)
+	var added, removed []string
+	hasPrevious := res.Previous != nil && res.Content != nil
+	if hasPrevious {
+		oldRules, newRules := ruleSet(res.Previous), ruleSet(res.Content)
+		added, removed = missingFrom(newRules, oldRules), missingFrom(oldRules, newRules)
+		fmt.Fprintf(&b, "| Change | +%d / -%d (previous build: %d rules) |\n", len(added), len(removed), len(oldRules))
+	}
+	fmt.Fprintf(&b, "| Sources | %d ok, %d stale, %d failed of %d |\n", counts["ok"], counts["stale"], counts["failed"], len(res.Sources))
+	if counts["quarantined"] > 0 {
+		fmt.Fprintf(&b, "| Quarantined | %d sources skipped after repeated failures |\n", counts["quarantined"])
+	}
+	if res.Excluded > 0 || res.Dead > 0 || res.Truncated > 0 {
+		fmt.Fprintf(&b, "| Removed | %d excluded, %d dead domains, %d over max_rules |\n", res.Excluded, res.Dead, res.Truncated)
+	}
+	duration := time.Since(started).Round(time.Millisecond).String()
+	if len(stages) > 0 {
+		duration += " (" + strings.Join(stages, ", ") + ")"
+	}
+	fmt.Fprintf(&b, "| Duration | %s |\n", duration)
+	if len(res.Published) > 0 {
+		fmt.Fprintf(&b, "| Published | %d files |\n", len(res.Published))
+	}
+	if res.IPFSCID != "" {
+		fmt.Fprintf(&b, "| IPFS | `%s` |\n", res.IPFSCID)
+	}
+
+	if len(sources) > 0 {
+		b.WriteString("\n### Sources\n\n| Source | Status | Fetched | Kept | Unique | Time |\n|---|---|--:|--:|--:|--:|\n")
+		icons := map[string]string{"ok": "✅", "stale": "⚠️", "failed": "❌", "quarantined": "⏸️"}
+		for _, s := range sources {
+			fmt.Fprintf(&b, "| %s | %s %s | %d | %d | %d | %.1fs |\n",
+				output.MarkdownCell(s.Name), icons[s.Status], s.Status, s.Fetched, s.Kept, s.Unique, s.Duration)
+		}
+	}
+
+	var failures []reportSource
+	for _, s := range sources {
+		if s.Error != "" {
+			failures = append(failures, s)
+		}
+	}
+	if len(failures) > 0 {
+		b.WriteString("\n### Download failures\n\n")
+		for _, s := range failures {
+			note := ""
+			if s.Status == "stale" {
+				note = " (using stale cached copy)"
+			}
+			fmt.Fprintf(&b, "- **%s**%s: `%s`\n", output.MarkdownCell(s.Name), note, strings.ReplaceAll(s.Error, "`", "'"))
+		}
+	}
+	if hasPrevious {
+		writeSummaryDiff(&b, added, removed)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// writeSummaryDiff 以折叠块列出最多 stepSummaryDiffLines 条新增与删除的规则。
+func writeSummaryDiff(b *strings.Builder, added, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	b.WriteString("\n<details><summary>Changes since the previous build</summary>\n\n```diff\n")
+	for _, group := range []struct {
+		prefix string
+		rules  []string
+	}{{"-", removed}, {"+", added}} {
+		for i, rule := range group.rules {
+			if i == stepSummaryDiffLines {
+				fmt.Fprintf(b, "%s ... %d more\n", group.prefix, len(group.rules)-i)
+				break
+			}
+			fmt.Fprintf(b, "%s %s\n", group.prefix, rule)
+		}
+	}
+	b.WriteString("```\n\n</details>\n")
+}
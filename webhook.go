@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"adguardlist/internal/publish"
+)
+
+// WebhookConfig 是接收构建报告的 webhook：每次构建后以 POST 发送与 report.json 相同的 JSON。
+// URL 可写 ${VAR} 引用环境变量；SecretEnv 指定的环境变量不为空时，用其值对请求体计算 HMAC-SHA256，
+// 以 "sha256=<hex>" 的形式放在 X-Adguardlist-Signature 头中，接收方可以据此校验请求的来源。
+type WebhookConfig struct {
+	URL       string `yaml:"url"`
+	On        string `yaml:"on"`
+	SecretEnv string `yaml:"secret_env"`
+}
+
+// webhookSignatureHeader 是请求体签名所在的请求头。
+const webhookSignatureHeader = "X-Adguardlist-Signature"
+
+// send 将构建报告发送到 wc.URL。
+func (wc WebhookConfig) send(ctx context.Context, data notificationData) error {
+	// buildReport 只包含字符串、数字与时间，编码不会失败
+	body, _ := json.Marshal(data.report)
+	header := http.Header{
+		"Content-Type":          {"application/json"},
+		"User-Agent":            {"adguardlist"},
+		"X-Adguardlist-Event":   {"build"},
+		"X-Adguardlist-Version": {data.report.Version},
+	}
+	if secret := os.Getenv(wc.SecretEnv); wc.SecretEnv != "" && secret != "" {
+		header.Set(webhookSignatureHeader, "sha256="+webhookSignature(secret, body))
+	}
+	return publish.PostBody(ctx, os.ExpandEnv(wc.URL), body, header, "webhook")
+}
+
+// webhookSignature 返回 body 以 secret 为密钥的十六进制 HMAC-SHA256。
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkWebhooks 校验 notify.webhooks 并填充默认值：on 默认为 always。
+func checkWebhooks(webhooks []WebhookConfig) error {
+	for i := range webhooks {
+		wc := &webhooks[i]
+		if wc.On == "" {
+			wc.On = notifyAlways
+		}
+		if err := checkNotifyOn(fmt.Sprintf("webhooks[%d]", i), wc.On); err != nil {
+			return err
+		}
+		if wc.URL == "" {
+			return fmt.Errorf("notify.webhooks[%d].url must not be empty", i)
+		}
+		// 引用环境变量的地址在发送时才能确定，只校验不含变量的地址
+		if os.Expand(wc.URL, func(string) string { return "" }) == wc.URL {
+			if u, err := url.Parse(wc.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("notify.webhooks[%d].url must be an http(s) url", i)
+			}
+		}
+	}
+	return nil
+}